@@ -0,0 +1,229 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// 告警事件类型
+const (
+	AlertEventChannelDisabled   = "channel.disabled"
+	AlertEventChannelEnabled    = "channel.enabled"
+	AlertEventChannelLowBalance = "channel.low_balance"
+	AlertEventChannelTestFailed = "channel.test_failed"
+	AlertEventPaymentReceived   = "payment.received"
+	AlertEventErrorRateSpike    = "error_rate.spike"
+)
+
+var AlertEventTypes = []string{
+	AlertEventChannelDisabled,
+	AlertEventChannelEnabled,
+	AlertEventChannelLowBalance,
+	AlertEventChannelTestFailed,
+	AlertEventPaymentReceived,
+	AlertEventErrorRateSpike,
+}
+
+// 告警推送方式
+const (
+	AlertSinkTypeWebhook  = "webhook"
+	AlertSinkTypeSlack    = "slack"
+	AlertSinkTypeFeishu   = "feishu"
+	AlertSinkTypeDingTalk = "dingtalk"
+)
+
+// AlertSink 告警推送目标
+// webhook 类型的 Secret 用于 HMAC-SHA256 签名，飞书与钉钉类型的 Secret 为机器人的签名校验密钥。
+// Events 为空时订阅全部事件。
+type AlertSink struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Url     string   `json:"url"`
+	Secret  string   `json:"secret,omitempty"`
+	Events  []string `json:"events,omitempty"`
+	Enabled bool     `json:"enabled"`
+}
+
+// AlertConfig 运维告警配置
+// 同一事件（类型与对象相同）在 DedupeSeconds 内只推送一次，每个推送目标每分钟最多推送 RateLimitPerMinute 条。
+type AlertConfig struct {
+	Sinks                  []*AlertSink `json:"sinks"`
+	DedupeSeconds          int          `json:"dedupe_seconds"`
+	RateLimitPerMinute     int          `json:"rate_limit_per_minute"`
+	BalanceThreshold       float64      `json:"balance_threshold"`         // 渠道余额（美元）低于该值时告警，0 表示不告警
+	TestFailureThreshold   int          `json:"test_failure_threshold"`    // 渠道连续测试失败次数
+	ErrorRateThreshold     float64      `json:"error_rate_threshold"`      // 渠道错误率
+	ErrorRateMinRequests   int          `json:"error_rate_min_requests"`   // 统计窗口内请求数不足时不计算错误率
+	ErrorRateWindowSeconds int          `json:"error_rate_window_seconds"` // 错误率统计窗口
+}
+
+const alertSecretMask = "******"
+
+var alertConfig = defaultAlertConfig()
+var alertConfigLock sync.RWMutex
+
+func defaultAlertConfig() *AlertConfig {
+	return &AlertConfig{
+		Sinks:                  []*AlertSink{},
+		DedupeSeconds:          600,
+		RateLimitPerMinute:     20,
+		BalanceThreshold:       5,
+		TestFailureThreshold:   3,
+		ErrorRateThreshold:     0.5,
+		ErrorRateMinRequests:   20,
+		ErrorRateWindowSeconds: 300,
+	}
+}
+
+func GetAlertConfig() *AlertConfig {
+	alertConfigLock.RLock()
+	defer alertConfigLock.RUnlock()
+	return alertConfig
+}
+
+// Subscribed 判断推送目标是否订阅了该事件
+func (sink *AlertSink) Subscribed(eventType string) bool {
+	if !sink.Enabled {
+		return false
+	}
+	if len(sink.Events) == 0 {
+		return true
+	}
+	for _, event := range sink.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func AlertConfig2JSONString() string {
+	alertConfigLock.RLock()
+	defer alertConfigLock.RUnlock()
+	return alertConfig2JSONString(alertConfig)
+}
+
+// AlertConfig2MaskedJSONString 用于向管理界面展示配置，隐藏推送目标的密钥
+func AlertConfig2MaskedJSONString() string {
+	alertConfigLock.RLock()
+	defer alertConfigLock.RUnlock()
+	masked := *alertConfig
+	masked.Sinks = make([]*AlertSink, 0, len(alertConfig.Sinks))
+	for _, sink := range alertConfig.Sinks {
+		clone := *sink
+		if clone.Secret != "" {
+			clone.Secret = alertSecretMask
+		}
+		masked.Sinks = append(masked.Sinks, &clone)
+	}
+	return alertConfig2JSONString(&masked)
+}
+
+func alertConfig2JSONString(config *AlertConfig) string {
+	jsonBytes, err := json.Marshal(config)
+	if err != nil {
+		SysError("error marshalling alert config: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateAlertConfigByJSONString(jsonStr string) error {
+	config, err := parseAlertConfig(jsonStr)
+	if err != nil {
+		return err
+	}
+	alertConfigLock.Lock()
+	alertConfig = config
+	alertConfigLock.Unlock()
+	return nil
+}
+
+// MergeAlertSinkSecrets 管理界面提交的配置中 Secret 为掩码时沿用同名推送目标已保存的值
+// 找不到同名推送目标（如已改名）时返回错误，避免密钥被静默清空
+func MergeAlertSinkSecrets(jsonStr string) (string, error) {
+	config, err := parseAlertConfig(jsonStr)
+	if err != nil {
+		return "", err
+	}
+	alertConfigLock.RLock()
+	defer alertConfigLock.RUnlock()
+	for _, sink := range config.Sinks {
+		if sink.Secret != alertSecretMask {
+			continue
+		}
+		found := false
+		for _, existing := range alertConfig.Sinks {
+			if existing.Name == sink.Name && existing.Secret != "" {
+				sink.Secret = existing.Secret
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("推送目标「%s」未找到已保存的密钥，修改名称后请重新填写密钥", sink.Name)
+		}
+	}
+	return alertConfig2JSONString(config), nil
+}
+
+func CheckAlertConfig(jsonStr string) error {
+	_, err := parseAlertConfig(jsonStr)
+	return err
+}
+
+// 未填写的字段使用默认值
+func parseAlertConfig(jsonStr string) (*AlertConfig, error) {
+	config := defaultAlertConfig()
+	if strings.TrimSpace(jsonStr) != "" {
+		err := json.Unmarshal([]byte(jsonStr), config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Sinks == nil {
+		config.Sinks = []*AlertSink{}
+	}
+	if config.DedupeSeconds < 0 || config.RateLimitPerMinute <= 0 || config.TestFailureThreshold <= 0 ||
+		config.ErrorRateMinRequests <= 0 || config.ErrorRateWindowSeconds <= 0 {
+		return nil, errors.New("告警去重时间不能为负数，限流、连续失败次数、最少请求数和统计窗口必须大于 0")
+	}
+	if config.ErrorRateThreshold <= 0 || config.ErrorRateThreshold > 1 {
+		return nil, errors.New("错误率阈值必须大于 0 且不超过 1")
+	}
+	names := make(map[string]bool)
+	for _, sink := range config.Sinks {
+		if sink.Name == "" {
+			return nil, errors.New("告警推送目标名称不能为空")
+		}
+		if names[sink.Name] {
+			return nil, fmt.Errorf("告警推送目标 %s 重复", sink.Name)
+		}
+		names[sink.Name] = true
+		switch sink.Type {
+		case AlertSinkTypeWebhook, AlertSinkTypeSlack, AlertSinkTypeFeishu, AlertSinkTypeDingTalk:
+		default:
+			return nil, fmt.Errorf("告警推送目标 %s 的类型 %s 不支持", sink.Name, sink.Type)
+		}
+		u, err := url.Parse(sink.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("告警推送目标 %s 的地址无效", sink.Name)
+		}
+		for _, event := range sink.Events {
+			valid := false
+			for _, eventType := range AlertEventTypes {
+				if event == eventType {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return nil, fmt.Errorf("告警推送目标 %s 订阅的事件 %s 不存在", sink.Name, event)
+			}
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergeAlertSinkSecrets(t *testing.T) {
+	saved := `{"sinks":[{"name":"ops","type":"webhook","url":"https://example.com/hook","secret":"s3cret","enabled":true}]}`
+	if err := UpdateAlertConfigByJSONString(saved); err != nil {
+		t.Fatalf("UpdateAlertConfigByJSONString error: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = UpdateAlertConfigByJSONString("")
+	})
+
+	tests := []struct {
+		name       string
+		sinkName   string
+		secret     string
+		wantSecret string
+		wantErr    bool
+	}{
+		{"masked secret kept", "ops", alertSecretMask, "s3cret", false},
+		{"new secret replaces", "ops", "changed", "changed", false},
+		{"cleared secret", "ops", "", "", false},
+		{"renamed sink with mask", "ops-renamed", alertSecretMask, "", true},
+		{"renamed sink with new secret", "ops-renamed", "fresh", "fresh", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submitted, _ := json.Marshal(map[string]any{"sinks": []*AlertSink{{
+				Name: tt.sinkName, Type: AlertSinkTypeWebhook, Url: "https://example.com/hook", Secret: tt.secret, Enabled: true,
+			}}})
+			merged, err := MergeAlertSinkSecrets(string(submitted))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MergeAlertSinkSecrets error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			config, err := parseAlertConfig(merged)
+			if err != nil {
+				t.Fatalf("parseAlertConfig error: %v", err)
+			}
+			if got := config.Sinks[0].Secret; got != tt.wantSecret {
+				t.Errorf("secret = %q, want %q", got, tt.wantSecret)
+			}
+		})
+	}
+}
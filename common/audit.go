@@ -0,0 +1,84 @@
+package common
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const auditRedactedValue = "******"
+
+// 字段名以这些后缀结尾时视为敏感信息，审计日志中只记录是否发生变化
+var auditSensitiveSuffixes = []string{"key", "secret", "token", "password"}
+
+func isAuditSensitiveField(field string) bool {
+	field = strings.ToLower(field)
+	for _, suffix := range auditSensitiveSuffixes {
+		if strings.HasSuffix(field, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func auditFields(value any) map[string]any {
+	fields := make(map[string]any)
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return fields
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	if json.Unmarshal(data, &fields) != nil {
+		// 非对象类型的值作为一个整体比较
+		var raw any
+		_ = json.Unmarshal(data, &raw)
+		fields = map[string]any{"value": raw}
+	}
+	return fields
+}
+
+// AuditDiff 比较操作前后的对象，返回发生变化的字段及其前后值组成的 JSON，敏感字段会被脱敏
+func AuditDiff(before any, after any) string {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+	names := make([]string, 0, len(beforeFields)+len(afterFields))
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	diff := make(map[string]map[string]any)
+	for _, name := range names {
+		beforeValue, afterValue := beforeFields[name], afterFields[name]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		if isAuditSensitiveField(name) {
+			if beforeValue != nil && beforeValue != "" {
+				beforeValue = auditRedactedValue
+			}
+			if afterValue != nil && afterValue != "" {
+				afterValue = auditRedactedValue
+			}
+		}
+		diff[name] = map[string]any{
+			"before": beforeValue,
+			"after":  afterValue,
+		}
+	}
+	if len(diff) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
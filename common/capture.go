@@ -0,0 +1,161 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// CaptureConfig 请求与响应内容采集配置，默认关闭
+// 请求的用户、令牌或首次分配的渠道命中任一列表时，按 SampleRate 抽样采集；三个列表都为空时不采集任何请求。
+// 采集内容先按 RedactPatterns 脱敏，再按 MaxBodySize 截断，保存 RetentionDays 天后自动删除。
+type CaptureConfig struct {
+	Enabled        bool     `json:"enabled"`
+	UserIds        []int    `json:"user_ids"`
+	TokenIds       []int    `json:"token_ids"`
+	ChannelIds     []int    `json:"channel_ids"`
+	SampleRate     float64  `json:"sample_rate"`
+	MaxBodySize    int      `json:"max_body_size"` // 字节，请求与响应分别计算
+	RetentionDays  int      `json:"retention_days"`
+	RedactPatterns []string `json:"redact_patterns"`
+
+	redactRegexps []*regexp.Regexp
+}
+
+const captureRedactedValue = "[REDACTED]"
+
+// 默认脱敏邮箱、API 密钥、Bearer 令牌、手机号和身份证号
+var defaultCaptureRedactPatterns = []string{
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	`sk-[A-Za-z0-9_-]{16,}`,
+	`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`,
+	`\b1[3-9]\d{9}\b`,
+	`\b\d{17}[\dXx]\b`,
+}
+
+var captureConfig = mustParseCaptureConfig("")
+var captureConfigLock sync.RWMutex
+
+func defaultCaptureConfig() *CaptureConfig {
+	return &CaptureConfig{
+		UserIds:        []int{},
+		TokenIds:       []int{},
+		ChannelIds:     []int{},
+		SampleRate:     1,
+		MaxBodySize:    64 * 1024,
+		RetentionDays:  7,
+		RedactPatterns: defaultCaptureRedactPatterns,
+	}
+}
+
+func mustParseCaptureConfig(jsonStr string) *CaptureConfig {
+	config, err := parseCaptureConfig(jsonStr)
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
+
+func CaptureConfig2JSONString() string {
+	captureConfigLock.RLock()
+	defer captureConfigLock.RUnlock()
+	jsonBytes, err := json.Marshal(captureConfig)
+	if err != nil {
+		SysError("error marshalling capture config: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCaptureConfigByJSONString(jsonStr string) error {
+	config, err := parseCaptureConfig(jsonStr)
+	if err != nil {
+		return err
+	}
+	captureConfigLock.Lock()
+	captureConfig = config
+	captureConfigLock.Unlock()
+	return nil
+}
+
+func CheckCaptureConfig(jsonStr string) error {
+	_, err := parseCaptureConfig(jsonStr)
+	return err
+}
+
+// 未填写的字段使用默认值
+func parseCaptureConfig(jsonStr string) (*CaptureConfig, error) {
+	config := defaultCaptureConfig()
+	if strings.TrimSpace(jsonStr) != "" {
+		err := json.Unmarshal([]byte(jsonStr), config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		return nil, errors.New("采样率必须大于 0 且不超过 1")
+	}
+	if config.MaxBodySize <= 0 {
+		return nil, errors.New("最大采集长度必须大于 0")
+	}
+	if config.RetentionDays <= 0 {
+		return nil, errors.New("保留天数必须大于 0")
+	}
+	for _, pattern := range config.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("脱敏规则 %s 错误: %s", pattern, err.Error())
+		}
+		config.redactRegexps = append(config.redactRegexps, re)
+	}
+	return config, nil
+}
+
+func GetCaptureConfig() *CaptureConfig {
+	captureConfigLock.RLock()
+	defer captureConfigLock.RUnlock()
+	return captureConfig
+}
+
+func containsId(ids []int, id int) bool {
+	if id == 0 {
+		return false
+	}
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldCapture 判断是否采集本次请求
+func (config *CaptureConfig) ShouldCapture(userId int, tokenId int, channelId int) bool {
+	if !config.Enabled {
+		return false
+	}
+	if !containsId(config.UserIds, userId) && !containsId(config.TokenIds, tokenId) && !containsId(config.ChannelIds, channelId) {
+		return false
+	}
+	return config.SampleRate >= 1 || rand.Float64() < config.SampleRate
+}
+
+// Redact 脱敏并截断采集内容，返回内容是否被截断
+func (config *CaptureConfig) Redact(body string) (string, bool) {
+	for _, re := range config.redactRegexps {
+		body = re.ReplaceAllString(body, captureRedactedValue)
+	}
+	if len(body) <= config.MaxBodySize {
+		return body, false
+	}
+	// 避免截断在多字节字符中间
+	cut := config.MaxBodySize
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return body[:cut], true
+}
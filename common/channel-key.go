@@ -0,0 +1,255 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// 渠道密钥采用信封加密：每个密钥使用随机生成的数据密钥加密，数据密钥再由主密钥派生的密钥加密后一同保存
+// 密文格式为 enc:v2:<主密钥标识>:<盐>:<加密后的数据密钥>:<加密后的渠道密钥>
+// 加密数据密钥的密钥由 HKDF-SHA256 从主密钥与每个密文独立的随机盐派生，版本号与盐作为附加数据参与认证。
+// v1 格式 enc:v1:<主密钥标识>:<加密后的数据密钥>:<加密后的渠道密钥> 直接以 sha256(主密钥) 加密数据密钥，
+// 仍可解密，并会在启动时被重新加密为 v2。
+const (
+	channelKeyEncryptedPrefix   = "enc:"
+	channelKeyEncryptedPrefixV1 = "enc:v1:"
+	channelKeyEncryptedPrefixV2 = "enc:v2:"
+	channelKeyVersion           = 2
+	channelKeySaltSize          = 16
+	channelKeyHKDFInfo          = "one-api channel key wrapping"
+)
+
+type channelMasterKey struct {
+	id        string
+	secret    []byte
+	legacyKey []byte // v1 使用的 sha256(主密钥)
+}
+
+var (
+	currentChannelMasterKey *channelMasterKey
+	channelMasterKeys       = make(map[string]*channelMasterKey)
+)
+
+// InitChannelMasterKey 从 CHANNEL_MASTER_KEY 或 CHANNEL_MASTER_KEY_FILE 读取主密钥
+// 轮换主密钥时将旧密钥以逗号分隔放入 CHANNEL_MASTER_KEY_PREVIOUS，旧密文仍可解密并会被重新加密
+func InitChannelMasterKey() error {
+	currentChannelMasterKey = nil
+	channelMasterKeys = make(map[string]*channelMasterKey)
+	secret := os.Getenv("CHANNEL_MASTER_KEY")
+	if path := os.Getenv("CHANNEL_MASTER_KEY_FILE"); secret == "" && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read channel master key file: %w", err)
+		}
+		secret = strings.TrimSpace(string(content))
+	}
+	if secret == "" {
+		SysLog("CHANNEL_MASTER_KEY not set, channel keys will be stored in plain text")
+		return nil
+	}
+	currentChannelMasterKey = newChannelMasterKey(secret)
+	channelMasterKeys[currentChannelMasterKey.id] = currentChannelMasterKey
+	for _, previous := range strings.Split(os.Getenv("CHANNEL_MASTER_KEY_PREVIOUS"), ",") {
+		previous = strings.TrimSpace(previous)
+		if previous == "" {
+			continue
+		}
+		masterKey := newChannelMasterKey(previous)
+		channelMasterKeys[masterKey.id] = masterKey
+	}
+	SysLog(fmt.Sprintf("channel key encryption enabled, master key id %s", currentChannelMasterKey.id))
+	return nil
+}
+
+// 主密钥标识沿用 v1 的计算方式，升级后旧密文仍能找到对应的主密钥
+func newChannelMasterKey(secret string) *channelMasterKey {
+	key := sha256.Sum256([]byte(secret))
+	id := sha256.Sum256(append([]byte("channel-master-key:"), key[:]...))
+	return &channelMasterKey{
+		id:        hex.EncodeToString(id[:4]),
+		secret:    []byte(secret),
+		legacyKey: key[:],
+	}
+}
+
+// deriveWrappingKey 由主密钥与盐派生加密数据密钥的 AES-256 密钥
+func (masterKey *channelMasterKey) deriveWrappingKey(salt []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, masterKey.secret, salt, []byte(channelKeyHKDFInfo)), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// 数据密钥的附加认证数据，防止密文被替换到其他版本或其他盐下
+func channelKeyAdditionalData(masterKeyId string, salt []byte) []byte {
+	return append([]byte{channelKeyVersion}, append([]byte(masterKeyId), salt...)...)
+}
+
+func ChannelKeyEncryptionEnabled() bool {
+	return currentChannelMasterKey != nil
+}
+
+func IsChannelKeyEncrypted(value string) bool {
+	return strings.HasPrefix(value, channelKeyEncryptedPrefix)
+}
+
+// ChannelKeyNeedsReencryption 明文、v1 格式或由旧主密钥加密的值需要重新加密
+func ChannelKeyNeedsReencryption(value string) bool {
+	if !ChannelKeyEncryptionEnabled() || value == "" {
+		return false
+	}
+	if !strings.HasPrefix(value, channelKeyEncryptedPrefixV2) {
+		return true
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, channelKeyEncryptedPrefixV2), ":", 2)
+	return parts[0] != currentChannelMasterKey.id
+}
+
+// EncryptChannelKey 未配置主密钥时原样返回
+func EncryptChannelKey(plain string) (string, error) {
+	if !ChannelKeyEncryptionEnabled() || plain == "" || IsChannelKeyEncrypted(plain) {
+		return plain, nil
+	}
+	salt := make([]byte, channelKeySaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	wrappingKey, err := currentChannelMasterKey.deriveWrappingKey(salt)
+	if err != nil {
+		return "", err
+	}
+	dataKey := make([]byte, 32)
+	_, err = rand.Read(dataKey)
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := aesGCMSeal(wrappingKey, dataKey, channelKeyAdditionalData(currentChannelMasterKey.id, salt))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := aesGCMSeal(dataKey, []byte(plain), nil)
+	if err != nil {
+		return "", err
+	}
+	return channelKeyEncryptedPrefixV2 + currentChannelMasterKey.id + ":" +
+		base64.RawStdEncoding.EncodeToString(salt) + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptChannelKey 非密文的值原样返回，兼容尚未加密的旧数据
+func DecryptChannelKey(value string) (string, error) {
+	if !IsChannelKeyEncrypted(value) {
+		return value, nil
+	}
+	var fields []string
+	switch {
+	case strings.HasPrefix(value, channelKeyEncryptedPrefixV2):
+		fields = strings.Split(strings.TrimPrefix(value, channelKeyEncryptedPrefixV2), ":")
+		if len(fields) != 4 {
+			return "", errors.New("invalid encrypted channel key")
+		}
+	case strings.HasPrefix(value, channelKeyEncryptedPrefixV1):
+		fields = strings.Split(strings.TrimPrefix(value, channelKeyEncryptedPrefixV1), ":")
+		if len(fields) != 3 {
+			return "", errors.New("invalid encrypted channel key")
+		}
+	default:
+		return "", errors.New("unsupported encrypted channel key version")
+	}
+	masterKey, ok := channelMasterKeys[fields[0]]
+	if !ok {
+		return "", fmt.Errorf("channel master key %s not configured", fields[0])
+	}
+	decoded := make([][]byte, len(fields)-1)
+	for i, field := range fields[1:] {
+		b, err := base64.RawStdEncoding.DecodeString(field)
+		if err != nil {
+			return "", err
+		}
+		decoded[i] = b
+	}
+	var dataKey []byte
+	var err error
+	if len(decoded) == 3 {
+		salt := decoded[0]
+		wrappingKey, err := masterKey.deriveWrappingKey(salt)
+		if err != nil {
+			return "", err
+		}
+		dataKey, err = aesGCMOpen(wrappingKey, decoded[1], channelKeyAdditionalData(masterKey.id, salt))
+		if err != nil {
+			return "", err
+		}
+	} else {
+		dataKey, err = aesGCMOpen(masterKey.legacyKey, decoded[0], nil)
+		if err != nil {
+			return "", err
+		}
+	}
+	plain, err := aesGCMOpen(dataKey, decoded[len(decoded)-1], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// MaskChannelKey 只保留首尾少量字符用于辨认，多个密钥按行分别处理
+func MaskChannelKey(key string) string {
+	lines := strings.Split(key, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) <= 8 {
+			lines[i] = strings.Repeat("*", len(line))
+			continue
+		}
+		lines[i] = line[:4] + "****" + line[len(line)-4:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func aesGCMSeal(key []byte, plain []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, additionalData), nil
+}
+
+func aesGCMOpen(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additionalData)
+}
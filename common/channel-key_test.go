@@ -0,0 +1,174 @@
+package common
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func setChannelMasterKeys(t *testing.T, current string, previous string) {
+	t.Helper()
+	t.Setenv("CHANNEL_MASTER_KEY", current)
+	t.Setenv("CHANNEL_MASTER_KEY_FILE", "")
+	t.Setenv("CHANNEL_MASTER_KEY_PREVIOUS", previous)
+	if err := InitChannelMasterKey(); err != nil {
+		t.Fatalf("init channel master key: %v", err)
+	}
+	t.Cleanup(func() {
+		currentChannelMasterKey = nil
+		channelMasterKeys = make(map[string]*channelMasterKey)
+	})
+}
+
+// 按 v1 格式加密，模拟升级前写入数据库的密文
+func encryptChannelKeyV1(t *testing.T, masterKey *channelMasterKey, plain string) string {
+	t.Helper()
+	dataKey := make([]byte, 32)
+	wrappedKey, err := aesGCMSeal(masterKey.legacyKey, dataKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := aesGCMSeal(dataKey, []byte(plain), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return channelKeyEncryptedPrefixV1 + masterKey.id + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+func TestChannelKeyRoundTrip(t *testing.T) {
+	setChannelMasterKeys(t, "current-secret", "")
+	tests := []string{"sk-test", "AKID|secret|us-east-1", "{\"type\":\"service_account\"}", "多行\n密钥"}
+	for _, plain := range tests {
+		encrypted, err := EncryptChannelKey(plain)
+		if err != nil {
+			t.Fatalf("encrypt %q: %v", plain, err)
+		}
+		if !strings.HasPrefix(encrypted, channelKeyEncryptedPrefixV2) || strings.Contains(encrypted, plain) {
+			t.Fatalf("unexpected ciphertext %q", encrypted)
+		}
+		if ChannelKeyNeedsReencryption(encrypted) {
+			t.Errorf("fresh ciphertext should not need re-encryption")
+		}
+		decrypted, err := DecryptChannelKey(encrypted)
+		if err != nil || decrypted != plain {
+			t.Errorf("DecryptChannelKey = %q, %v, want %q", decrypted, err, plain)
+		}
+	}
+	first, _ := EncryptChannelKey("sk-test")
+	second, _ := EncryptChannelKey("sk-test")
+	if first == second {
+		t.Errorf("ciphertexts of the same key should differ")
+	}
+}
+
+func TestChannelKeyRotation(t *testing.T) {
+	setChannelMasterKeys(t, "old-secret", "")
+	oldCiphertext, err := EncryptChannelKey("sk-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyCiphertext := encryptChannelKeyV1(t, currentChannelMasterKey, "sk-legacy")
+
+	setChannelMasterKeys(t, "new-secret", " other-secret , old-secret ")
+	tests := []struct {
+		name       string
+		ciphertext string
+		plain      string
+	}{
+		{"v2 with previous key", oldCiphertext, "sk-rotate"},
+		{"v1 with previous key", legacyCiphertext, "sk-legacy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !ChannelKeyNeedsReencryption(tt.ciphertext) {
+				t.Errorf("ciphertext under previous key should need re-encryption")
+			}
+			plain, err := DecryptChannelKey(tt.ciphertext)
+			if err != nil || plain != tt.plain {
+				t.Fatalf("DecryptChannelKey = %q, %v, want %q", plain, err, tt.plain)
+			}
+			reencrypted, err := EncryptChannelKey(plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ChannelKeyNeedsReencryption(reencrypted) {
+				t.Errorf("re-encrypted key should use the current master key")
+			}
+		})
+	}
+
+	setChannelMasterKeys(t, "new-secret", "")
+	if _, err = DecryptChannelKey(oldCiphertext); err == nil {
+		t.Errorf("decrypting without the previous key should fail")
+	}
+}
+
+func TestChannelKeyV1UnderCurrentKey(t *testing.T) {
+	setChannelMasterKeys(t, "current-secret", "")
+	ciphertext := encryptChannelKeyV1(t, currentChannelMasterKey, "sk-v1")
+	if !ChannelKeyNeedsReencryption(ciphertext) {
+		t.Errorf("v1 ciphertext should be upgraded to v2")
+	}
+	plain, err := DecryptChannelKey(ciphertext)
+	if err != nil || plain != "sk-v1" {
+		t.Errorf("DecryptChannelKey = %q, %v", plain, err)
+	}
+}
+
+func TestChannelKeyPlaintextFallback(t *testing.T) {
+	setChannelMasterKeys(t, "", "")
+	if ChannelKeyEncryptionEnabled() {
+		t.Fatal("encryption should be disabled without a master key")
+	}
+	encrypted, err := EncryptChannelKey("sk-plain")
+	if err != nil || encrypted != "sk-plain" {
+		t.Errorf("EncryptChannelKey = %q, %v, want plain text", encrypted, err)
+	}
+	if ChannelKeyNeedsReencryption("sk-plain") {
+		t.Errorf("plain text should not need re-encryption without a master key")
+	}
+
+	setChannelMasterKeys(t, "current-secret", "")
+	tests := []string{"sk-plain", ""}
+	for _, value := range tests {
+		plain, err := DecryptChannelKey(value)
+		if err != nil || plain != value {
+			t.Errorf("DecryptChannelKey(%q) = %q, %v", value, plain, err)
+		}
+	}
+	if !ChannelKeyNeedsReencryption("sk-plain") {
+		t.Errorf("plain text should be encrypted once a master key is set")
+	}
+	if ChannelKeyNeedsReencryption("") {
+		t.Errorf("empty key should not need re-encryption")
+	}
+}
+
+func TestChannelKeyTampered(t *testing.T) {
+	setChannelMasterKeys(t, "current-secret", "")
+	encrypted, err := EncryptChannelKey("sk-tamper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.TrimPrefix(encrypted, channelKeyEncryptedPrefixV2), ":")
+	otherSalt := base64.RawStdEncoding.EncodeToString(make([]byte, channelKeySaltSize))
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"unknown master key", channelKeyEncryptedPrefixV2 + "00000000:" + strings.Join(fields[1:], ":")},
+		{"replaced salt", channelKeyEncryptedPrefixV2 + fields[0] + ":" + otherSalt + ":" + fields[2] + ":" + fields[3]},
+		{"missing field", channelKeyEncryptedPrefixV2 + strings.Join(fields[:3], ":")},
+		{"invalid base64", channelKeyEncryptedPrefixV2 + fields[0] + ":" + fields[1] + ":" + fields[2] + ":!!"},
+		{"unsupported version", "enc:v9:" + strings.Join(fields, ":")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecryptChannelKey(tt.value); err == nil {
+				t.Errorf("DecryptChannelKey should fail")
+			}
+		})
+	}
+}
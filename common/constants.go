@@ -17,6 +17,7 @@ var StripePriceId = ""
 var PaymentEnabled = false
 var StripeUnitPrice = 8.0
 var MinTopUp = 5
+var RefundDisableUserEnabled = false // 退款或争议时是否禁用用户
 
 var StartTime = time.Now().Unix() // unit: second
 var Version = "v0.0.0"            // this hard coding will be replaced automatically when building, no need to manually change
@@ -36,6 +37,7 @@ var TaskEnabled = true
 var DataExportEnabled = true
 var DataExportInterval = 5         // unit: minute
 var DataExportDefaultTime = "hour" // unit: minute
+var AnalyticsEnabled = true        // 渠道与模型请求统计，见 model.AnalyticsData
 var DefaultCollapseSidebar = false // default value of collapse sidebar
 
 // Any options with "Secret", "Token" in its key won't be return by GetOptions
@@ -58,6 +60,7 @@ var TelegramOAuthEnabled = false
 var TurnstileCheckEnabled = false
 var RegisterEnabled = true
 var UserSelfDeletionEnabled = false
+var AdminTwoFactorEnabled = false // 是否要求管理员启用两步验证
 
 var EmailDomainRestrictionEnabled = false // 是否启用邮箱域名限制
 var EmailAliasRestrictionEnabled = false  // 是否启用邮箱别名限制
@@ -125,6 +128,17 @@ var SyncFrequency = GetEnvOrDefault("SYNC_FREQUENCY", 60) // unit is second
 var BatchUpdateEnabled = false
 var BatchUpdateInterval = GetEnvOrDefault("BATCH_UPDATE_INTERVAL", 5)
 
+// 消费日志异步批量写入，见 model.InitConsumeLogWriter
+var LogBatchEnabled = false
+var LogBatchSize = GetEnvOrDefault("LOG_BATCH_SIZE", 200)
+var LogBatchInterval = GetEnvOrDefault("LOG_BATCH_INTERVAL", 1) // unit is second
+var LogBatchQueueSize = GetEnvOrDefault("LOG_BATCH_QUEUE_SIZE", 10000)
+var LogBatchSpillFile = GetEnvOrDefaultString("LOG_BATCH_SPILL_FILE", "")
+
+// 用量导出中费用列的币种与汇率，费用 = 额度 / QuotaPerUnit * 汇率，默认按美元导出
+var UsageExportCurrency = GetEnvOrDefaultString("USAGE_EXPORT_CURRENCY", "USD")
+var UsageExportExchangeRate = GetEnvOrDefaultFloat64("USAGE_EXPORT_EXCHANGE_RATE", 1)
+
 var RelayTimeout = GetEnvOrDefault("RELAY_TIMEOUT", 0) // unit is second
 
 var GeminiSafetySetting = GetEnvOrDefaultString("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
@@ -176,6 +190,17 @@ const (
 	UserStatusDisabled = 2 // also don't use 0
 )
 
+const (
+	OrganizationStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OrganizationStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	OrganizationRoleMember = 1
+	OrganizationRoleAdmin  = 10
+	OrganizationRoleOwner  = 100
+)
+
 const (
 	TokenStatusEnabled   = 1 // don't use 0, 0 is the default value!
 	TokenStatusDisabled  = 2 // also don't use 0
@@ -197,9 +222,11 @@ const (
 )
 
 const (
-	TopUpStatusPending = "pending"
-	TopUpStatusSuccess = "success"
-	TopUpStatusExpired = "expired"
+	TopUpStatusPending  = "pending"
+	TopUpStatusSuccess  = "success"
+	TopUpStatusExpired  = "expired"
+	TopUpStatusRefunded = "refunded"
+	TopUpStatusDisputed = "disputed"
 )
 
 const (
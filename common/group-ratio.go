@@ -2,6 +2,7 @@ package common
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 var GroupRatio = map[string]float64{
@@ -31,3 +32,58 @@ func GetGroupRatio(name string) float64 {
 	}
 	return ratio
 }
+
+// GroupModelRatio 分组 × 模型的倍率覆盖表，优先于 GroupRatio 生效
+// 例如 {"research": {"text-embedding-3-small": 0.5}} 表示 research 分组调用该模型时使用 0.5 倍率
+var GroupModelRatio = map[string]map[string]float64{}
+
+func GroupModelRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(GroupModelRatio)
+	if err != nil {
+		SysError("error marshalling group model ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupModelRatioByJSONString(jsonStr string) error {
+	groupModelRatio := make(map[string]map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &groupModelRatio)
+	if err != nil {
+		return err
+	}
+	GroupModelRatio = groupModelRatio
+	return nil
+}
+
+// CheckGroupModelRatio 校验分组模型倍率配置，分组必须已在 GroupRatio 中定义且倍率不能为负数
+func CheckGroupModelRatio(jsonStr string) error {
+	groupModelRatio := make(map[string]map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &groupModelRatio)
+	if err != nil {
+		return err
+	}
+	for group, modelRatios := range groupModelRatio {
+		if _, ok := GroupRatio[group]; !ok {
+			return fmt.Errorf("分组 %s 不存在", group)
+		}
+		for model, ratio := range modelRatios {
+			if model == "" {
+				return fmt.Errorf("分组 %s 中存在空的模型名称", group)
+			}
+			if ratio < 0 {
+				return fmt.Errorf("分组 %s 模型 %s 的倍率不能为负数", group, model)
+			}
+		}
+	}
+	return nil
+}
+
+// GetGroupModelRatio 获取分组在指定模型上的倍率，未配置覆盖时回退到分组倍率
+func GetGroupModelRatio(group string, model string) float64 {
+	if modelRatios, ok := GroupModelRatio[group]; ok {
+		if ratio, ok := modelRatios[model]; ok {
+			return ratio
+		}
+	}
+	return GetGroupRatio(group)
+}
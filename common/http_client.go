@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"syscall"
+	"time"
 )
 
 func GetImageHttpClient() (*http.Client, error) {
@@ -46,3 +48,85 @@ func GetProxiedHttpClient(proxyUrl string) (*http.Client, error) {
 		return nil, errors.New("unsupported proxy type: " + proxyUrl)
 	}
 }
+
+// 私有、回环、链路本地（含 169.254.169.254 元数据地址）等内网地址
+var nonPublicIPNets = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"64:ff9b::/96",
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// IsPublicIP 判断是否为公网地址，用于阻止向内网发起用户指定地址的请求
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, ipNet := range nonPublicIPNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidatePublicUrl 校验用户填写的回调地址，只允许解析到公网地址的 http/https 地址
+func ValidatePublicUrl(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("无效的地址")
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return errors.New("无法解析地址: " + u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return errors.New("不允许访问内网地址")
+		}
+	}
+	return nil
+}
+
+// 在建立连接时检查实际连接的地址，避免 DNS 重绑定绕过 ValidatePublicUrl 的校验，重定向同样受限。
+// 全局只创建一次，以便复用连接
+var publicHttpClient = func() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicIP(net.ParseIP(host)) {
+				return errors.New("不允许访问内网地址: " + host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			// 不走环境变量中的代理，否则连接检查的是代理地址
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}()
+
+// GetPublicHttpClient 返回只能连接公网地址的客户端
+func GetPublicHttpClient() *http.Client {
+	return publicHttpClient
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.public {
+				t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.public)
+			}
+		})
+	}
+}
+
+func TestValidatePublicUrl(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"ftp://8.8.8.8/hook", false},
+		{"http:///hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[::1]/hook", false},
+		{"https://8.8.8.8/hook", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidatePublicUrl(context.Background(), tt.url)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidatePublicUrl(%s) error = %v, want valid %v", tt.url, err, tt.valid)
+			}
+		})
+	}
+}
+
+// 即使地址通过了校验（例如 DNS 重绑定），连接内网地址时也会失败
+func TestPublicHttpClientRejectsPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := GetPublicHttpClient().Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("request to %s should be rejected", server.URL)
+	}
+}
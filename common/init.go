@@ -22,7 +22,9 @@ func printHelp() {
 	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
 }
 
-func init() {
+// InitEnv 解析命令行参数与环境变量，需在 main 中最先调用；
+// 不放在 init 中，否则 go test 传入的测试参数会被当作未知参数而退出
+func InitEnv() {
 	flag.Parse()
 
 	if *PrintVersion {
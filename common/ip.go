@@ -0,0 +1,55 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseIpAllowList 解析以逗号或换行分隔的 IP / CIDR 列表，空列表表示不限制
+func ParseIpAllowList(allowList string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0)
+	for _, item := range strings.FieldsFunc(allowList, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' '
+	}) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP 地址 %s", item)
+			}
+			if ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 IP 段 %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// IsIpAllowed 判断 ip 是否在允许列表内，列表为空时总是允许
+func IsIpAllowed(ip string, allowList string) bool {
+	nets, err := ParseIpAllowList(allowList)
+	if err != nil {
+		SysError("invalid ip allow list: " + err.Error())
+		return false
+	}
+	if len(nets) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package common
+
+import "testing"
+
+func TestParseIpAllowList(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowList string
+		count     int
+		wantErr   bool
+	}{
+		{"empty", "", 0, false},
+		{"separators", "1.2.3.4, 10.0.0.0/8\n2001:db8::/32\r\n::1", 4, false},
+		{"invalid ip", "1.2.3", 0, true},
+		{"invalid cidr", "10.0.0.0/33", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets, err := ParseIpAllowList(tt.allowList)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIpAllowList error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(nets) != tt.count {
+				t.Errorf("ParseIpAllowList returned %d nets, want %d", len(nets), tt.count)
+			}
+		})
+	}
+}
+
+func TestIsIpAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		allowList string
+		allowed   bool
+	}{
+		{"empty list allows all", "8.8.8.8", "", true},
+		{"exact ipv4", "1.2.3.4", "1.2.3.4", true},
+		{"other ipv4", "1.2.3.5", "1.2.3.4", false},
+		{"inside cidr", "10.20.30.40", "10.0.0.0/8", true},
+		{"cidr lower bound", "192.168.1.0", "192.168.1.0/24", true},
+		{"cidr upper bound", "192.168.1.255", "192.168.1.0/24", true},
+		{"outside cidr", "192.168.2.1", "192.168.1.0/24", false},
+		{"second entry", "172.16.5.1", "10.0.0.0/8,172.16.0.0/12", true},
+		{"exact ipv6", "::1", "::1", true},
+		{"inside ipv6 cidr", "2001:db8::1", "2001:db8::/32", true},
+		{"outside ipv6 cidr", "2001:db9::1", "2001:db8::/32", false},
+		{"ipv4 mapped ipv6", "::ffff:10.1.1.1", "10.0.0.0/8", true},
+		{"invalid ip", "not-an-ip", "10.0.0.0/8", false},
+		{"invalid list denies", "10.1.1.1", "10.0.0.0/8,bad", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsIpAllowed(tt.ip, tt.allowList); got != tt.allowed {
+				t.Errorf("IsIpAllowed(%s, %q) = %v, want %v", tt.ip, tt.allowList, got, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 日志类型名称，与 model.LogType* 对应
+var LogTypeNames = map[string]int{
+	"topup":   1,
+	"consume": 2,
+	"manage":  3,
+	"system":  4,
+	"error":   5,
+}
+
+// LogRetentionConfig 日志保留策略，默认关闭
+// RetentionDays 按日志类型设置保留天数，未设置或为 0 的类型永久保留。
+// 主节点每小时将过期的整天日志按类型与日期导出为 gzip 压缩的 JSONL 文件（ArchiveEnabled 为 false 时不导出），再分批删除。
+type LogRetentionConfig struct {
+	Enabled        bool           `json:"enabled"`
+	RetentionDays  map[string]int `json:"retention_days"`
+	ArchiveEnabled bool           `json:"archive_enabled"`
+}
+
+// 归档文件目录，默认为日志目录下的 archive，多节点部署时只有主节点写入
+var LogArchiveDir = GetEnvOrDefaultString("LOG_ARCHIVE_DIR", "")
+
+var logRetentionConfig = defaultLogRetentionConfig()
+var logRetentionConfigLock sync.RWMutex
+
+func defaultLogRetentionConfig() *LogRetentionConfig {
+	return &LogRetentionConfig{
+		RetentionDays: map[string]int{
+			"consume": 90,
+			"error":   30,
+		},
+		ArchiveEnabled: true,
+	}
+}
+
+func GetLogRetentionConfig() *LogRetentionConfig {
+	logRetentionConfigLock.RLock()
+	defer logRetentionConfigLock.RUnlock()
+	return logRetentionConfig
+}
+
+func LogRetentionConfig2JSONString() string {
+	logRetentionConfigLock.RLock()
+	defer logRetentionConfigLock.RUnlock()
+	jsonBytes, err := json.Marshal(logRetentionConfig)
+	if err != nil {
+		SysError("error marshalling log retention config: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateLogRetentionConfigByJSONString(jsonStr string) error {
+	config, err := parseLogRetentionConfig(jsonStr)
+	if err != nil {
+		return err
+	}
+	logRetentionConfigLock.Lock()
+	logRetentionConfig = config
+	logRetentionConfigLock.Unlock()
+	return nil
+}
+
+func CheckLogRetentionConfig(jsonStr string) error {
+	_, err := parseLogRetentionConfig(jsonStr)
+	return err
+}
+
+// 未填写的字段使用默认值，RetentionDays 与默认值合并
+func parseLogRetentionConfig(jsonStr string) (*LogRetentionConfig, error) {
+	config := defaultLogRetentionConfig()
+	if strings.TrimSpace(jsonStr) != "" {
+		err := json.Unmarshal([]byte(jsonStr), config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.RetentionDays == nil {
+		config.RetentionDays = map[string]int{}
+	}
+	for name, days := range config.RetentionDays {
+		if _, ok := LogTypeNames[name]; !ok {
+			return nil, fmt.Errorf("日志类型 %s 不存在", name)
+		}
+		if days < 0 {
+			return nil, errors.New("保留天数不能为负数")
+		}
+	}
+	return config, nil
+}
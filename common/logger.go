@@ -4,90 +4,168 @@ import (
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"gopkg.in/natefinch/lumberjack.v2"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"sync"
-	"time"
+	"strings"
+	"sync/atomic"
 )
 
-const (
-	loggerINFO  = "INFO"
-	loggerWarn  = "WARN"
-	loggerError = "ERR"
+// LOG_FORMAT 可选 text（logfmt，默认）或 json
+var LogFormat = strings.ToLower(GetEnvOrDefaultString("LOG_FORMAT", "text"))
+
+// 日志文件按大小切分，旧文件超过保留天数或数量后删除，切分出的文件会被 gzip 压缩
+var (
+	LogMaxSize    = GetEnvOrDefault("LOG_MAX_SIZE", 100) // MB
+	LogMaxAge     = GetEnvOrDefault("LOG_MAX_AGE", 7)    // days
+	LogMaxBackups = GetEnvOrDefault("LOG_MAX_BACKUPS", 0)
+)
+
+var logLevel = new(slog.LevelVar)
+
+// LogLevel 可通过 LOG_LEVEL 环境变量设置初始值，运行时可在系统设置中修改
+var LogLevel = "info"
+
+// 普通日志写入 gin.DefaultWriter，警告及错误写入 gin.DefaultErrorWriter
+var (
+	infoLogger  atomic.Pointer[slog.Logger]
+	errorLogger atomic.Pointer[slog.Logger]
 )
 
-const maxLogCount = 1000000
+// 自动从请求上下文中提取的字段，上下文为 *gin.Context 时可取到鉴权与分发阶段设置的值
+var logContextKeys = []struct {
+	key  string
+	attr string
+}{
+	{RequestIdKey, "request_id"},
+	{"id", "user_id"},
+	{"token_id", "token_id"},
+	{"channel_id", "channel_id"},
+	{"original_model", "model"},
+}
+
+func init() {
+	level := GetEnvOrDefaultString("LOG_LEVEL", "")
+	if level == "" && DebugEnabled {
+		level = "debug"
+	}
+	if level != "" {
+		if err := SetLogLevel(level); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+	resetLoggers()
+}
+
+func newLogger(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
 
-var logCount int
-var setupLogLock sync.Mutex
-var setupLogWorking bool
+func resetLoggers() {
+	infoLogger.Store(newLogger(gin.DefaultWriter))
+	errorLogger.Store(newLogger(gin.DefaultErrorWriter))
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("无效的日志级别：%s，可选 debug、info、warn、error", level)
+	}
+	return l, nil
+}
+
+func CheckLogLevel(level string) error {
+	_, err := parseLogLevel(level)
+	return err
+}
+
+// SetLogLevel 修改日志级别，可选 debug、info、warn、error
+func SetLogLevel(level string) error {
+	l, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(l)
+	LogLevel = strings.ToLower(l.String())
+	return nil
+}
 
 func SetupLogger() {
 	if *LogDir != "" {
-		ok := setupLogLock.TryLock()
-		if !ok {
-			log.Println("setup log is already working")
-			return
-		}
-		defer func() {
-			setupLogLock.Unlock()
-			setupLogWorking = false
-		}()
-		logPath := filepath.Join(*LogDir, fmt.Sprintf("oneapi-%s.log", time.Now().Format("20060102")))
-		fd, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Fatal("failed to open log file")
+		fd := &lumberjack.Logger{
+			Filename:   filepath.Join(*LogDir, "oneapi.log"),
+			MaxSize:    LogMaxSize,
+			MaxAge:     LogMaxAge,
+			MaxBackups: LogMaxBackups,
+			LocalTime:  true,
+			Compress:   true,
 		}
 		gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
 		gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
 	}
+	resetLoggers()
+}
+
+// LogAttrs 返回上下文中的请求关联字段
+func LogAttrs(ctx context.Context) []any {
+	if ctx == nil {
+		return nil
+	}
+	attrs := make([]any, 0, len(logContextKeys))
+	for _, k := range logContextKeys {
+		v := ctx.Value(k.key)
+		if v == nil || v == "" || v == 0 {
+			continue
+		}
+		attrs = append(attrs, slog.Any(k.attr, v))
+	}
+	return attrs
 }
 
 func SysLog(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	infoLogger.Load().Info(s, "source", "sys")
 }
 
 func SysError(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	errorLogger.Load().Error(s, "source", "sys")
+}
+
+func LogDebug(ctx context.Context, msg string) {
+	LogWith(ctx, slog.LevelDebug, msg)
 }
 
 func LogInfo(ctx context.Context, msg string) {
-	logHelper(ctx, loggerINFO, msg)
+	LogWith(ctx, slog.LevelInfo, msg)
 }
 
 func LogWarn(ctx context.Context, msg string) {
-	logHelper(ctx, loggerWarn, msg)
+	LogWith(ctx, slog.LevelWarn, msg)
 }
 
 func LogError(ctx context.Context, msg string) {
-	logHelper(ctx, loggerError, msg)
+	LogWith(ctx, slog.LevelError, msg)
 }
 
-func logHelper(ctx context.Context, level string, msg string) {
-	writer := gin.DefaultErrorWriter
-	if level == loggerINFO {
-		writer = gin.DefaultWriter
+// LogWith 以指定级别输出日志，附带上下文中的请求关联字段及额外字段
+func LogWith(ctx context.Context, level slog.Level, msg string, args ...any) {
+	logger := infoLogger.Load()
+	if level >= slog.LevelWarn {
+		logger = errorLogger.Load()
 	}
-	id := ctx.Value(RequestIdKey)
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
-	logCount++ // we don't need accurate count, so no lock here
-	if logCount > maxLogCount && !setupLogWorking {
-		logCount = 0
-		setupLogWorking = true
-		go func() {
-			SetupLogger()
-		}()
+	if !logger.Enabled(context.Background(), level) {
+		return
 	}
+	logger.Log(context.Background(), level, msg, append(LogAttrs(ctx), args...)...)
 }
 
 func FatalLog(v ...any) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[FATAL] %v | %v \n", t.Format("2006/01/02 - 15:04:05"), v)
+	errorLogger.Load().Error(fmt.Sprint(v...), "source", "sys", "fatal", true)
 	os.Exit(1)
 }
 
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// /metrics 默认关闭，设置 METRICS_TOKEN 后在主端口以 Bearer 令牌访问，
+// 或设置 METRICS_ADDR 在单独的地址（如 127.0.0.1:9090）上无鉴权访问
+var (
+	MetricsToken = os.Getenv("METRICS_TOKEN")
+	MetricsAddr  = os.Getenv("METRICS_ADDR")
+)
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	relayRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "new_api_relay_requests_total",
+		Help: "Relay requests by relay mode, model, channel and status code.",
+	}, []string{"relay_mode", "model", "channel", "status"})
+	relayRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "new_api_relay_request_duration_seconds",
+		Help:    "Relay request latency by relay mode, model, channel and status code.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"relay_mode", "model", "channel", "status"})
+	relayFirstTokenDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "new_api_relay_first_token_seconds",
+		Help:    "Time to first streamed response by model and channel.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"model", "channel"})
+	relayRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "new_api_relay_retries_total",
+		Help: "Relay retries to another channel by model.",
+	}, []string{"model"})
+	relayStreamTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "new_api_relay_stream_timeouts_total",
+		Help: "Streams aborted by STREAMING_TIMEOUT by model and channel.",
+	}, []string{"model", "channel"})
+	channelAutoDisabledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "new_api_channel_auto_disabled_total",
+		Help: "Channels automatically disabled after upstream errors.",
+	}, []string{"channel"})
+	quotaConsumedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "new_api_quota_consumed_total",
+		Help: "Quota consumed by model and group.",
+	}, []string{"model", "group"})
+	cacheRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "new_api_cache_requests_total",
+		Help: "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+	taskQueueSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "new_api_task_queue_size",
+		Help: "Unfinished background tasks seen by the last polling round.",
+	}, []string{"task"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequestsTotal,
+		relayRequestDuration,
+		relayFirstTokenDuration,
+		relayRetriesTotal,
+		relayStreamTimeoutsTotal,
+		channelAutoDisabledTotal,
+		quotaConsumedTotal,
+		cacheRequestsTotal,
+		taskQueueSize,
+	)
+}
+
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// StartMetricsServer 在 METRICS_ADDR 上单独提供 /metrics，应只绑定内网地址
+func StartMetricsServer() {
+	if MetricsAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	go func() {
+		err := http.ListenAndServe(MetricsAddr, mux)
+		if err != nil {
+			SysError("failed to start metrics server: " + err.Error())
+		}
+	}()
+	SysLog("metrics server started on " + MetricsAddr)
+}
+
+func RecordRelayRequest(relayMode string, model string, channelId int, status int, duration time.Duration) {
+	channel := strconv.Itoa(channelId)
+	statusStr := strconv.Itoa(status)
+	relayRequestsTotal.WithLabelValues(relayMode, model, channel, statusStr).Inc()
+	relayRequestDuration.WithLabelValues(relayMode, model, channel, statusStr).Observe(duration.Seconds())
+}
+
+func RecordRelayFirstToken(model string, channelId int, duration time.Duration) {
+	relayFirstTokenDuration.WithLabelValues(model, strconv.Itoa(channelId)).Observe(duration.Seconds())
+}
+
+func RecordRelayRetries(model string, retries int) {
+	if retries > 0 {
+		relayRetriesTotal.WithLabelValues(model).Add(float64(retries))
+	}
+}
+
+func RecordStreamTimeout(model string, channelId int) {
+	relayStreamTimeoutsTotal.WithLabelValues(model, strconv.Itoa(channelId)).Inc()
+}
+
+func RecordChannelAutoDisabled(channelId int) {
+	channelAutoDisabledTotal.WithLabelValues(strconv.Itoa(channelId)).Inc()
+}
+
+func RecordQuotaConsumed(model string, group string, quota int) {
+	if quota > 0 {
+		quotaConsumedTotal.WithLabelValues(model, group).Add(float64(quota))
+	}
+}
+
+func RecordCacheResult(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequestsTotal.WithLabelValues(cache, result).Inc()
+}
+
+func SetTaskQueueSize(task string, size int) {
+	taskQueueSize.WithLabelValues(task).Set(float64(size))
+}
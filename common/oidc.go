@@ -0,0 +1,224 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// OIDCProvider 通用 OpenID Connect 登录提供方
+// 通过 Issuer 的 /.well-known/openid-configuration 自动发现授权、令牌及 JWKS 地址，
+// UsernameClaim 等字段指定从 ID Token 中读取的声明，GroupMapping 将 GroupClaim 中的外部分组映射为本系统分组。
+type OIDCProvider struct {
+	Slug             string            `json:"slug"`
+	Name             string            `json:"name"`
+	Enabled          bool              `json:"enabled"`
+	Issuer           string            `json:"issuer"`
+	ClientId         string            `json:"client_id"`
+	ClientSecret     string            `json:"client_secret,omitempty"`
+	Scopes           []string          `json:"scopes,omitempty"`
+	RedirectURL      string            `json:"redirect_url,omitempty"` // 为空时使用 ServerAddress + "/oauth/oidc/" + Slug
+	UsernameClaim    string            `json:"username_claim,omitempty"`
+	EmailClaim       string            `json:"email_claim,omitempty"`
+	DisplayNameClaim string            `json:"display_name_claim,omitempty"`
+	GroupClaim       string            `json:"group_claim,omitempty"`
+	GroupMapping     map[string]string `json:"group_mapping,omitempty"`
+	SyncGroup        bool              `json:"sync_group,omitempty"` // 每次登录时按映射更新用户分组
+}
+
+const oidcSecretMask = "******"
+
+var oidcSlugRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+var oidcProviders []*OIDCProvider
+var oidcProvidersLock sync.RWMutex
+
+func (provider *OIDCProvider) GetScopes() []string {
+	if len(provider.Scopes) == 0 {
+		return []string{"openid", "profile", "email"}
+	}
+	for _, scope := range provider.Scopes {
+		if scope == "openid" {
+			return provider.Scopes
+		}
+	}
+	return append([]string{"openid"}, provider.Scopes...)
+}
+
+func (provider *OIDCProvider) GetRedirectURL() string {
+	if provider.RedirectURL != "" {
+		return provider.RedirectURL
+	}
+	return strings.TrimRight(ServerAddress, "/") + "/oauth/oidc/" + provider.Slug
+}
+
+func (provider *OIDCProvider) GetUsernameClaim() string {
+	if provider.UsernameClaim == "" {
+		return "preferred_username"
+	}
+	return provider.UsernameClaim
+}
+
+func (provider *OIDCProvider) GetEmailClaim() string {
+	if provider.EmailClaim == "" {
+		return "email"
+	}
+	return provider.EmailClaim
+}
+
+func (provider *OIDCProvider) GetDisplayNameClaim() string {
+	if provider.DisplayNameClaim == "" {
+		return "name"
+	}
+	return provider.DisplayNameClaim
+}
+
+// MapGroup 返回外部分组中第一个命中映射的本系统分组，未命中时返回空字符串
+func (provider *OIDCProvider) MapGroup(externalGroups []string) string {
+	for _, externalGroup := range externalGroups {
+		if group, ok := provider.GroupMapping[externalGroup]; ok {
+			return group
+		}
+	}
+	return ""
+}
+
+// GetOIDCProvider 返回已启用的提供方，不存在或未启用时返回 nil
+func GetOIDCProvider(slug string) *OIDCProvider {
+	oidcProvidersLock.RLock()
+	defer oidcProvidersLock.RUnlock()
+	for _, provider := range oidcProviders {
+		if provider.Slug == slug && provider.Enabled {
+			return provider
+		}
+	}
+	return nil
+}
+
+// GetEnabledOIDCProviders 返回可公开展示的提供方信息
+func GetEnabledOIDCProviders() []map[string]string {
+	oidcProvidersLock.RLock()
+	defer oidcProvidersLock.RUnlock()
+	providers := make([]map[string]string, 0)
+	for _, provider := range oidcProviders {
+		if provider.Enabled {
+			providers = append(providers, map[string]string{
+				"slug": provider.Slug,
+				"name": provider.Name,
+			})
+		}
+	}
+	return providers
+}
+
+func OIDCProviders2JSONString() string {
+	oidcProvidersLock.RLock()
+	defer oidcProvidersLock.RUnlock()
+	return oidcProviders2JSONString(oidcProviders)
+}
+
+// OIDCProviders2MaskedJSONString 用于向管理界面展示配置，隐藏 ClientSecret
+func OIDCProviders2MaskedJSONString() string {
+	oidcProvidersLock.RLock()
+	defer oidcProvidersLock.RUnlock()
+	masked := make([]*OIDCProvider, 0, len(oidcProviders))
+	for _, provider := range oidcProviders {
+		clone := *provider
+		if clone.ClientSecret != "" {
+			clone.ClientSecret = oidcSecretMask
+		}
+		masked = append(masked, &clone)
+	}
+	return oidcProviders2JSONString(masked)
+}
+
+func oidcProviders2JSONString(providers []*OIDCProvider) string {
+	if providers == nil {
+		providers = []*OIDCProvider{}
+	}
+	jsonBytes, err := json.Marshal(providers)
+	if err != nil {
+		SysError("error marshalling oidc providers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateOIDCProvidersByJSONString(jsonStr string) error {
+	providers, err := parseOIDCProviders(jsonStr)
+	if err != nil {
+		return err
+	}
+	oidcProvidersLock.Lock()
+	oidcProviders = providers
+	oidcProvidersLock.Unlock()
+	return nil
+}
+
+// MergeOIDCProviderSecrets 管理界面提交的配置中 ClientSecret 为空或为掩码时沿用已保存的值
+func MergeOIDCProviderSecrets(jsonStr string) (string, error) {
+	providers, err := parseOIDCProviders(jsonStr)
+	if err != nil {
+		return "", err
+	}
+	oidcProvidersLock.RLock()
+	for _, provider := range providers {
+		if provider.ClientSecret != "" && provider.ClientSecret != oidcSecretMask {
+			continue
+		}
+		provider.ClientSecret = ""
+		for _, existing := range oidcProviders {
+			if existing.Slug == provider.Slug {
+				provider.ClientSecret = existing.ClientSecret
+				break
+			}
+		}
+	}
+	oidcProvidersLock.RUnlock()
+	return oidcProviders2JSONString(providers), nil
+}
+
+// CheckOIDCProviders 校验提供方配置，映射的目标分组必须已在 GroupRatio 中定义
+func CheckOIDCProviders(jsonStr string) error {
+	providers, err := parseOIDCProviders(jsonStr)
+	if err != nil {
+		return err
+	}
+	for _, provider := range providers {
+		for externalGroup, group := range provider.GroupMapping {
+			if _, ok := GroupRatio[group]; !ok {
+				return fmt.Errorf("OIDC 提供方 %s 的分组映射 %s 对应的分组 %s 不存在", provider.Slug, externalGroup, group)
+			}
+		}
+	}
+	return nil
+}
+
+func parseOIDCProviders(jsonStr string) ([]*OIDCProvider, error) {
+	providers := make([]*OIDCProvider, 0)
+	if strings.TrimSpace(jsonStr) == "" {
+		return providers, nil
+	}
+	err := json.Unmarshal([]byte(jsonStr), &providers)
+	if err != nil {
+		return nil, err
+	}
+	slugs := make(map[string]bool)
+	for _, provider := range providers {
+		if !oidcSlugRegex.MatchString(provider.Slug) {
+			return nil, fmt.Errorf("OIDC 提供方标识 %s 无效，仅允许小写字母、数字、下划线和短横线", provider.Slug)
+		}
+		if slugs[provider.Slug] {
+			return nil, fmt.Errorf("OIDC 提供方标识 %s 重复", provider.Slug)
+		}
+		slugs[provider.Slug] = true
+		if provider.Name == "" {
+			provider.Name = provider.Slug
+		}
+		if provider.Enabled && (provider.Issuer == "" || provider.ClientId == "") {
+			return nil, fmt.Errorf("无法启用 OIDC 提供方 %s，请先填入 Issuer 以及 Client Id", provider.Slug)
+		}
+	}
+	return providers, nil
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 管理接口的权限项，每个 /api 路由声明其所需的权限
+const (
+	PermissionChannelRead   = "channel.read"
+	PermissionChannelWrite  = "channel.write"
+	PermissionChannelTest   = "channel.test"
+	PermissionUserManage    = "user.manage"
+	PermissionBillingManage = "billing.manage"
+	PermissionLogsRead      = "logs.read"
+	PermissionLogsWrite     = "logs.write"
+	PermissionOptionsWrite  = "options.write"
+	// 为用户分配权限角色，拥有该权限即可给自己授予任意权限，默认只有超级管理员拥有
+	PermissionRoleManage = "role.manage"
+)
+
+var AllPermissions = []string{
+	PermissionChannelRead,
+	PermissionChannelWrite,
+	PermissionChannelTest,
+	PermissionUserManage,
+	PermissionBillingManage,
+	PermissionLogsRead,
+	PermissionLogsWrite,
+	PermissionOptionsWrite,
+	PermissionRoleManage,
+}
+
+// AccessTokenScopeSelf 个人访问令牌的特殊作用域，允许访问不需要管理权限的个人接口
+const AccessTokenScopeSelf = "self"
+
+// AccessTokenScopeAccount 个人访问令牌的特殊作用域，允许修改账户信息、注销账户、管理两步验证与访问令牌等，
+// self 作用域不包含这些接口
+const AccessTokenScopeAccount = "account"
+
+func IsSpecialAccessTokenScope(scope string) bool {
+	return scope == AccessTokenScopeSelf || scope == AccessTokenScopeAccount
+}
+
+// 内置角色与原有的用户等级一一对应，保证升级后原有的管理员与超级管理员权限不变
+var builtinRolePermissions = map[int][]string{
+	RoleCommonUser: {},
+	RoleAdminUser: {
+		PermissionChannelRead,
+		PermissionChannelWrite,
+		PermissionChannelTest,
+		PermissionUserManage,
+		PermissionBillingManage,
+		PermissionLogsRead,
+		PermissionLogsWrite,
+	},
+	RoleRootUser: AllPermissions,
+}
+
+// PermissionRoles 自定义权限角色，角色名 -> 权限列表
+// 例如 {"auditor": ["logs.read"], "ops": ["channel.read", "channel.write"]}
+var PermissionRoles = map[string][]string{}
+
+func PermissionRoles2JSONString() string {
+	jsonBytes, err := json.Marshal(PermissionRoles)
+	if err != nil {
+		SysError("error marshalling permission roles: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePermissionRolesByJSONString(jsonStr string) error {
+	permissionRoles := make(map[string][]string)
+	err := json.Unmarshal([]byte(jsonStr), &permissionRoles)
+	if err != nil {
+		return err
+	}
+	PermissionRoles = permissionRoles
+	return nil
+}
+
+// CheckPermissionRoles 校验自定义角色配置，角色名不能为空或包含逗号，权限必须是已定义的权限项
+func CheckPermissionRoles(jsonStr string) error {
+	permissionRoles := make(map[string][]string)
+	err := json.Unmarshal([]byte(jsonStr), &permissionRoles)
+	if err != nil {
+		return err
+	}
+	for name, permissions := range permissionRoles {
+		if name == "" || len(name) > 32 || strings.ContainsAny(name, ", ") {
+			return fmt.Errorf("角色名 %q 不合法", name)
+		}
+		for _, permission := range permissions {
+			if !IsValidPermission(permission) {
+				return fmt.Errorf("角色 %s 包含未知权限 %s", name, permission)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckAccessTokenScopes 校验个人访问令牌的作用域，只能是已定义的权限项、self 或 account
+func CheckAccessTokenScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("至少需要一个作用域")
+	}
+	for _, scope := range scopes {
+		if !IsSpecialAccessTokenScope(scope) && !IsValidPermission(scope) {
+			return fmt.Errorf("未知的作用域 %s", scope)
+		}
+	}
+	return nil
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePermissionRoleNames 解析用户上以逗号分隔保存的角色名
+func ParsePermissionRoleNames(roles string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(roles, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// HasMorePermissions 判断 actor 是否拥有 target 的全部权限且至少多出一项，用于判断能否管理其他用户
+func HasMorePermissions(actor []string, target []string) bool {
+	set := make(map[string]bool, len(actor))
+	for _, p := range actor {
+		set[p] = true
+	}
+	for _, p := range target {
+		if !set[p] {
+			return false
+		}
+		delete(set, p)
+	}
+	return len(set) > 0
+}
+
+// GetPermissions 计算用户等级对应的内置权限与所分配的自定义角色权限的并集
+func GetPermissions(role int, roleNames []string) []string {
+	set := make(map[string]bool)
+	for level, permissions := range builtinRolePermissions {
+		if role < level {
+			continue
+		}
+		for _, p := range permissions {
+			set[p] = true
+		}
+	}
+	for _, name := range roleNames {
+		for _, p := range PermissionRoles[name] {
+			set[p] = true
+		}
+	}
+	permissions := make([]string, 0, len(set))
+	for p := range set {
+		permissions = append(permissions, p)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
@@ -0,0 +1,285 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PricingWindow 时段定价窗口
+// Schedule 使用 cron 格式 "分 时 日 月 周" 描述窗口覆盖的时间，当前分钟匹配时窗口生效，
+// 例如 "* 0-6 * * *" 表示每天 0 点到 6 点 59 分，"* * 25 12 *" 表示每年 12 月 25 日全天。
+// Group 与 Model 为空时对所有分组或模型生效，多个窗口同时生效时倍率相乘。
+type PricingWindow struct {
+	Name       string  `json:"name"`
+	Schedule   string  `json:"schedule"`
+	Timezone   string  `json:"timezone,omitempty"`
+	Multiplier float64 `json:"multiplier"`
+	Group      string  `json:"group,omitempty"`
+	Model      string  `json:"model,omitempty"`
+
+	schedule *cronSchedule
+	location *time.Location
+}
+
+// PricingWindowStatus 用于展示当前生效或即将生效的窗口
+type PricingWindowStatus struct {
+	Name       string  `json:"name"`
+	Schedule   string  `json:"schedule"`
+	Timezone   string  `json:"timezone,omitempty"`
+	Multiplier float64 `json:"multiplier"`
+	Group      string  `json:"group,omitempty"`
+	Model      string  `json:"model,omitempty"`
+	Active     bool    `json:"active"`
+	StartTime  int64   `json:"start_time"`
+	EndTime    int64   `json:"end_time"`
+}
+
+// 查找即将生效窗口的时间范围
+const pricingWindowLookahead = 7 * 24 * time.Hour
+
+var pricingWindows []*PricingWindow
+var pricingWindowsLock sync.RWMutex
+
+func PricingWindows2JSONString() string {
+	pricingWindowsLock.RLock()
+	defer pricingWindowsLock.RUnlock()
+	windows := pricingWindows
+	if windows == nil {
+		windows = []*PricingWindow{}
+	}
+	jsonBytes, err := json.Marshal(windows)
+	if err != nil {
+		SysError("error marshalling pricing windows: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePricingWindowsByJSONString(jsonStr string) error {
+	windows, err := parsePricingWindows(jsonStr)
+	if err != nil {
+		return err
+	}
+	pricingWindowsLock.Lock()
+	pricingWindows = windows
+	pricingWindowsLock.Unlock()
+	return nil
+}
+
+// CheckPricingWindows 校验时段定价配置，除格式外还要求分组已在 GroupRatio 中定义
+func CheckPricingWindows(jsonStr string) error {
+	windows, err := parsePricingWindows(jsonStr)
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.Group == "" {
+			continue
+		}
+		if _, ok := GroupRatio[window.Group]; !ok {
+			return fmt.Errorf("时段定价 %s 的分组 %s 不存在", window.Name, window.Group)
+		}
+	}
+	return nil
+}
+
+func parsePricingWindows(jsonStr string) ([]*PricingWindow, error) {
+	windows := make([]*PricingWindow, 0)
+	if strings.TrimSpace(jsonStr) == "" {
+		return windows, nil
+	}
+	err := json.Unmarshal([]byte(jsonStr), &windows)
+	if err != nil {
+		return nil, err
+	}
+	for _, window := range windows {
+		if window.Multiplier < 0 {
+			return nil, fmt.Errorf("时段定价 %s 的倍率不能为负数", window.Name)
+		}
+		window.schedule, err = parseCronSchedule(window.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("时段定价 %s 的时间表达式错误: %s", window.Name, err.Error())
+		}
+		window.location = time.Local
+		if window.Timezone != "" {
+			window.location, err = time.LoadLocation(window.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("时段定价 %s 的时区错误: %s", window.Name, err.Error())
+			}
+		}
+	}
+	return windows, nil
+}
+
+func (window *PricingWindow) matchScope(group string, model string) bool {
+	if window.Group != "" && window.Group != group {
+		return false
+	}
+	if window.Model != "" && window.Model != model {
+		return false
+	}
+	return true
+}
+
+func (window *PricingWindow) activeAt(t time.Time) bool {
+	return window.schedule.match(t.In(window.location))
+}
+
+// GetPricingWindowRatio 返回 t 时刻对该分组和模型生效的时段倍率，没有生效的窗口时返回 1
+func GetPricingWindowRatio(group string, model string, t time.Time) float64 {
+	pricingWindowsLock.RLock()
+	defer pricingWindowsLock.RUnlock()
+	ratio := 1.0
+	for _, window := range pricingWindows {
+		if window.matchScope(group, model) && window.activeAt(t) {
+			ratio *= window.Multiplier
+		}
+	}
+	return ratio
+}
+
+// GetPricingWindowStatuses 列出对该分组生效中以及未来 7 天内将要生效的时段定价窗口
+func GetPricingWindowStatuses(group string, now time.Time) []PricingWindowStatus {
+	pricingWindowsLock.RLock()
+	defer pricingWindowsLock.RUnlock()
+	now = now.Truncate(time.Minute)
+	deadline := now.Add(pricingWindowLookahead)
+	statuses := make([]PricingWindowStatus, 0)
+	for _, window := range pricingWindows {
+		if window.Group != "" && window.Group != group {
+			continue
+		}
+		status := PricingWindowStatus{
+			Name:       window.Name,
+			Schedule:   window.Schedule,
+			Timezone:   window.Timezone,
+			Multiplier: window.Multiplier,
+			Group:      window.Group,
+			Model:      window.Model,
+		}
+		start := now
+		if window.activeAt(now) {
+			status.Active = true
+			for start.After(now.Add(-pricingWindowLookahead)) && window.activeAt(start.Add(-time.Minute)) {
+				start = start.Add(-time.Minute)
+			}
+		} else {
+			for start.Before(deadline) && !window.activeAt(start) {
+				start = start.Add(time.Minute)
+			}
+			if !start.Before(deadline) {
+				continue
+			}
+		}
+		end := start
+		for end.Before(deadline) && window.activeAt(end) {
+			end = end.Add(time.Minute)
+		}
+		status.StartTime = start.Unix()
+		status.EndTime = end.Unix()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].StartTime < statuses[j].StartTime
+	})
+	return statuses
+}
+
+type cronSchedule struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("需要 5 个字段：分 时 日 月 周")
+	}
+	var err error
+	schedule := &cronSchedule{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	if schedule.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 7 与 0 均表示周日
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	return schedule, nil
+}
+
+// parseCronField 支持 *、a、a-b、*/n、a-b/n 以及逗号分隔的组合
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("无效的步长: %s", part)
+			}
+			part = part[:i]
+		}
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("无效的取值: %s", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("无效的取值: %s", part)
+				}
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("取值超出范围 %d-%d: %s", min, max, part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) match(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	// 与 cron 一致：日和周都被限制时满足其一即可
+	if !s.domStar && !s.dowStar {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
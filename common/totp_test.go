@@ -0,0 +1,45 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试密钥
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	key, err := totpEncoding.DecodeString(testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(59, 0)
+	current := now.Unix() / TOTPPeriod
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOk   bool
+	}{
+		{"rfc 6238 vector", testTOTPSecret, "287082", current, true},
+		{"current step", testTOTPSecret, totpCode(key, current), current, true},
+		{"previous step", testTOTPSecret, totpCode(key, current-1), current - 1, true},
+		{"next step", testTOTPSecret, totpCode(key, current+1), current + 1, true},
+		{"surrounding whitespace", testTOTPSecret, " " + totpCode(key, current) + " ", current, true},
+		{"lower case secret with padding", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq====", totpCode(key, current), current, true},
+		{"outside skew", testTOTPSecret, totpCode(key, current+2), 0, false},
+		{"wrong code", testTOTPSecret, "000000", 0, false},
+		{"too short", testTOTPSecret, "28708", 0, false},
+		{"too long", testTOTPSecret, "2870820", 0, false},
+		{"invalid secret", "not base32!", "287082", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOk || step != tt.wantStep {
+				t.Errorf("ValidateTOTP = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOk)
+			}
+		})
+	}
+}
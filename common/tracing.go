@@ -0,0 +1,92 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("one-api")
+
+var tracerProvider *sdktrace.TracerProvider
+
+// InitTracer 设置 OTEL_EXPORTER_OTLP_ENDPOINT 或 OTEL_EXPORTER_OTLP_TRACES_ENDPOINT 后通过 OTLP/HTTP 导出链路追踪，
+// 其余参数（请求头、采样率、服务名等）均遵循 OpenTelemetry 的标准环境变量
+// 未开启导出时仍会透传 W3C traceparent
+func InitTracer() error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceVersion(Version),
+	))
+	if err != nil {
+		return err
+	}
+	if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		res, _ = resource.Merge(res, resource.NewSchemaless(semconv.ServiceName("new-api")))
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	SysLog("opentelemetry tracing enabled")
+	return nil
+}
+
+// ShutdownTracer 导出尚未发送的 span
+func ShutdownTracer() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := tracerProvider.Shutdown(ctx)
+	if err != nil {
+		SysError("failed to shutdown tracer provider: " + err.Error())
+	}
+}
+
+// StartSpan 以当前请求的上下文为父级创建 span，之后创建的 span 会成为它的子级；
+// 返回的 end 函数结束 span 并恢复父级上下文，可以重复调用
+func StartSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) (trace.Span, func()) {
+	parent := c.Request.Context()
+	ctx, span := tracer.Start(parent, name, trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return span, func() {
+		span.End()
+		c.Request = c.Request.WithContext(parent)
+	}
+}
+
+// StartServerSpan 为入站请求创建根 span，若请求携带 traceparent 则接续上游的链路
+func StartServerSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+	parent := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracer.Start(parent, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return span
+}
+
+// StartClientSpan 为发往上游的请求创建 span，并将 traceparent 写入请求头
+func StartClientSpan(ctx context.Context, name string, header http.Header, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	return ctx, span
+}
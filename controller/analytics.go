@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+)
+
+var analyticsIntervals = map[string]int64{
+	"hour": 3600,
+	"day":  86400,
+	"week": 604800,
+}
+
+// GetAnalytics 按时间范围返回渠道与模型的请求统计
+// group_by 可选 channel、model（逗号分隔），interval 可选 hour、day、week，为空时不按时间分组
+func GetAnalytics(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if endTimestamp == 0 {
+		endTimestamp = common.GetTimestamp()
+	}
+	if startTimestamp == 0 {
+		startTimestamp = endTimestamp - 86400
+	}
+	if endTimestamp-startTimestamp > 93*86400 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "时间跨度不能超过 3 个月",
+		})
+		return
+	}
+	var interval int64
+	if intervalStr := c.Query("interval"); intervalStr != "" {
+		var ok bool
+		interval, ok = analyticsIntervals[intervalStr]
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的时间粒度：" + intervalStr,
+			})
+			return
+		}
+	}
+	var groupBy []string
+	for _, field := range strings.Split(c.Query("group_by"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if field != "channel" && field != "model" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的分组字段：" + field,
+			})
+			return
+		}
+		groupBy = append(groupBy, field)
+	}
+	channelId, _ := strconv.Atoi(c.Query("channel"))
+	stats, err := model.GetAnalytics(model.AnalyticsQuery{
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ChannelId:      channelId,
+		ModelName:      c.Query("model_name"),
+		GroupBy:        groupBy,
+		Interval:       interval,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stats,
+	})
+}
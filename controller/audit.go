@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setAuditEvent 在变更成功后调用，before 和 after 会立即计算差异，之后修改对象不影响审计内容
+func setAuditEvent(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	c.Set("audit_event", &model.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+		Diff:       common.AuditDiff(before, after),
+	})
+}
+
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	} else if pageSize > 100 {
+		pageSize = 100
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	query := model.AuditLogQuery{
+		UserId:         userId,
+		Username:       c.Query("username"),
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		Ip:             c.Query("ip"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+	auditLogs, total, err := model.SearchAuditLogs(query, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    auditLogs,
+		"total":   total,
+	})
+}
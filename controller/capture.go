@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"one-api/model"
+)
+
+// GetCapture 按请求 ID 返回采集的请求与响应内容
+func GetCapture(c *gin.Context) {
+	requestId := c.Param("request_id")
+	capture, err := model.GetCaptureByRequestId(requestId)
+	if err != nil {
+		message := err.Error()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			message = "未找到该请求的采集内容"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	setAuditEvent(c, "capture.view", "capture", requestId, nil, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    capture,
+	})
+}
@@ -290,6 +290,7 @@ func UpdateChannelBalance(c *gin.Context) {
 		})
 		return
 	}
+	service.CheckChannelBalance(channel.Id, channel.Name, balance)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -318,6 +319,8 @@ func updateAllChannelsBalance() error {
 			// err is nil & balance <= 0 means quota is used up
 			if balance <= 0 {
 				service.DisableChannel(channel.Id, channel.Name, "余额不足")
+			} else {
+				service.CheckChannelBalance(channel.Id, channel.Name, balance)
 			}
 		}
 		time.Sleep(common.RequestInterval)
@@ -260,6 +260,7 @@ func testAllChannels(notify bool) error {
 				service.EnableChannel(channel.Id, channel.Name)
 			}
 
+			service.RecordChannelTestResult(channel.Id, channel.Name, err)
 			channel.UpdateResponseTime(milliseconds)
 			time.Sleep(common.RequestInterval)
 		}
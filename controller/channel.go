@@ -134,6 +134,7 @@ func FixChannelsAbilities(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "channel.fix_abilities", "channel", "", nil, gin.H{"fixed": count})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -180,6 +181,8 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	// 默认只返回脱敏后的密钥，查看明文需调用 GetChannelKey
+	channel.MaskKey()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -188,6 +191,62 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+func GetChannelKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !checkTwoFactorReauth(c) {
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("查看渠道 %s(#%d) 的密钥，IP：%s", channel.Name, channel.Id, c.ClientIP()))
+	setAuditEvent(c, "channel.reveal_key", "channel", channel.Id, nil, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    channel.Key,
+	})
+	return
+}
+
+func ReencryptChannelKeys(c *gin.Context) {
+	if !common.ChannelKeyEncryptionEnabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未配置渠道密钥主密钥",
+		})
+		return
+	}
+	count, err := model.ReencryptChannelKeys()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("使用当前主密钥重新加密了 %d 个渠道密钥", count))
+	setAuditEvent(c, "channel.reencrypt", "channel", "", nil, gin.H{"reencrypted": count})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+	return
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -198,6 +257,9 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if !checkTwoFactorReauth(c) {
+		return
+	}
 	channel.CreatedTime = common.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
 	if channel.Type == common.VertexAiChannel.Type {
@@ -239,6 +301,11 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	ids := make([]string, 0, len(channels))
+	for _, channel_ := range channels {
+		ids = append(ids, strconv.Itoa(channel_.Id))
+	}
+	setAuditEvent(c, "channel.create", "channel", strings.Join(ids, ","), nil, channel)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -248,6 +315,7 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetChannelById(id, false)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -257,6 +325,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "channel.delete", "channel", id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -273,6 +342,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "channel.delete_disabled", "channel", "", nil, gin.H{"deleted": rows})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -303,6 +373,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "channel.delete_batch", "channel", "", nil, channelBatch)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -321,6 +392,10 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	// 修改渠道密钥属于敏感操作
+	if channel.Key != "" && !checkTwoFactorReauth(c) {
+		return
+	}
 	if channel.Type == common.VertexAiChannel.Type {
 		if channel.Other == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -342,6 +417,7 @@ func UpdateChannel(c *gin.Context) {
 			}
 		}
 	}
+	origin, _ := model.GetChannelById(channel.Id, true)
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -350,6 +426,8 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "channel.update", "channel", channel.Id, origin, channel)
+	channel.MaskKey()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
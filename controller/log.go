@@ -5,6 +5,7 @@ import (
 	"one-api/common"
 	"one-api/model"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -188,7 +189,7 @@ func DeleteHistoryLogs(c *gin.Context) {
 		})
 		return
 	}
-	count, err := model.DeleteOldLog(c.Request.Context(), targetTimestamp, 100)
+	count, err := model.DeleteOldLog(c.Request.Context(), 0, targetTimestamp, model.LogTypeUnknown, 100)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -203,3 +204,79 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetRequestTimeline 按请求 ID 返回请求经过的渠道、每次尝试的结果与耗时以及最终的计费
+func GetRequestTimeline(c *gin.Context) {
+	requestId := c.Param("request_id")
+	timeline, err := model.GetRequestTimeline(requestId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	setAuditEvent(c, "log.timeline", "request", requestId, nil, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    timeline,
+	})
+}
+
+// GetLogArchives 查询日志归档，可按类型与日期范围（2006-01-02）筛选
+func GetLogArchives(c *gin.Context) {
+	logType, _ := strconv.Atoi(c.Query("type"))
+	archives, err := model.GetLogArchives(logType, c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    archives,
+	})
+}
+
+type restoreLogArchivesRequest struct {
+	Type      int    `json:"type"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// RestoreLogArchives 将日期范围内的归档恢复到日志表
+func RestoreLogArchives(c *gin.Context) {
+	var req restoreLogArchivesRequest
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		_, err = time.Parse("2006-01-02", req.StartDate)
+	}
+	if err == nil {
+		_, err = time.Parse("2006-01-02", req.EndDate)
+	}
+	if err != nil || req.StartDate > req.EndDate {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "请提供有效的开始与结束日期，格式为 2006-01-02",
+		})
+		return
+	}
+	count, err := model.RestoreLogArchives(c.Request.Context(), req.Type, req.StartDate, req.EndDate)
+	setAuditEvent(c, "log.restore", "log_archive", req.StartDate+"~"+req.EndDate, nil, req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
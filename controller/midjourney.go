@@ -24,6 +24,7 @@ func UpdateMidjourneyTaskBulk() {
 		time.Sleep(time.Duration(15) * time.Second)
 
 		tasks := model.GetAllUnFinishTasks()
+		common.SetTaskQueueSize("midjourney", len(tasks))
 		if len(tasks) == 0 {
 			continue
 		}
@@ -163,7 +164,7 @@ func UpdateMidjourneyTaskBulk() {
 					common.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 				} else {
 					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota)
+						err = model.IncreaseBillingQuota(task.UserId, task.OrgId, task.Quota)
 						if err != nil {
 							common.LogError(ctx, "fail to increase user quota: "+err.Error())
 						}
@@ -41,6 +41,7 @@ func GetStatus(c *gin.Context) {
 			"linuxdo_oauth":            common.LinuxDoOAuthEnabled,
 			"linuxdo_client_id":        common.LinuxDoClientId,
 			"telegram_oauth":           common.TelegramOAuthEnabled,
+			"oidc_providers":           common.GetEnabledOIDCProviders(),
 			"telegram_bot_name":        common.TelegramBotName,
 			"system_name":              common.SystemName,
 			"logo":                     common.Logo,
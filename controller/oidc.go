@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OIDCAuthorize 生成授权地址，state、nonce 与 PKCE code_verifier 保存在会话中
+func OIDCAuthorize(c *gin.Context) {
+	provider := common.GetOIDCProvider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过该方式登录以及注册",
+		})
+		return
+	}
+	authRequest, err := service.BuildOIDCAuthRequest(provider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	session := sessions.Default(c)
+	session.Set("oidc_provider", provider.Slug)
+	session.Set("oidc_state", authRequest.State)
+	session.Set("oidc_nonce", authRequest.Nonce)
+	session.Set("oidc_code_verifier", authRequest.CodeVerifier)
+	err = session.Save()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"url":   authRequest.URL,
+			"state": authRequest.State,
+		},
+	})
+}
+
+// getOIDCIdentityByCode 校验回调的 state 并换取用户信息，会话中的授权参数只能使用一次
+func getOIDCIdentityByCode(c *gin.Context, provider *common.OIDCProvider) (*service.OIDCIdentity, error) {
+	session := sessions.Default(c)
+	sessionProvider, _ := session.Get("oidc_provider").(string)
+	sessionState, _ := session.Get("oidc_state").(string)
+	nonce, _ := session.Get("oidc_nonce").(string)
+	codeVerifier, _ := session.Get("oidc_code_verifier").(string)
+	state := c.Query("state")
+	if state == "" || sessionState == "" || state != sessionState || sessionProvider != provider.Slug {
+		return nil, errors.New("state is empty or not same")
+	}
+	session.Delete("oidc_provider")
+	session.Delete("oidc_state")
+	session.Delete("oidc_nonce")
+	session.Delete("oidc_code_verifier")
+	err := session.Save()
+	if err != nil {
+		return nil, err
+	}
+	if errorCode := c.Query("error"); errorCode != "" {
+		return nil, errors.New("OIDC 授权失败: " + errorCode + " " + c.Query("error_description"))
+	}
+	return service.ExchangeOIDCCode(provider, c.Query("code"), codeVerifier, nonce)
+}
+
+func OIDCOAuth(c *gin.Context) {
+	provider := common.GetOIDCProvider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过该方式登录以及注册",
+		})
+		return
+	}
+	session := sessions.Default(c)
+	if session.Get("oidc_state") == nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	username := session.Get("username")
+	if username != nil {
+		OIDCBind(c, provider)
+		return
+	}
+	oidcIdentity, err := getOIDCIdentityByCode(c, provider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	group := provider.MapGroup(oidcIdentity.Groups)
+	user := model.User{}
+	identity, err := model.GetUserIdentity(provider.Slug, oidcIdentity.Subject)
+	if err == nil {
+		user.Id = identity.UserId
+		err = user.FillUserById()
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		identity.UpdateLastLoginTime()
+		if provider.SyncGroup && group != "" && group != user.Group {
+			err = model.SetUserGroup(user.Id, group)
+			if err != nil {
+				common.SysError("failed to sync oidc user group: " + err.Error())
+			} else {
+				user.Group = group
+			}
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	} else {
+		if common.RegisterEnabled {
+			user.InviterId, _ = model.GetUserIdByAffCode(c.Query("aff"))
+
+			user.Username = oidcUsername(provider, oidcIdentity)
+			if oidcIdentity.DisplayName != "" {
+				user.DisplayName = oidcIdentity.DisplayName
+			} else {
+				user.DisplayName = provider.Name + " User"
+			}
+			if oidcIdentity.Email != "" && !model.IsEmailAlreadyTaken(oidcIdentity.Email) {
+				user.Email = oidcIdentity.Email
+			}
+			if group != "" {
+				user.Group = group
+			}
+			user.Role = common.RoleCommonUser
+			user.Status = common.UserStatusEnabled
+
+			identity = &model.UserIdentity{
+				Provider: provider.Slug,
+				Subject:  oidcIdentity.Subject,
+				Email:    oidcIdentity.Email,
+			}
+			if err := user.InsertWithIdentity(user.InviterId, identity); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		} else {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "管理员关闭了新用户注册",
+			})
+			return
+		}
+	}
+
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	setupLogin(&user, c)
+}
+
+// oidcUsername 优先使用提供方返回的用户名，不合法或已被占用时按 GitHub 登录的方式生成
+func oidcUsername(provider *common.OIDCProvider, oidcIdentity *service.OIDCIdentity) string {
+	if oidcIdentity.Username != "" && len(oidcIdentity.Username) <= 12 {
+		exist, err := model.CheckUserExistOrDeleted(oidcIdentity.Username, "")
+		if err == nil && !exist {
+			return oidcIdentity.Username
+		}
+	}
+	suffix := strconv.Itoa(model.GetMaxUserId() + 1)
+	username := provider.Slug + "_" + suffix
+	if len(username) > 12 {
+		username = "oidc_" + suffix
+	}
+	return username
+}
+
+func OIDCBind(c *gin.Context, provider *common.OIDCProvider) {
+	oidcIdentity, err := getOIDCIdentityByCode(c, provider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if model.IsUserIdentityAlreadyTaken(provider.Slug, oidcIdentity.Subject) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该 " + provider.Name + " 账户已被绑定",
+		})
+		return
+	}
+	session := sessions.Default(c)
+	id := session.Get("id").(int)
+	if model.IsUserIdentityBound(id, provider.Slug) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "当前用户已绑定其他 " + provider.Name + " 账户，请先解绑",
+		})
+		return
+	}
+	identity := model.UserIdentity{
+		UserId:   id,
+		Provider: provider.Slug,
+		Subject:  oidcIdentity.Subject,
+		Email:    oidcIdentity.Email,
+	}
+	err = identity.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "bind",
+	})
+	return
+}
+
+func GetUserIdentities(c *gin.Context) {
+	identities, err := model.GetUserIdentities(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    identities,
+	})
+	return
+}
+
+func DeleteUserIdentity(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	user, err := model.GetUserById(userId, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 通过 OIDC 注册且未设置密码的用户解绑后将无法登录
+	if user.Password == "" && user.GitHubId == "" && user.LinuxDoId == "" && user.WeChatId == "" && user.TelegramId == "" {
+		identities, err := model.GetUserIdentities(userId)
+		if err == nil && len(identities) <= 1 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "这是当前账户唯一的登录方式，请先设置密码后再解绑",
+			})
+			return
+		}
+	}
+	err = model.DeleteUserIdentityById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
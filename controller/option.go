@@ -17,9 +17,15 @@ func GetOptions(c *gin.Context) {
 		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") || strings.HasSuffix(k, "Key") {
 			continue
 		}
+		value := common.Interface2String(v)
+		if k == "OIDCProviders" {
+			value = common.OIDCProviders2MaskedJSONString()
+		} else if k == "AlertConfig" {
+			value = common.AlertConfig2MaskedJSONString()
+		}
 		options = append(options, &model.Option{
 			Key:   k,
-			Value: common.Interface2String(v),
+			Value: value,
 		})
 	}
 	common.OptionMapRWMutex.Unlock()
@@ -58,6 +64,14 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "AdminTwoFactorEnabled":
+		if option.Value == "true" && !model.IsTwoFactorEnabled(c.GetInt("id")) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法强制管理员启用两步验证，请先为当前账户启用两步验证！",
+			})
+			return
+		}
 	case "EmailDomainRestrictionEnabled":
 		if option.Value == "true" && len(common.EmailDomainWhitelist) == 0 {
 			c.JSON(http.StatusOK, gin.H{
@@ -74,6 +88,92 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "GroupModelRatio":
+		err = common.CheckGroupModelRatio(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分组模型倍率设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "PermissionRoles":
+		// 拥有 options.write 权限的自定义角色不能修改角色定义，避免自行提升权限
+		if c.GetInt("role") < common.RoleRootUser {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "只有超级管理员可以修改权限角色",
+			})
+			return
+		}
+		err = common.CheckPermissionRoles(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "权限角色设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "AlertConfig":
+		err = common.CheckAlertConfig(option.Value)
+		if err == nil {
+			option.Value, err = common.MergeAlertSinkSecrets(option.Value)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "告警设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "CaptureConfig":
+		err = common.CheckCaptureConfig(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "采集配置设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "LogRetentionConfig":
+		err = common.CheckLogRetentionConfig(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "日志保留策略设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "LogLevel":
+		err = common.CheckLogLevel(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "PricingWindows":
+		err = common.CheckPricingWindows(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "时段定价设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "OIDCProviders":
+		err = common.CheckOIDCProviders(option.Value)
+		if err == nil {
+			option.Value, err = common.MergeOIDCProviderSecrets(option.Value)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "OIDC 登录设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "TurnstileCheckEnabled":
 		if option.Value == "true" && common.TurnstileSiteKey == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -83,6 +183,7 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 	}
+	before := optionAuditValue(option.Key)
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -91,9 +192,31 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "option.update", "option", option.Key, before, optionAuditValue(option.Key))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 	})
 	return
 }
+
+// optionAuditValue 返回用于审计的配置值，JSON 对象类型的配置（如各类倍率）展开后按键比较
+// OIDCProviders 与 AlertConfig 中包含密钥，需要脱敏
+func optionAuditValue(key string) any {
+	if key == "OIDCProviders" {
+		return map[string]string{key: common.OIDCProviders2MaskedJSONString()}
+	}
+	if key == "AlertConfig" {
+		return map[string]string{key: common.AlertConfig2MaskedJSONString()}
+	}
+	common.OptionMapRWMutex.RLock()
+	value := common.Interface2String(common.OptionMap[key])
+	common.OptionMapRWMutex.RUnlock()
+	if !strings.HasSuffix(key, "Token") && !strings.HasSuffix(key, "Secret") && !strings.HasSuffix(key, "Key") {
+		var fields map[string]any
+		if json.Unmarshal([]byte(value), &fields) == nil {
+			return fields
+		}
+	}
+	return map[string]string{key: value}
+}
@@ -0,0 +1,564 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getOrganizationMember 校验当前用户在组织中的角色不低于 minRole，系统管理员视为组织所有者
+// 校验失败时已写入响应，返回 nil
+func getOrganizationMember(c *gin.Context, minRole int) (*model.Organization, *model.OrganizationMember) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return nil, nil
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织不存在",
+		})
+		return nil, nil
+	}
+	userId := c.GetInt("id")
+	// 拥有计费管理权限的用户（含自定义角色）可以以所有者身份管理任意组织
+	canManageBilling := model.HasUserPermission(userId, c.GetInt("role"), common.PermissionBillingManage)
+	member, err := model.GetOrganizationMember(orgId, userId)
+	if err != nil {
+		if !canManageBilling {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，不是该组织的成员",
+			})
+			return nil, nil
+		}
+		member = &model.OrganizationMember{OrgId: orgId, UserId: userId}
+	}
+	if canManageBilling {
+		member.Role = common.OrganizationRoleOwner
+	}
+	if member.Role < minRole {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，组织权限不足",
+		})
+		return nil, nil
+	}
+	return org, member
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orgs, total, err := model.GetAllOrganizations(p*common.ItemsPerPage, common.ItemsPerPage, c.Query("keyword"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+		"total":   total,
+	})
+	return
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+	return
+}
+
+func GetOrganization(c *gin.Context) {
+	org, member := getOrganizationMember(c, common.OrganizationRoleMember)
+	if org == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"organization": org,
+			"member":       member,
+		},
+	})
+	return
+}
+
+func AddOrganization(c *gin.Context) {
+	org := model.Organization{}
+	err := c.ShouldBindJSON(&org)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = model.ValidateOrganizationName(org.Name); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanOrg := model.Organization{
+		Name:    strings.TrimSpace(org.Name),
+		OwnerId: c.GetInt("id"),
+	}
+	err = cleanOrg.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanOrg,
+	})
+	return
+}
+
+// UpdateOrganization 系统管理员修改组织名称、状态与额度
+func UpdateOrganization(c *gin.Context) {
+	org := model.Organization{}
+	err := c.ShouldBindJSON(&org)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	originOrg, err := model.GetOrganizationById(org.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = model.ValidateOrganizationName(org.Name); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if org.Status != common.OrganizationStatusEnabled && org.Status != common.OrganizationStatusDisabled {
+		org.Status = originOrg.Status
+	}
+	originOrg.Name = strings.TrimSpace(org.Name)
+	originOrg.Status = org.Status
+	quotaChanged := originOrg.Quota != org.Quota
+	oldQuota := originOrg.Quota
+	originOrg.Quota = org.Quota
+	err = originOrg.Update(true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if quotaChanged {
+		model.RecordLog(originOrg.OwnerId, model.LogTypeManage, fmt.Sprintf("管理员将组织 %s 的额度从 %s 修改为 %s", originOrg.Name, common.LogQuota(oldQuota), common.LogQuota(originOrg.Quota)))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    originOrg,
+	})
+	return
+}
+
+// RenameOrganization 组织管理员修改组织名称
+func RenameOrganization(c *gin.Context) {
+	org, _ := getOrganizationMember(c, common.OrganizationRoleAdmin)
+	if org == nil {
+		return
+	}
+	req := model.Organization{}
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		err = model.ValidateOrganizationName(req.Name)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	org.Name = strings.TrimSpace(req.Name)
+	err = org.Update(false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+	return
+}
+
+func DeleteOrganization(c *gin.Context) {
+	org, _ := getOrganizationMember(c, common.OrganizationRoleOwner)
+	if org == nil {
+		return
+	}
+	err := model.DeleteOrganizationById(org.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	org, _ := getOrganizationMember(c, common.OrganizationRoleAdmin)
+	if org == nil {
+		return
+	}
+	members, err := model.GetOrganizationMembers(org.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+	return
+}
+
+type OrganizationMemberRequest struct {
+	UserId     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Role       int    `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+}
+
+// validateOrganizationMemberRole 只有所有者可以任免组织管理员，所有者身份不能通过成员接口授予
+func validateOrganizationMemberRole(operator *model.OrganizationMember, role int) error {
+	if role != common.OrganizationRoleMember && role != common.OrganizationRoleAdmin {
+		return errors.New("无效的成员角色")
+	}
+	if role == common.OrganizationRoleAdmin && operator.Role < common.OrganizationRoleOwner {
+		return errors.New("只有组织所有者可以设置管理员")
+	}
+	return nil
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	org, operator := getOrganizationMember(c, common.OrganizationRoleAdmin)
+	if org == nil {
+		return
+	}
+	var req OrganizationMemberRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.Role == 0 {
+		req.Role = common.OrganizationRoleMember
+	}
+	if err = validateOrganizationMemberRole(operator, req.Role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.QuotaLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "消费上限不能为负数",
+		})
+		return
+	}
+	user := model.User{Username: req.Username}
+	if err = user.FillUserByUsername(); err != nil || user.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	member := model.OrganizationMember{
+		OrgId:      org.Id,
+		UserId:     user.Id,
+		Role:       req.Role,
+		QuotaLimit: req.QuotaLimit,
+	}
+	err = member.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	member.Username = user.Username
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+	return
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	org, operator := getOrganizationMember(c, common.OrganizationRoleAdmin)
+	if org == nil {
+		return
+	}
+	var req OrganizationMemberRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	member, err := model.GetOrganizationMember(org.Id, req.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "成员不存在",
+		})
+		return
+	}
+	if member.Role >= operator.Role {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权修改同等级或更高等级的成员",
+		})
+		return
+	}
+	if err = validateOrganizationMemberRole(operator, req.Role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.QuotaLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "消费上限不能为负数",
+		})
+		return
+	}
+	member.Role = req.Role
+	member.QuotaLimit = req.QuotaLimit
+	err = member.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+	return
+}
+
+// DeleteOrganizationMember 移除成员，成员也可以通过该接口退出组织
+func DeleteOrganizationMember(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	minRole := common.OrganizationRoleAdmin
+	if userId == c.GetInt("id") {
+		minRole = common.OrganizationRoleMember
+	}
+	org, operator := getOrganizationMember(c, minRole)
+	if org == nil {
+		return
+	}
+	if userId != operator.UserId {
+		member, err := model.GetOrganizationMember(org.Id, userId)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "成员不存在",
+			})
+			return
+		}
+		if member.Role >= operator.Role {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权移除同等级或更高等级的成员",
+			})
+			return
+		}
+	}
+	err := model.RemoveOrganizationMember(org.Id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// TransferOrganizationQuota 成员将个人额度转入组织额度池
+func TransferOrganizationQuota(c *gin.Context) {
+	org, member := getOrganizationMember(c, common.OrganizationRoleMember)
+	if org == nil {
+		return
+	}
+	var req struct {
+		Quota int `json:"quota"`
+	}
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		err = model.TransferUserQuotaToOrganization(member.UserId, org.Id, req.Quota)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// GetOrganizationLogs 组织管理员可以查看所有成员的消费日志，普通成员只能查看自己的
+func GetOrganizationLogs(c *gin.Context) {
+	org, member := getOrganizationMember(c, common.OrganizationRoleMember)
+	if org == nil {
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	userId := 0
+	username := c.Query("username")
+	if member.Role < common.OrganizationRoleAdmin {
+		userId = member.UserId
+		username = ""
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	logs, total, err := model.GetOrganizationLogs(org.Id, userId, startTimestamp, endTimestamp, c.Query("model_name"), username, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+		"total":   total,
+	})
+	return
+}
+
+func GetOrganizationQuotaDates(c *gin.Context) {
+	org, _ := getOrganizationMember(c, common.OrganizationRoleAdmin)
+	if org == nil {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	// 判断时间跨度是否超过 1 个月
+	if endTimestamp-startTimestamp > 2592000 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "时间跨度不能超过 1 个月",
+		})
+		return
+	}
+	dates, err := model.GetQuotaDataByOrgId(org.Id, startTimestamp, endTimestamp, c.Query("username"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    dates,
+	})
+	return
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPermissions 返回所有权限项、内置角色对应的权限以及自定义角色
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"permissions": common.AllPermissions,
+			"builtin_roles": gin.H{
+				"common": common.GetPermissions(common.RoleCommonUser, nil),
+				"admin":  common.GetPermissions(common.RoleAdminUser, nil),
+				"root":   common.GetPermissions(common.RoleRootUser, nil),
+			},
+			"roles": common.PermissionRoles,
+		},
+	})
+	return
+}
+
+func GetSelfPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetUserPermissions(c.GetInt("id"), c.GetInt("role")),
+	})
+	return
+}
+
+type UserPermissionRolesRequest struct {
+	Id    int      `json:"id"`
+	Roles []string `json:"roles"`
+}
+
+// SetUserPermissionRoles 为用户分配自定义权限角色，传入空列表即收回全部自定义角色
+func SetUserPermissionRoles(c *gin.Context) {
+	var req UserPermissionRolesRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	for _, name := range req.Roles {
+		if _, ok := common.PermissionRoles[name]; !ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("权限角色 %s 不存在", name),
+			})
+			return
+		}
+	}
+	err = model.SetUserPermissionRoles(req.Id, req.Roles)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(req.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户的权限角色设置为 [%s]", strings.Join(req.Roles, ", ")))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PersonalAccessTokenRequest struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	ExpiredTime int64    `json:"expired_time"`
+	AllowIps    string   `json:"allow_ips"`
+}
+
+// rejectPersonalAccessToken 个人访问令牌不能用于管理令牌本身，避免通过令牌签发更高权限的令牌
+func rejectPersonalAccessToken(c *gin.Context) bool {
+	if c.GetInt("personal_access_token_id") == 0 {
+		return false
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": "该操作不允许使用个人访问令牌",
+	})
+	return true
+}
+
+func GetPersonalAccessTokens(c *gin.Context) {
+	tokens, err := model.GetPersonalAccessTokensByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    tokens,
+	})
+	return
+}
+
+// AddPersonalAccessToken 创建个人访问令牌，令牌明文只在此处返回一次
+func AddPersonalAccessToken(c *gin.Context) {
+	if rejectPersonalAccessToken(c) || !checkTwoFactorReauth(c) {
+		return
+	}
+	var req PersonalAccessTokenRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "令牌名称不能为空且不能超过 64 个字符",
+		})
+		return
+	}
+	if err = common.CheckAccessTokenScopes(req.Scopes); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	permissions := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	for _, scope := range req.Scopes {
+		if !common.IsSpecialAccessTokenScope(scope) && !common.StringsContains(permissions, scope) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("你没有 %s 权限，无法授予该作用域", scope),
+			})
+			return
+		}
+	}
+	if req.ExpiredTime == 0 {
+		req.ExpiredTime = -1
+	}
+	if req.ExpiredTime != -1 && req.ExpiredTime <= common.GetTimestamp() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "过期时间不能早于当前时间",
+		})
+		return
+	}
+	if _, err = common.ParseIpAllowList(req.AllowIps); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	token := model.PersonalAccessToken{
+		UserId:      c.GetInt("id"),
+		Name:        req.Name,
+		Scopes:      strings.Join(req.Scopes, ","),
+		AllowIps:    strings.TrimSpace(req.AllowIps),
+		ExpiredTime: req.ExpiredTime,
+	}
+	key, err := model.CreatePersonalAccessToken(&token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(token.UserId, model.LogTypeManage, fmt.Sprintf("创建个人访问令牌 %s(#%d)，作用域：%s", token.Name, token.Id, token.Scopes))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"token": token,
+			"key":   key,
+		},
+	})
+	return
+}
+
+func RevokePersonalAccessToken(c *gin.Context) {
+	if rejectPersonalAccessToken(c) {
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	err := model.RevokePersonalAccessToken(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, fmt.Sprintf("撤销个人访问令牌 #%d", id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
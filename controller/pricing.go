@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"one-api/common"
 	"one-api/model"
+	"time"
 )
 
 func GetPricing(c *gin.Context) {
@@ -16,14 +17,16 @@ func GetPricing(c *gin.Context) {
 	}
 	pricing := model.GetPricing(group)
 	c.JSON(200, gin.H{
-		"success":     true,
-		"data":        pricing,
-		"group_ratio": groupRatio,
+		"success":         true,
+		"data":            pricing,
+		"group_ratio":     groupRatio,
+		"pricing_windows": common.GetPricingWindowStatuses(common.GetStringIfEmpty(group, "default"), time.Now()),
 	})
 }
 
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := common.DefaultModelRatio2JSONString()
+	before := optionAuditValue("ModelRatio")
 	err := model.UpdateOption("ModelRatio", defaultStr)
 	if err != nil {
 		c.JSON(200, gin.H{
@@ -40,6 +43,7 @@ func ResetModelRatio(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "option.reset_model_ratio", "option", "ModelRatio", before, optionAuditValue("ModelRatio"))
 	c.JSON(200, gin.H{
 		"success": true,
 		"message": "重置模型倍率成功",
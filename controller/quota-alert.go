@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+)
+
+func GetQuotaAlerts(c *gin.Context) {
+	alerts, err := model.GetUserQuotaAlerts(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	for _, alert := range alerts {
+		alert.HideWebhookSecret()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    alerts,
+	})
+	return
+}
+
+func AddQuotaAlert(c *gin.Context) {
+	alert := model.QuotaAlert{}
+	err := c.ShouldBindJSON(&alert)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userId := c.GetInt("id")
+	if message := validateQuotaAlert(userId, &alert); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	cleanAlert := model.QuotaAlert{
+		UserId:        userId,
+		Type:          alert.Type,
+		TokenId:       alert.TokenId,
+		Threshold:     alert.Threshold,
+		Channel:       alert.Channel,
+		WebhookUrl:    alert.WebhookUrl,
+		WebhookSecret: alert.WebhookSecret,
+		Enabled:       true,
+		CreatedTime:   common.GetTimestamp(),
+	}
+	err = cleanAlert.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanAlert.HideWebhookSecret()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanAlert,
+	})
+	return
+}
+
+func UpdateQuotaAlert(c *gin.Context) {
+	alert := model.QuotaAlert{}
+	err := c.ShouldBindJSON(&alert)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userId := c.GetInt("id")
+	cleanAlert, err := model.GetQuotaAlertByIds(alert.Id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if message := validateQuotaAlert(userId, &alert); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	// If you add more fields, please also update alert.Update()
+	cleanAlert.Type = alert.Type
+	cleanAlert.TokenId = alert.TokenId
+	cleanAlert.Threshold = alert.Threshold
+	cleanAlert.Channel = alert.Channel
+	cleanAlert.WebhookUrl = alert.WebhookUrl
+	// 密钥不会返回给前端，留空表示保持原密钥
+	if alert.Channel != model.QuotaAlertChannelWebhook {
+		cleanAlert.WebhookSecret = ""
+	} else if alert.WebhookSecret != "" {
+		cleanAlert.WebhookSecret = alert.WebhookSecret
+	}
+	cleanAlert.Enabled = alert.Enabled
+	// 修改阈值后重新开始判断是否越过阈值
+	cleanAlert.Triggered = false
+	err = cleanAlert.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanAlert.HideWebhookSecret()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanAlert,
+	})
+	return
+}
+
+func DeleteQuotaAlert(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteQuotaAlertById(id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func validateQuotaAlert(userId int, alert *model.QuotaAlert) string {
+	switch alert.Type {
+	case model.QuotaAlertTypeBalance:
+		if alert.Threshold <= 0 {
+			return "提醒阈值必须大于0"
+		}
+		alert.TokenId = 0
+	case model.QuotaAlertTypeTokenBudget:
+		if alert.Threshold <= 0 || alert.Threshold > 100 {
+			return "令牌预算提醒阈值必须在0-100之间"
+		}
+		token, err := model.GetTokenByIds(alert.TokenId, userId)
+		if err != nil {
+			return "令牌不存在"
+		}
+		if token.UnlimitedQuota {
+			return "无限额度令牌无法设置预算提醒"
+		}
+	default:
+		return "不支持的提醒类型"
+	}
+	switch alert.Channel {
+	case model.QuotaAlertChannelEmail:
+		email, err := model.GetUserEmail(userId)
+		if err != nil || email == "" {
+			return "请先绑定邮箱"
+		}
+	case model.QuotaAlertChannelWebhook:
+		if err := common.ValidatePublicUrl(context.Background(), alert.WebhookUrl); err != nil {
+			return "无效的 Webhook 地址: " + err.Error()
+		}
+	case model.QuotaAlertChannelTelegram:
+		if common.TelegramBotToken == "" {
+			return "管理员未配置 Telegram 机器人"
+		}
+		telegramId, err := model.GetUserTelegramId(userId)
+		if err != nil || telegramId == "" {
+			return "请先绑定 Telegram 账户"
+		}
+	default:
+		return "不支持的提醒方式"
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"time"
+)
+
+func GetAllRedemptionCampaigns(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	campaigns, total, err := model.GetAllRedemptionCampaigns(p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    campaigns,
+		"total":   total,
+	})
+	return
+}
+
+func GetRedemptionCampaign(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    campaign,
+	})
+	return
+}
+
+func AddRedemptionCampaign(c *gin.Context) {
+	campaign := model.RedemptionCampaign{}
+	err := c.ShouldBindJSON(&campaign)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(campaign.Name) == 0 || len(campaign.Name) > 20 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "活动名称长度必须在1-20之间",
+		})
+		return
+	}
+	if campaign.CodeCount <= 0 || campaign.CodeCount > 10000 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "活动兑换码个数必须在1-10000之间",
+		})
+		return
+	}
+	if campaign.MaxUses == 0 {
+		campaign.MaxUses = 1
+	}
+	if message := validateRedemptionGrant(campaign.MaxUses, campaign.Group, campaign.GroupDuration); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	if campaign.Quota <= 0 && campaign.Group == "" && !campaign.TokenEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "活动至少需要发放额度、分组或令牌中的一项",
+		})
+		return
+	}
+	cleanCampaign := model.RedemptionCampaign{
+		UserId:           c.GetInt("id"),
+		Name:             campaign.Name,
+		Description:      campaign.Description,
+		CreatedTime:      common.GetTimestamp(),
+		ExpiredTime:      campaign.ExpiredTime,
+		CodeCount:        campaign.CodeCount,
+		MaxUses:          campaign.MaxUses,
+		Quota:            campaign.Quota,
+		Group:            campaign.Group,
+		GroupDuration:    campaign.GroupDuration,
+		TokenEnabled:     campaign.TokenEnabled,
+		TokenQuota:       campaign.TokenQuota,
+		TokenModelLimits: campaign.TokenModelLimits,
+	}
+	keys, err := cleanCampaign.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"campaign": cleanCampaign,
+			"keys":     keys,
+		},
+	})
+	return
+}
+
+func DeleteRedemptionCampaign(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteRedemptionCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func GetRedemptionCampaignStat(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	stat, err := model.GetRedemptionCampaignStat(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stat,
+	})
+	return
+}
+
+func ExportRedemptionCampaign(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	redemptions, err := model.GetRedemptionsByCampaignId(campaign.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=redemption-campaign-%d.csv", campaign.Id))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "key", "name", "status", "quota", "max_uses", "used_count", "expired_time", "created_time"})
+	for _, redemption := range redemptions {
+		expiredTime := ""
+		if redemption.ExpiredTime != 0 {
+			expiredTime = time.Unix(redemption.ExpiredTime, 0).Format("2006-01-02 15:04:05")
+		}
+		_ = writer.Write([]string{
+			strconv.Itoa(redemption.Id),
+			escapeCSVCell(redemption.Key),
+			escapeCSVCell(redemption.Name),
+			strconv.Itoa(redemption.Status),
+			strconv.Itoa(redemption.Quota),
+			strconv.Itoa(redemption.MaxUses),
+			strconv.Itoa(redemption.UsedCount),
+			expiredTime,
+			time.Unix(redemption.CreatedTime, 0).Format("2006-01-02 15:04:05"),
+		})
+	}
+	writer.Flush()
+}
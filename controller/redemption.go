@@ -105,15 +105,32 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
+	if redemption.MaxUses == 0 {
+		redemption.MaxUses = 1
+	}
+	if message := validateRedemptionGrant(redemption.MaxUses, redemption.Group, redemption.GroupDuration); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
 	var keys []string
 	for i := 0; i < redemption.Count; i++ {
 		key := common.GetUUID()
 		cleanRedemption := model.Redemption{
-			UserId:      c.GetInt("id"),
-			Name:        redemption.Name,
-			Key:         key,
-			CreatedTime: common.GetTimestamp(),
-			Quota:       redemption.Quota,
+			UserId:           c.GetInt("id"),
+			Name:             redemption.Name,
+			Key:              key,
+			CreatedTime:      common.GetTimestamp(),
+			Quota:            redemption.Quota,
+			ExpiredTime:      redemption.ExpiredTime,
+			MaxUses:          redemption.MaxUses,
+			Group:            redemption.Group,
+			GroupDuration:    redemption.GroupDuration,
+			TokenEnabled:     redemption.TokenEnabled,
+			TokenQuota:       redemption.TokenQuota,
+			TokenModelLimits: redemption.TokenModelLimits,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
@@ -126,6 +143,14 @@ func AddRedemption(c *gin.Context) {
 		}
 		keys = append(keys, key)
 	}
+	setAuditEvent(c, "redemption.create", "redemption", "", nil, gin.H{
+		"name":         redemption.Name,
+		"count":        redemption.Count,
+		"quota":        redemption.Quota,
+		"max_uses":     redemption.MaxUses,
+		"group":        redemption.Group,
+		"expired_time": redemption.ExpiredTime,
+	})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -136,6 +161,7 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetRedemptionById(id)
 	err := model.DeleteRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -144,6 +170,7 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "redemption.delete", "redemption", id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -170,12 +197,34 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	origin := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
+		if redemption.MaxUses == 0 {
+			redemption.MaxUses = 1
+		}
+		if message := validateRedemptionGrant(redemption.MaxUses, redemption.Group, redemption.GroupDuration); message != "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": message,
+			})
+			return
+		}
 		// If you add more fields, please also update redemption.Update()
 		cleanRedemption.Name = redemption.Name
 		cleanRedemption.Quota = redemption.Quota
+		cleanRedemption.ExpiredTime = redemption.ExpiredTime
+		cleanRedemption.MaxUses = redemption.MaxUses
+		cleanRedemption.Group = redemption.Group
+		cleanRedemption.GroupDuration = redemption.GroupDuration
+		cleanRedemption.TokenEnabled = redemption.TokenEnabled
+		cleanRedemption.TokenQuota = redemption.TokenQuota
+		cleanRedemption.TokenModelLimits = redemption.TokenModelLimits
+		// 可使用次数调低到已使用次数及以下时，兑换码视为已用完
+		if cleanRedemption.MaxUses != -1 && cleanRedemption.UsedCount >= cleanRedemption.MaxUses {
+			cleanRedemption.Status = common.RedemptionCodeStatusUsed
+		}
 	}
 	err = cleanRedemption.Update()
 	if err != nil {
@@ -185,6 +234,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "redemption.update", "redemption", cleanRedemption.Id, origin, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -192,3 +242,18 @@ func UpdateRedemption(c *gin.Context) {
 	})
 	return
 }
+
+func validateRedemptionGrant(maxUses int, group string, groupDuration int64) string {
+	if maxUses < -1 {
+		return "兑换码可使用次数必须大于0，或为-1表示不限次数"
+	}
+	if group != "" {
+		if _, ok := common.GroupRatio[group]; !ok {
+			return "分组不存在：" + group
+		}
+	}
+	if groupDuration < 0 {
+		return "分组升级时长不能为负数"
+	}
+	return ""
+}
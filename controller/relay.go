@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"io"
 	"log"
 	"net/http"
@@ -17,6 +19,7 @@ import (
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
 	"strings"
+	"time"
 )
 
 func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
@@ -53,12 +56,33 @@ func Relay(c *gin.Context) {
 			break
 		}
 
+		span, endSpan := common.StartSpan(c, "relay.attempt",
+			attribute.Int("relay.attempt", i),
+			attribute.Int("channel.id", channel.Id),
+			attribute.Int("channel.type", channel.Type),
+			attribute.String("model", originalModel),
+		)
+		attemptStart := time.Now()
 		openaiErr = relayRequest(c, relayMode, channel)
+		if openaiErr != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", openaiErr.StatusCode))
+			span.SetStatus(codes.Error, openaiErr.Error.Message)
+		}
+		endSpan()
+		// 本地错误（如额度不足）未发往上游，不计入渠道统计
+		if openaiErr == nil {
+			model.RecordAnalyticsRequest(channel.Id, originalModel, c.Writer.Status(), time.Since(attemptStart))
+			service.RecordChannelRelayResult(channel.Id, channel.Name, false)
+		} else if !openaiErr.LocalError {
+			model.RecordAnalyticsRequest(channel.Id, originalModel, openaiErr.StatusCode, time.Since(attemptStart))
+			service.RecordChannelRelayResult(channel.Id, channel.Name, true)
+		}
 
 		if openaiErr == nil {
 			return // 成功处理请求，直接返回
 		}
 
+		recordRelayErrorLog(c, channel.Id, i, openaiErr, time.Since(attemptStart))
 		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
@@ -82,6 +106,27 @@ func Relay(c *gin.Context) {
 	}
 }
 
+// recordRelayErrorLog 将失败的转发尝试记录为错误日志，便于按请求 ID 还原重试过程
+func recordRelayErrorLog(c *gin.Context, channelId int, attempt int, err *dto.OpenAIErrorWithStatusCode, useTime time.Duration) {
+	other := make(map[string]interface{})
+	other["attempt"] = attempt
+	other["status_code"] = err.StatusCode
+	other["error_type"] = err.Error.Type
+	if err.Error.Code != nil {
+		other["error_code"] = fmt.Sprintf("%v", err.Error.Code)
+	}
+	other["local_error"] = err.LocalError
+	other["use_time_ms"] = useTime.Milliseconds()
+	adminInfo := make(map[string]interface{})
+	adminInfo["use_channel"] = c.GetStringSlice("use_channel")
+	// 上游返回的错误信息可能包含渠道地址等内部信息，只对管理员可见
+	adminInfo["error_message"] = err.Error.Message
+	other["admin_info"] = adminInfo
+	content := fmt.Sprintf("请求失败，状态码 %d", err.StatusCode)
+	model.RecordErrorLog(c, c.GetInt("id"), channelId, c.GetString("original_model"), c.GetString("token_name"),
+		c.GetInt("token_id"), content, int(useTime.Seconds()), other)
+}
+
 func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
 	addUsedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
@@ -172,6 +217,7 @@ func processChannelError(c *gin.Context, channelId int, channelType int, channel
 func RelayMidjourney(c *gin.Context) {
 	relayMode := c.GetInt("relay_mode")
 	var err *dto.MidjourneyResponse
+	start := time.Now()
 	switch relayMode {
 	case relayconstant.RelayModeMidjourneyNotify:
 		err = relay.RelayMidjourneyNotify(c)
@@ -186,18 +232,37 @@ func RelayMidjourney(c *gin.Context) {
 	}
 	//err = relayMidjourneySubmit(c, relayMode)
 	log.Println(err)
+	// 查询类接口不选择渠道，channel_id 为 0 时不计入统计
+	channelId := c.GetInt("channel_id")
+	if err == nil {
+		model.RecordAnalyticsRequest(channelId, c.GetString("original_model"), http.StatusOK, time.Since(start))
+		if channelId != 0 {
+			service.RecordChannelRelayResult(channelId, c.GetString("channel_name"), false)
+		}
+	}
 	if err != nil {
 		statusCode := http.StatusBadRequest
 		if err.Code == 30 {
 			err.Result = "当前分组负载已饱和，请稍后再试，或升级账户以提升服务质量。"
 			statusCode = http.StatusTooManyRequests
 		}
+		model.RecordAnalyticsRequest(channelId, c.GetString("original_model"), statusCode, time.Since(start))
+		if channelId != 0 {
+			service.RecordChannelRelayResult(channelId, c.GetString("channel_name"), true)
+		}
+		recordRelayErrorLog(c, channelId, 0, &dto.OpenAIErrorWithStatusCode{
+			Error: dto.OpenAIError{
+				Message: fmt.Sprintf("%s %s", err.Description, err.Result),
+				Type:    "upstream_error",
+				Code:    err.Code,
+			},
+			StatusCode: statusCode,
+		}, time.Since(start))
 		c.JSON(statusCode, gin.H{
 			"description": fmt.Sprintf("%s %s", err.Description, err.Result),
 			"type":        "upstream_error",
 			"code":        err.Code,
 		})
-		channelId := c.GetInt("channel_id")
 		common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code %d): %s", channelId, statusCode, fmt.Sprintf("%s %s", err.Description, err.Result)))
 	}
 }
@@ -233,9 +298,12 @@ func RelayTask(c *gin.Context) {
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
 	c.Set("use_channel", []string{fmt.Sprintf("%d", channelId)})
+	attemptStart := time.Now()
 	taskErr := taskRelayHandler(c, relayMode)
 	if taskErr == nil {
 		retryTimes = 0
+	} else {
+		recordTaskRelayErrorLog(c, channelId, 0, taskErr, time.Since(attemptStart))
 	}
 	for i := 0; shouldRetryTaskRelay(c, channelId, taskErr, retryTimes) && i < retryTimes; i++ {
 		channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, i)
@@ -252,7 +320,11 @@ func RelayTask(c *gin.Context) {
 
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		attemptStart = time.Now()
 		taskErr = taskRelayHandler(c, relayMode)
+		if taskErr != nil {
+			recordTaskRelayErrorLog(c, channelId, i+1, taskErr, time.Since(attemptStart))
+		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
@@ -267,13 +339,34 @@ func RelayTask(c *gin.Context) {
 	}
 }
 
+func recordTaskRelayErrorLog(c *gin.Context, channelId int, attempt int, err *dto.TaskError, useTime time.Duration) {
+	recordRelayErrorLog(c, channelId, attempt, &dto.OpenAIErrorWithStatusCode{
+		Error: dto.OpenAIError{
+			Message: err.Message,
+			Type:    "upstream_error",
+			Code:    err.Code,
+		},
+		StatusCode: err.StatusCode,
+		LocalError: err.LocalError,
+	}, useTime)
+}
+
 func taskRelayHandler(c *gin.Context, relayMode int) *dto.TaskError {
 	var err *dto.TaskError
 	switch relayMode {
 	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID:
 		err = relay.RelayTaskFetch(c, relayMode)
 	default:
+		start := time.Now()
 		err = relay.RelayTaskSubmit(c, relayMode)
+		// 本地错误（如额度不足）未发往上游，不计入渠道统计
+		if err == nil {
+			model.RecordAnalyticsRequest(c.GetInt("channel_id"), c.GetString("original_model"), http.StatusOK, time.Since(start))
+			service.RecordChannelRelayResult(c.GetInt("channel_id"), c.GetString("channel_name"), false)
+		} else if !err.LocalError {
+			model.RecordAnalyticsRequest(c.GetInt("channel_id"), c.GetString("original_model"), err.StatusCode, time.Since(start))
+			service.RecordChannelRelayResult(c.GetInt("channel_id"), c.GetString("channel_name"), true)
+		}
 	}
 	return err
 }
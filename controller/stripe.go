@@ -1,14 +1,17 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/checkout/session"
 	"github.com/stripe/stripe-go/v76/webhook"
 	"io"
 	"log"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 	"strings"
 )
@@ -36,6 +39,10 @@ func StripeWebhook(c *gin.Context) {
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeChargeRefunded:
+		chargeRefunded(event)
+	case stripe.EventTypeChargeDisputeCreated:
+		chargeDisputeCreated(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
@@ -52,7 +59,8 @@ func sessionCompleted(event stripe.Event) {
 		return
 	}
 
-	err := model.Recharge(referenceId, customerId)
+	paymentIntent := event.GetObjectValue("payment_intent")
+	err := model.Recharge(referenceId, customerId, paymentIntent)
 	if err != nil {
 		log.Println(err.Error(), referenceId)
 		return
@@ -61,6 +69,9 @@ func sessionCompleted(event stripe.Event) {
 	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
 	currency := strings.ToUpper(event.GetObjectValue("currency"))
 	log.Printf("收到款项：%s, %.2f(%s)", referenceId, total/100, currency)
+	service.SendAlert(common.AlertEventPaymentReceived, referenceId, "收到款项",
+		fmt.Sprintf("订单 %s 支付成功，金额 %.2f %s", referenceId, total/100, currency),
+		map[string]any{"trade_no": referenceId, "amount": total / 100, "currency": currency})
 }
 
 func sessionExpired(event stripe.Event) {
@@ -95,3 +106,70 @@ func sessionExpired(event stripe.Event) {
 
 	log.Println("充值订单已过期", referenceId)
 }
+
+// getLegacyStripeTradeNo 早于记录支付交易号的订单没有 payment_id，
+// 通过该交易对应 Checkout Session 的 client_reference_id 找回订单号
+func getLegacyStripeTradeNo(paymentIntent string) string {
+	if model.TopUpExistsByPaymentId(paymentIntent) {
+		return ""
+	}
+	stripe.Key = common.StripeApiSecret
+	params := &stripe.CheckoutSessionListParams{
+		PaymentIntent: stripe.String(paymentIntent),
+	}
+	params.Limit = stripe.Int64(1)
+	iter := session.List(params)
+	if iter.Next() {
+		return iter.CheckoutSession().ClientReferenceID
+	}
+	if err := iter.Err(); err != nil {
+		log.Println("查询Stripe Checkout Session失败:", err.Error(), ",", paymentIntent)
+	}
+	return ""
+}
+
+func chargeRefunded(event stripe.Event) {
+	paymentIntent := event.GetObjectValue("payment_intent")
+	if "" == paymentIntent {
+		log.Println("退款事件未提供支付交易号")
+		return
+	}
+
+	amount, _ := strconv.ParseFloat(event.GetObjectValue("amount"), 64)
+	refunded, _ := strconv.ParseFloat(event.GetObjectValue("amount_refunded"), 64)
+	if amount <= 0 {
+		log.Println("错误的Stripe退款金额:", amount, ",", paymentIntent)
+		return
+	}
+
+	currency := strings.ToUpper(event.GetObjectValue("currency"))
+	reason := fmt.Sprintf("在线充值退款，累计退款金额：%.2f(%s)", refunded/100, currency)
+	err := model.ReverseTopUp(paymentIntent, getLegacyStripeTradeNo(paymentIntent), refunded/amount, common.TopUpStatusRefunded, reason)
+	if err != nil {
+		log.Println(err.Error(), paymentIntent)
+		return
+	}
+
+	log.Printf("收到退款：%s, %.2f(%s)", paymentIntent, refunded/100, currency)
+}
+
+func chargeDisputeCreated(event stripe.Event) {
+	paymentIntent := event.GetObjectValue("payment_intent")
+	if "" == paymentIntent {
+		log.Println("争议事件未提供支付交易号")
+		return
+	}
+
+	total, _ := strconv.ParseFloat(event.GetObjectValue("amount"), 64)
+	currency := strings.ToUpper(event.GetObjectValue("currency"))
+	disputeReason := event.GetObjectValue("reason")
+	reason := fmt.Sprintf("在线充值发生争议（%s），争议金额：%.2f(%s)", disputeReason, total/100, currency)
+	// 争议期间资金已被冻结，因此扣回整笔充值
+	err := model.ReverseTopUp(paymentIntent, getLegacyStripeTradeNo(paymentIntent), 1, common.TopUpStatusDisputed, reason)
+	if err != nil {
+		log.Println(err.Error(), paymentIntent)
+		return
+	}
+
+	log.Printf("收到争议：%s, %.2f(%s)", paymentIntent, total/100, currency)
+}
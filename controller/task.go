@@ -26,6 +26,7 @@ func UpdateTaskBulk() {
 		time.Sleep(time.Duration(15) * time.Second)
 		ctx := context.TODO()
 		allTasks := model.GetAllUnFinishSyncTasks(500)
+		common.SetTaskQueueSize("task", len(allTasks))
 		if len(allTasks) == 0 {
 			continue
 		}
@@ -86,7 +87,7 @@ func UpdateSunoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM
 	for channelId, taskIds := range taskChannelM {
 		err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
 		if err != nil {
-			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %d", channelId, err.Error()))
+			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
 		}
 	}
 	return nil
@@ -162,7 +163,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 			} else {
 				quota := task.Quota
 				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota)
+					err = model.IncreaseBillingQuota(task.UserId, task.OrgId, quota)
 					if err != nil {
 						common.LogError(ctx, "fail to increase user quota: "+err.Error())
 					}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	relayconstant "one-api/relay/constant"
 	"strconv"
+	"strings"
 )
 
 func GetAllTokens(c *gin.Context) {
@@ -125,8 +127,33 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if _, err = common.ParseIpAllowList(token.AllowIps); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "IP 白名单格式错误：" + err.Error(),
+		})
+		return
+	}
+	if err = relayconstant.CheckEndpointScopes(token.EndpointScopes); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if token.OrgId != 0 {
+		org, err := model.GetOrganizationById(token.OrgId)
+		if err != nil || org.Status != common.OrganizationStatusEnabled || !model.IsOrganizationMember(token.OrgId, c.GetInt("id")) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "组织不存在或已被禁用，或者你不是该组织的成员",
+			})
+			return
+		}
+	}
 	cleanToken := model.Token{
 		UserId:             c.GetInt("id"),
+		OrgId:              token.OrgId,
 		Name:               token.Name,
 		Key:                common.GenerateKey(),
 		CreatedTime:        common.GetTimestamp(),
@@ -136,6 +163,8 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota:     token.UnlimitedQuota,
 		ModelLimitsEnabled: token.ModelLimitsEnabled,
 		ModelLimits:        token.ModelLimits,
+		AllowIps:           strings.TrimSpace(token.AllowIps),
+		EndpointScopes:     strings.TrimSpace(token.EndpointScopes),
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -145,9 +174,14 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	auditToken := cleanToken
+	auditToken.Key = ""
+	setAuditEvent(c, "token.create", "token", cleanToken.Id, nil, auditToken)
+	// 令牌明文只在创建时返回一次
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    cleanToken,
 	})
 	return
 }
@@ -155,6 +189,7 @@ func AddToken(c *gin.Context) {
 func DeleteToken(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	userId := c.GetInt("id")
+	origin, _ := model.GetTokenByIds(id, userId)
 	err := model.DeleteTokenById(id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -163,6 +198,7 @@ func DeleteToken(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "token.delete", "token", id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -189,6 +225,20 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if _, err = common.ParseIpAllowList(token.AllowIps); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "IP 白名单格式错误：" + err.Error(),
+		})
+		return
+	}
+	if err = relayconstant.CheckEndpointScopes(token.EndpointScopes); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -213,6 +263,7 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	origin := *cleanToken
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -223,6 +274,8 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.ModelLimitsEnabled = token.ModelLimitsEnabled
 		cleanToken.ModelLimits = token.ModelLimits
+		cleanToken.AllowIps = strings.TrimSpace(token.AllowIps)
+		cleanToken.EndpointScopes = strings.TrimSpace(token.EndpointScopes)
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -232,6 +285,7 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "token.update", "token", cleanToken.Id, origin, cleanToken)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
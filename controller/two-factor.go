@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 密码校验通过后等待输入验证码的有效期
+	twoFactorPendingSeconds = 5 * 60
+	// 敏感操作验证通过后免重复验证的时长
+	twoFactorReauthSeconds = 5 * 60
+	// 每个用户每 5 分钟最多尝试 10 次验证码
+	twoFactorMaxAttempts     = 10
+	twoFactorAttemptDuration = 5 * 60
+)
+
+var twoFactorRateLimiter common.InMemoryRateLimiter
+
+type TwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// verifyTwoFactorCode 在校验前限制尝试次数，防止 6 位验证码被暴力猜测
+func verifyTwoFactorCode(userId int, code string) error {
+	twoFactorRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+	if !twoFactorRateLimiter.Request(fmt.Sprintf("2fa:%d", userId), twoFactorMaxAttempts, twoFactorAttemptDuration) {
+		return fmt.Errorf("验证码尝试次数过多，请稍后再试")
+	}
+	return model.VerifyTwoFactorCode(userId, code)
+}
+
+// setupLogin 启用了两步验证的用户先进入待验证状态，验证通过后才写入登录会话
+func setupLogin(user *model.User, c *gin.Context) {
+	if !model.IsTwoFactorEnabled(user.Id) {
+		setupLoginSession(user, c)
+		return
+	}
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("pending_2fa_id", user.Id)
+	session.Set("pending_2fa_time", common.GetTimestamp())
+	err := session.Save()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无法保存会话信息，请重试",
+			"success": false,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "",
+		"success": true,
+		"data": gin.H{
+			"require_2fa": true,
+		},
+	})
+}
+
+// LoginTwoFactor 登录的第二步，校验 TOTP 验证码或恢复码
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	session := sessions.Default(c)
+	id, _ := session.Get("pending_2fa_id").(int)
+	pendingTime, _ := session.Get("pending_2fa_time").(int64)
+	if id == 0 || common.GetTimestamp()-pendingTime > twoFactorPendingSeconds {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "登录状态已过期，请重新登录",
+			"success": false,
+		})
+		return
+	}
+	err = verifyTwoFactorCode(id, req.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	user := model.User{
+		Id: id,
+	}
+	err = user.FillUserById()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	session.Delete("pending_2fa_id")
+	session.Delete("pending_2fa_time")
+	session.Set("2fa_verified_time", common.GetTimestamp())
+	setupLoginSession(&user, c)
+}
+
+// checkTwoFactorReauth 敏感操作前要求重新输入验证码，通过 New-Api-2FA-Code 请求头提交
+// 未启用两步验证的用户不受影响；会话登录验证通过后 twoFactorReauthSeconds 内免重复验证，
+// 使用 access token 调用时没有会话，每次都需要提交验证码。返回 false 时已写入响应
+func checkTwoFactorReauth(c *gin.Context) bool {
+	id := c.GetInt("id")
+	if !model.IsTwoFactorEnabled(id) {
+		return true
+	}
+	useAccessToken := c.GetBool("use_access_token")
+	session := sessions.Default(c)
+	if !useAccessToken {
+		verifiedTime, _ := session.Get("2fa_verified_time").(int64)
+		if common.GetTimestamp()-verifiedTime <= twoFactorReauthSeconds {
+			return true
+		}
+	}
+	code := c.Request.Header.Get("New-Api-2FA-Code")
+	if code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该操作需要进行两步验证",
+			"data": gin.H{
+				"require_2fa": true,
+			},
+		})
+		return false
+	}
+	err := verifyTwoFactorCode(id, code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data": gin.H{
+				"require_2fa": true,
+			},
+		})
+		return false
+	}
+	if !useAccessToken {
+		session.Set("2fa_verified_time", common.GetTimestamp())
+		_ = session.Save()
+	}
+	return true
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	id := c.GetInt("id")
+	data := gin.H{
+		"enabled":  false,
+		"required": common.AdminTwoFactorEnabled && c.GetInt("role") >= common.RoleAdminUser,
+	}
+	twoFactor, err := model.GetTwoFactorByUserId(id)
+	if err == nil && twoFactor.Enabled {
+		data["enabled"] = true
+		data["enabled_time"] = twoFactor.EnabledTime
+		data["recovery_codes_remaining"] = twoFactor.RemainingRecoveryCodes()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+	return
+}
+
+// SetupTwoFactor 生成密钥与 otpauth 地址，前端据此渲染二维码
+func SetupTwoFactor(c *gin.Context) {
+	id := c.GetInt("id")
+	username, err := model.GetUsernameById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	secret, err := model.SetupTwoFactor(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": secret,
+			"uri":    common.TOTPURI(secret, username),
+		},
+	})
+	return
+}
+
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	codes, err := model.EnableTwoFactor(c.GetInt("id"), req.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	session := sessions.Default(c)
+	session.Set("2fa_verified_time", common.GetTimestamp())
+	_ = session.Save()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    codes,
+	})
+	return
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if common.AdminTwoFactorEnabled && c.GetInt("role") >= common.RoleAdminUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员必须启用两步验证，无法关闭",
+		})
+		return
+	}
+	id := c.GetInt("id")
+	err = verifyTwoFactorCode(id, req.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.DeleteTwoFactor(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	id := c.GetInt("id")
+	err = verifyTwoFactorCode(id, req.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	codes, err := model.RegenerateRecoveryCodes(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    codes,
+	})
+	return
+}
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用量导出，format 为 csv（默认）或 jsonl，group_by 为空时逐条导出，为 day 或 model 时导出汇总结果。
+// 费用按 QuotaPerUnit 与 UsageExportExchangeRate 换算为 UsageExportCurrency 币种，currency 列注明币种。
+
+const usageExportFlushRows = 100
+
+type usageExporter struct {
+	format  string
+	columns []string
+	writer  gin.ResponseWriter
+	csv     *csv.Writer
+	encoder *json.Encoder
+	rows    int
+}
+
+func newUsageExporter(c *gin.Context, format string, name string, columns []string) *usageExporter {
+	exporter := &usageExporter{
+		format:  format,
+		columns: columns,
+		writer:  c.Writer,
+	}
+	fileName := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	if format == "jsonl" {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+		c.Status(http.StatusOK)
+		exporter.encoder = json.NewEncoder(c.Writer)
+		return exporter
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	// 写入 BOM，避免 Excel 打开时中文乱码
+	_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	exporter.csv = csv.NewWriter(c.Writer)
+	_ = exporter.csv.Write(columns)
+	return exporter
+}
+
+func (e *usageExporter) write(values ...any) error {
+	var err error
+	if e.format == "jsonl" {
+		row := make(map[string]any, len(e.columns))
+		for i, column := range e.columns {
+			row[column] = values[i]
+		}
+		err = e.encoder.Encode(row)
+	} else {
+		record := make([]string, len(values))
+		for i, value := range values {
+			switch v := value.(type) {
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', 6, 64)
+			case string:
+				record[i] = escapeCSVCell(v)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		err = e.csv.Write(record)
+	}
+	if err != nil {
+		return err
+	}
+	e.rows++
+	if e.rows%usageExportFlushRows == 0 {
+		e.flush()
+	}
+	return nil
+}
+
+func (e *usageExporter) flush() {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	e.writer.Flush()
+}
+
+func quotaToCost(quota int64) float64 {
+	return float64(quota) / common.QuotaPerUnit * common.UsageExportExchangeRate
+}
+
+// 以 = + - @ 等开头的单元格会被表格软件当作公式执行，加上单引号前缀使其按文本显示
+func escapeCSVCell(cell string) string {
+	if cell == "" {
+		return cell
+	}
+	switch cell[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + cell
+	}
+	return cell
+}
+
+func formatExportTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+// 在开始写入响应前校验参数，之后的错误只能中断导出
+func parseUsageExportParams(c *gin.Context) (format string, groupBy string, ok bool) {
+	format = c.DefaultQuery("format", "csv")
+	groupBy = c.Query("group_by")
+	if format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "导出格式只能为 csv 或 jsonl",
+		})
+		return "", "", false
+	}
+	if groupBy != "" && groupBy != "day" && groupBy != "model" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "汇总方式只能为 day 或 model",
+		})
+		return "", "", false
+	}
+	return format, groupBy, true
+}
+
+func parseUsageExportFilter(c *gin.Context) *model.UsageExportFilter {
+	filter := &model.UsageExportFilter{
+		ModelName: c.Query("model_name"),
+		TokenName: c.Query("token_name"),
+	}
+	filter.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	filter.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return filter
+}
+
+func ExportAllLogs(c *gin.Context) {
+	filter := parseUsageExportFilter(c)
+	filter.Username = c.Query("username")
+	filter.Channel, _ = strconv.Atoi(c.Query("channel"))
+	setAuditEvent(c, "log.export", "log", "", nil, c.Request.URL.RawQuery)
+	exportConsumeLogs(c, filter, true)
+}
+
+func ExportUserLogs(c *gin.Context) {
+	filter := parseUsageExportFilter(c)
+	filter.UserId = c.GetInt("id")
+	exportConsumeLogs(c, filter, false)
+}
+
+func exportConsumeLogs(c *gin.Context, filter *model.UsageExportFilter, isAdmin bool) {
+	format, groupBy, ok := parseUsageExportParams(c)
+	if !ok {
+		return
+	}
+	if groupBy != "" {
+		aggregates, err := model.AggregateConsumeLogs(filter, groupBy)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		exporter := newUsageExporter(c, format, "usage-by-"+groupBy, []string{groupBy, "count", "prompt_tokens", "completion_tokens", "quota", "cost", "currency"})
+		for _, aggregate := range aggregates {
+			err = exporter.write(formatUsageAggregateKey(aggregate.Key, groupBy), aggregate.Count, aggregate.PromptTokens,
+				aggregate.CompletionTokens, aggregate.Quota, quotaToCost(aggregate.Quota), common.UsageExportCurrency)
+			if err != nil {
+				break
+			}
+		}
+		exporter.flush()
+		return
+	}
+
+	columns := []string{"id", "created_at", "request_id", "username", "token_name", "model_name", "prompt_tokens", "completion_tokens", "quota", "cost", "currency", "use_time", "is_stream"}
+	if isAdmin {
+		columns = append(columns, "channel")
+	}
+	exporter := newUsageExporter(c, format, "usage-logs", columns)
+	err := model.ExportConsumeLogs(c.Request.Context(), filter, func(log *model.Log) error {
+		values := []any{log.Id, formatExportTime(log.CreatedAt), log.RequestId, log.Username, log.TokenName, log.ModelName,
+			log.PromptTokens, log.CompletionTokens, log.Quota, quotaToCost(int64(log.Quota)), common.UsageExportCurrency, log.UseTime, log.IsStream}
+		if isAdmin {
+			values = append(values, log.ChannelId)
+		}
+		return exporter.write(values...)
+	})
+	exporter.flush()
+	if err != nil {
+		common.LogError(c, "failed to export logs: "+err.Error())
+	}
+}
+
+func ExportAllQuotaData(c *gin.Context) {
+	filter := parseUsageExportFilter(c)
+	filter.Username = c.Query("username")
+	setAuditEvent(c, "data.export", "quota_data", "", nil, c.Request.URL.RawQuery)
+	exportQuotaData(c, filter)
+}
+
+func ExportUserQuotaData(c *gin.Context) {
+	filter := parseUsageExportFilter(c)
+	filter.UserId = c.GetInt("id")
+	exportQuotaData(c, filter)
+}
+
+func exportQuotaData(c *gin.Context, filter *model.UsageExportFilter) {
+	format, groupBy, ok := parseUsageExportParams(c)
+	if !ok {
+		return
+	}
+	if groupBy != "" {
+		aggregates, err := model.AggregateQuotaData(filter, groupBy)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		exporter := newUsageExporter(c, format, "usage-data-by-"+groupBy, []string{groupBy, "count", "token_used", "quota", "cost", "currency"})
+		for _, aggregate := range aggregates {
+			err = exporter.write(formatUsageAggregateKey(aggregate.Key, groupBy), aggregate.Count, aggregate.TokenUsed,
+				aggregate.Quota, quotaToCost(aggregate.Quota), common.UsageExportCurrency)
+			if err != nil {
+				break
+			}
+		}
+		exporter.flush()
+		return
+	}
+
+	exporter := newUsageExporter(c, format, "usage-data", []string{"created_at", "username", "model_name", "count", "token_used", "quota", "cost", "currency"})
+	err := model.ExportQuotaData(c.Request.Context(), filter, func(data *model.QuotaData) error {
+		return exporter.write(formatExportTime(data.CreatedAt), data.Username, data.ModelName, data.Count, data.TokenUsed,
+			data.Quota, quotaToCost(int64(data.Quota)), common.UsageExportCurrency)
+	})
+	exporter.flush()
+	if err != nil {
+		common.LogError(c, "failed to export quota data: "+err.Error())
+	}
+}
+
+// 按天汇总的键为当天零点的时间戳
+func formatUsageAggregateKey(key string, groupBy string) string {
+	if groupBy != "day" {
+		return key
+	}
+	timestamp, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return key
+	}
+	return time.Unix(timestamp, 0).Format("2006-01-02")
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"encoding/csv"
+	"math"
+	"net/http/httptest"
+	"one-api/common"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEscapeCSVCell(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"gpt-4o", "gpt-4o"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cell, func(t *testing.T) {
+			if got := escapeCSVCell(tt.cell); got != tt.want {
+				t.Errorf("escapeCSVCell(%q) = %q, want %q", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
+
+// 只有字符串单元格需要转义，负数等数值保持原样
+func TestUsageExporterEscapesStringCells(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	exporter := newUsageExporter(c, "csv", "usage", []string{"token_name", "quota", "cost"})
+	if err := exporter.write("=cmd|' /C calc'!A0", -5, 0.5); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	exporter.flush()
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(recorder.Body.String(), "\xEF\xBB\xBF"))).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	want := []string{"'=cmd|' /C calc'!A0", "-5", "0.500000"}
+	if len(records) != 2 || strings.Join(records[1], ",") != strings.Join(want, ",") {
+		t.Errorf("records = %q, want row %q", records, want)
+	}
+}
+
+func TestQuotaToCost(t *testing.T) {
+	quotaPerUnit, exchangeRate := common.QuotaPerUnit, common.UsageExportExchangeRate
+	t.Cleanup(func() {
+		common.QuotaPerUnit, common.UsageExportExchangeRate = quotaPerUnit, exchangeRate
+	})
+	tests := []struct {
+		name         string
+		quotaPerUnit float64
+		exchangeRate float64
+		quota        int64
+		want         float64
+	}{
+		{"zero", 500000, 1, 0, 0},
+		{"one unit", 500000, 1, 500000, 1},
+		{"fraction", 500000, 1, 1250, 0.0025},
+		{"exchange rate", 500000, 7.2, 250000, 3.6},
+		{"custom quota per unit", 1000, 1, 1500, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.QuotaPerUnit, common.UsageExportExchangeRate = tt.quotaPerUnit, tt.exchangeRate
+			if got := quotaToCost(tt.quota); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("quotaToCost(%d) = %v, want %v", tt.quota, got, tt.want)
+			}
+		})
+	}
+}
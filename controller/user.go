@@ -60,7 +60,7 @@ func Login(c *gin.Context) {
 }
 
 // setup session & cookies and then return user info
-func setupLogin(user *model.User, c *gin.Context) {
+func setupLoginSession(user *model.User, c *gin.Context) {
 	session := sessions.Default(c)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
@@ -253,8 +253,7 @@ func GetUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if !model.CanManageUser(c.GetInt("id"), c.GetInt("role"), user.Id, user.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权获取同级或更高等级用户的信息",
@@ -270,6 +269,9 @@ func GetUser(c *gin.Context) {
 }
 
 func GenerateAccessToken(c *gin.Context) {
+	if rejectPersonalAccessToken(c) || !checkTwoFactorReauth(c) {
+		return
+	}
 	id := c.GetInt("id")
 	user, err := model.GetUserById(id, true)
 	if err != nil {
@@ -437,15 +439,16 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	myId := c.GetInt("id")
 	myRole := c.GetInt("role")
-	if myRole <= originUser.Role && myRole != common.RoleRootUser {
+	if !model.CanManageUser(myId, myRole, originUser.Id, originUser.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
 		})
 		return
 	}
-	if myRole <= updatedUser.Role && myRole != common.RoleRootUser {
+	if !model.CanManageUser(myId, myRole, originUser.Id, updatedUser.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权将其他用户权限等级提升到大于等于自己的权限等级",
@@ -466,6 +469,9 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	if user, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		setAuditEvent(c, "user.update", "user", updatedUser.Id, originUser, user)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -537,8 +543,7 @@ func HardDeleteUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role {
+	if originUser.Role == common.RoleRootUser || !model.CanManageUser(c.GetInt("id"), c.GetInt("role"), originUser.Id, originUser.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权删除同权限等级或更高权限等级的用户",
@@ -553,6 +558,7 @@ func HardDeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "user.delete", "user", id, originUser, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -616,8 +622,7 @@ func CreateUser(c *gin.Context) {
 	if user.DisplayName == "" {
 		user.DisplayName = user.Username
 	}
-	myRole := c.GetInt("role")
-	if user.Role >= myRole {
+	if !model.CanManageUser(c.GetInt("id"), c.GetInt("role"), 0, user.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无法创建权限大于等于自己的用户",
@@ -637,6 +642,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "user.create", "user", cleanUser.Id, nil, cleanUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -652,6 +658,9 @@ type ManageRequest struct {
 
 // ManageUser Only admin user can do this
 func ManageUser(c *gin.Context) {
+	if !checkTwoFactorReauth(c) {
+		return
+	}
 	var req ManageRequest
 	err := json.NewDecoder(c.Request.Body).Decode(&req)
 
@@ -675,13 +684,14 @@ func ManageUser(c *gin.Context) {
 		return
 	}
 	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if !model.CanManageUser(c.GetInt("id"), myRole, user.Id, user.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
 		})
 		return
 	}
+	origin := user
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -741,6 +751,14 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = common.RoleCommonUser
+	case "reset_2fa":
+		if err := model.DeleteTwoFactor(user.Id); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 
 	if err := user.Update(false); err != nil {
@@ -750,6 +768,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	setAuditEvent(c, "user."+req.Action, "user", user.Id, origin, user)
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -823,7 +842,7 @@ func TopUp(c *gin.Context) {
 		return
 	}
 	id := c.GetInt("id")
-	quota, err := model.Redeem(req.Key, id)
+	quota, tokenKey, err := model.Redeem(req.Key, id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -831,10 +850,12 @@ func TopUp(c *gin.Context) {
 		})
 		return
 	}
+	// 兑换码附带的令牌只在此处返回一次明文
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    quota,
+		"success":   true,
+		"message":   "",
+		"data":      quota,
+		"token_key": tokenKey,
 	})
 	return
 }
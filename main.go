@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-contrib/sessions"
@@ -17,7 +19,11 @@ import (
 	"one-api/router"
 	"one-api/service"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	_ "net/http/pprof"
 )
@@ -29,6 +35,7 @@ var buildFS embed.FS
 var indexPage []byte
 
 func main() {
+	common.InitEnv()
 	common.SetupLogger()
 	common.SysLog("New API " + common.Version + " started")
 	if os.Getenv("GIN_MODE") != "debug" {
@@ -37,8 +44,18 @@ func main() {
 	if common.DebugEnabled {
 		common.SysLog("running in debug mode")
 	}
+	err := common.InitTracer()
+	if err != nil {
+		common.FatalLog("failed to initialize tracer: " + err.Error())
+	}
+	defer common.ShutdownTracer()
+	// 渠道密钥加密需要在数据库迁移之前加载主密钥
+	err = common.InitChannelMasterKey()
+	if err != nil {
+		common.FatalLog("failed to initialize channel master key: " + err.Error())
+	}
 	// Initialize SQL Database
-	err := model.InitDB()
+	err = model.InitDB()
 	if err != nil {
 		common.FatalLog("failed to initialize database: " + err.Error())
 	}
@@ -86,6 +103,16 @@ func main() {
 
 	// 数据看板
 	go model.UpdateQuotaData()
+	go model.UpdateAnalyticsData()
+
+	if common.IsMasterNode {
+		// 兑换码发放的临时分组到期恢复
+		go model.SyncUserGroupExpiration(common.SyncFrequency)
+		// 删除超过保留天数的请求采集内容
+		go model.SyncCaptureRetention(3600)
+		// 按保留策略归档并删除过期日志
+		go model.SyncLogRetention(3600)
+	}
 
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
@@ -114,6 +141,11 @@ func main() {
 		common.SysLog("batch update enabled with interval " + strconv.Itoa(common.BatchUpdateInterval) + "s")
 		model.InitBatchUpdater()
 	}
+	if os.Getenv("LOG_BATCH_ENABLED") == "true" {
+		common.LogBatchEnabled = true
+		common.SysLog("consume log batch writing enabled with batch size " + strconv.Itoa(common.LogBatchSize) + " and interval " + strconv.Itoa(common.LogBatchInterval) + "s")
+		model.InitConsumeLogWriter()
+	}
 
 	if os.Getenv("ENABLE_PPROF") == "true" {
 		go func() {
@@ -123,7 +155,10 @@ func main() {
 		common.SysLog("pprof enabled")
 	}
 
+	common.StartMetricsServer()
+
 	service.InitTokenEncoders()
+	model.QuotaConsumedHook = service.CheckQuotaAlertsAsync
 
 	// Initialize HTTP server
 	server := gin.New()
@@ -138,7 +173,23 @@ func main() {
 	}))
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
+	// 令牌与访问令牌的 IP 白名单依赖真实客户端 IP，部署在反向代理之后时需通过 TRUSTED_PROXIES 指定可信代理
+	// 未设置时不信任任何代理，客户端 IP 取 TCP 连接的对端地址，避免任意客户端伪造 X-Forwarded-For
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	err = server.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		common.FatalLog("failed to set trusted proxies: " + err.Error())
+	}
+	if len(trustedProxies) == 0 {
+		common.SysLog("TRUSTED_PROXIES not set, X-Forwarded-For will be ignored")
+	}
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 	middleware.SetUpLogger(server)
 	// Initialize session store
 	store := cookie.NewStore([]byte(common.SessionSecret))
@@ -149,8 +200,30 @@ func main() {
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
 	}
-	err = server.Run(":" + port)
-	if err != nil {
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: server.Handler(),
+	}
+	// Shutdown 开始后 ListenAndServe 立即返回，需等待 Shutdown 处理完进行中的请求后再退出
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+		common.SysLog("shutting down server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			common.SysError("failed to shutdown HTTP server: " + err.Error())
+		}
+	}()
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		common.FatalLog("failed to start HTTP server: " + err.Error())
 	}
+	<-done
+	// 写完队列中的消费日志和内存中的渠道统计后退出
+	model.FlushConsumeLogs()
+	model.SaveAnalyticsDataCache()
 }
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+)
+
+// AuditLog 为已登录用户发起的变更请求以及个人访问令牌发起的所有请求写入审计日志，
+// 控制器可通过 audit_event 补充操作对象与变更内容
+func AuditLog() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Next()
+		event, hasEvent := c.Get("audit_event")
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			// 会话发起的只读请求仅在控制器显式标记时记录，例如查看渠道密钥
+			if !hasEvent && c.GetInt("personal_access_token_id") == 0 {
+				return
+			}
+		}
+		userId := c.GetInt("id")
+		if userId == 0 {
+			return
+		}
+		auditLog := &model.AuditLog{
+			UserId:                userId,
+			Username:              c.GetString("username"),
+			PersonalAccessTokenId: c.GetInt("personal_access_token_id"),
+			Ip:                    c.ClientIP(),
+			RequestId:             c.GetString(common.RequestIdKey),
+			Method:                c.Request.Method,
+			Path:                  c.FullPath(),
+			Action:                c.Request.Method + " " + c.FullPath(),
+			StatusCode:            c.Writer.Status(),
+		}
+		if hasEvent {
+			if event, ok := event.(*model.AuditEvent); ok {
+				auditLog.Action = event.Action
+				auditLog.TargetType = event.TargetType
+				auditLog.TargetId = event.TargetId
+				auditLog.Diff = event.Diff
+			}
+		}
+		model.RecordAuditLog(auditLog)
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// 个人访问令牌发起的只读请求同样写入审计日志，记录令牌 id、方法与路径
+func TestAuditLogPersonalAccessToken(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	router.Use(AuditLog())
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+	router.GET("/api/user/self", UserAuth(), ok)
+	router.PUT("/api/user/self", AccountAuth(), ok)
+	router.GET("/api/status", ok)
+
+	patId := 0
+	key, err := model.CreatePersonalAccessToken(&model.PersonalAccessToken{UserId: 1, Name: "audit", Scopes: common.AccessTokenScopeSelf, ExpiredTime: -1})
+	if err != nil {
+		t.Fatalf("create personal access token: %v", err)
+	}
+	model.DB.Model(&model.PersonalAccessToken{}).Where("name = ?", "audit").Select("id").Find(&patId)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		wantAudit bool
+	}{
+		{"token read", http.MethodGet, "/api/user/self", key, true},
+		{"token denied by scope", http.MethodPut, "/api/user/self", key, false},
+		{"anonymous read", http.MethodGet, "/api/status", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model.LOG_DB.Where("1 = 1").Delete(&model.AuditLog{})
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			var auditLogs []*model.AuditLog
+			model.LOG_DB.Find(&auditLogs)
+			if !tt.wantAudit {
+				if len(auditLogs) != 0 {
+					t.Errorf("unexpected audit logs: %d", len(auditLogs))
+				}
+				return
+			}
+			if len(auditLogs) != 1 {
+				t.Fatalf("audit logs = %d, want 1", len(auditLogs))
+			}
+			got := auditLogs[0]
+			if got.PersonalAccessTokenId != patId || got.Method != tt.method || got.Path != tt.path {
+				t.Errorf("audit log = token %d %s %s, want token %d %s %s", got.PersonalAccessTokenId, got.Method, got.Path, patId, tt.method, tt.path)
+			}
+		})
+	}
+}
@@ -1,16 +1,20 @@
 package middleware
 
 import (
+	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 	"strings"
 )
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper 校验登录状态与用户等级，permission 不为空时还要求用户拥有该权限，
+// 使用个人访问令牌时要求令牌拥有 scope 作用域
+func authHelper(c *gin.Context, minRole int, permission string, scope string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -18,6 +22,7 @@ func authHelper(c *gin.Context, minRole int) {
 	status := session.Get("status")
 	linuxDoEnable := session.Get("linuxdo_enable")
 	useAccessToken := false
+	var personalAccessToken *model.PersonalAccessToken
 	if username == nil {
 		// Check access token
 		accessToken := c.Request.Header.Get("Authorization")
@@ -29,8 +34,24 @@ func authHelper(c *gin.Context, minRole int) {
 			c.Abort()
 			return
 		}
-		user := model.ValidateAccessToken(accessToken)
-		if user != nil && user.Username != "" {
+		if strings.HasPrefix(strings.TrimPrefix(accessToken, "Bearer "), model.PersonalAccessTokenPrefix) {
+			token, user, err := model.ValidatePersonalAccessToken(accessToken, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无权进行此操作，" + err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			personalAccessToken = token
+			username = user.Username
+			role = user.Role
+			id = user.Id
+			status = user.Status
+			linuxDoEnable = user.LinuxDoId == "" || user.LinuxDoLevel >= common.LinuxDoMinLevel
+			useAccessToken = true
+		} else if user := model.ValidateAccessToken(accessToken); user != nil && user.Username != "" {
 			// Token is valid
 			username = user.Username
 			role = user.Role
@@ -102,9 +123,41 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if personalAccessToken != nil {
+		// 个人访问令牌只能访问其作用域覆盖的接口，且权限不会超出所属用户本身
+		if !personalAccessToken.HasScope(scope) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，访问令牌缺少作用域 " + scope,
+			})
+			c.Abort()
+			return
+		}
+	}
+	if permission != "" && !model.HasUserPermission(id.(int), role.(int), permission) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，缺少权限 " + permission,
+		})
+		c.Abort()
+		return
+	}
+	if (minRole >= common.RoleAdminUser || permission != "") && common.AdminTwoFactorEnabled && !model.CacheIsTwoFactorEnabled(id.(int)) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员需先启用两步验证",
+		})
+		c.Abort()
+		return
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
+	c.Set("use_access_token", useAccessToken)
+	if personalAccessToken != nil {
+		// 令牌发起的请求都由审计日志记录令牌 id
+		c.Set("personal_access_token_id", personalAccessToken.Id)
+	}
 	c.Next()
 }
 
@@ -121,24 +174,40 @@ func TryUserAuth() func(c *gin.Context) {
 
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleCommonUser)
+		authHelper(c, common.RoleCommonUser, "", common.AccessTokenScopeSelf)
+	}
+}
+
+// AccountAuth 用于修改账户本身与登录凭据的接口，个人访问令牌需要单独的 account 作用域
+func AccountAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, "", common.AccessTokenScopeAccount)
 	}
 }
 
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleAdminUser)
+		authHelper(c, common.RoleAdminUser, "", common.AccessTokenScopeSelf)
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleRootUser)
+		authHelper(c, common.RoleRootUser, "", common.AccessTokenScopeSelf)
+	}
+}
+
+// PermissionAuth 要求登录用户拥有指定权限，内置的管理员与超级管理员等级自带对应权限
+func PermissionAuth(permission string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, permission, permission)
 	}
 }
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		_, endSpan := common.StartSpan(c, "auth")
+		defer endSpan()
 		key := c.Request.Header.Get("Authorization")
 		parts := make([]string, 0)
 		key = strings.TrimPrefix(key, "Bearer ")
@@ -182,8 +251,15 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithOpenAiMessage(c, http.StatusForbidden, "用户 LINUX DO 信任等级不足")
 			return
 		}
+		if token.AllowIps != "" && !common.IsIpAllowed(c.ClientIP(), token.AllowIps) {
+			service.RecordTokenIpViolation(token, c.ClientIP())
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌不允许从当前 IP (%s) 访问", c.ClientIP()))
+			return
+		}
 		c.Set("id", token.UserId)
 		c.Set("token_id", token.Id)
+		c.Set("token_org_id", token.OrgId)
+		c.Set("token_endpoint_scopes", token.EndpointScopes)
 		c.Set("token_name", token.Name)
 		c.Set("token_unlimited_quota", token.UnlimitedQuota)
 		if !token.UnlimitedQuota {
@@ -203,6 +279,7 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		endSpan()
 		c.Next()
 	}
 }
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// self 作用域的个人访问令牌不能访问修改账户与登录凭据的接口
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+	router.GET("/api/user/self", UserAuth(), ok)
+	router.PUT("/api/user/self", AccountAuth(), ok)
+	router.POST("/api/user/2fa/disable", AccountAuth(), ok)
+	router.GET("/api/log/", PermissionAuth(common.PermissionLogsRead), ok)
+
+	newToken := func(scopes string) string {
+		key, err := model.CreatePersonalAccessToken(&model.PersonalAccessToken{UserId: 1, Name: scopes, Scopes: scopes, ExpiredTime: -1})
+		if err != nil {
+			t.Fatalf("create personal access token: %v", err)
+		}
+		return key
+	}
+	selfToken := newToken(common.AccessTokenScopeSelf)
+	accountToken := newToken(common.AccessTokenScopeAccount)
+
+	tests := []struct {
+		name    string
+		token   string
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"self reads profile", selfToken, http.MethodGet, "/api/user/self", true},
+		{"self cannot update profile", selfToken, http.MethodPut, "/api/user/self", false},
+		{"self cannot disable 2fa", selfToken, http.MethodPost, "/api/user/2fa/disable", false},
+		{"self cannot read logs", selfToken, http.MethodGet, "/api/log/", false},
+		{"account updates profile", accountToken, http.MethodPut, "/api/user/self", true},
+		{"account disables 2fa", accountToken, http.MethodPost, "/api/user/2fa/disable", true},
+		{"account cannot read profile", accountToken, http.MethodGet, "/api/user/self", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			allowed := recorder.Code == http.StatusOK && recorder.Body.String() == `{"success":true}`
+			if allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v, body = %s", allowed, tt.allowed, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// 令牌 IP 白名单按 CIDR 匹配客户端 IP，只有来自可信代理的请求才采用 X-Forwarded-For
+func TestTokenAuthAllowIps(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		allowed        bool
+	}{
+		{"inside cidr", nil, "10.1.2.3:1234", "", true},
+		{"exact ip", nil, "192.168.1.5:1234", "", true},
+		{"ipv6 cidr", nil, "[2001:db8::1]:1234", "", true},
+		{"outside list", nil, "8.8.8.8:1234", "", false},
+		{"forwarded for ignored without trusted proxies", nil, "8.8.8.8:1234", "10.1.2.3", false},
+		{"trusted proxy forwards allowed ip", []string{"127.0.0.1"}, "127.0.0.1:1234", "10.1.2.3", true},
+		{"trusted proxy forwards other ip", []string{"127.0.0.1"}, "127.0.0.1:1234", "8.8.8.8", false},
+		{"untrusted proxy", []string{"127.0.0.1"}, "8.8.4.4:1234", "192.168.1.5", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &model.Token{UserId: 1, Key: common.GenerateKey(), Name: tt.name, Status: common.TokenStatusEnabled,
+				ExpiredTime: -1, UnlimitedQuota: true, AllowIps: "10.0.0.0/8\n192.168.1.5, 2001:db8::/32"}
+			if err := token.Insert(); err != nil {
+				t.Fatalf("insert token: %v", err)
+			}
+			router := gin.New()
+			if err := router.SetTrustedProxies(tt.trustedProxies); err != nil {
+				t.Fatalf("set trusted proxies: %v", err)
+			}
+			router.POST("/v1/chat/completions", TokenAuth(), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"success": true})
+			})
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			allowed := recorder.Code == http.StatusOK
+			if allowed != tt.allowed {
+				t.Fatalf("allowed = %v, want %v, body = %s", allowed, tt.allowed, recorder.Body.String())
+			}
+			if tt.allowed {
+				return
+			}
+			// 违规次数在后台累计
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				saved, err := model.GetTokenById(token.Id)
+				if err == nil && saved.IpViolationCount == 1 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("ip violation count was not recorded")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"one-api/common"
+	"one-api/model"
+	"strings"
+)
+
+// 原始响应的缓存上限为 MaxBodySize 的倍数，流式响应拼接后通常远小于原始分片
+const captureRawBufferFactor = 4
+
+const captureMaxChoices = 128
+
+type captureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *captureWriter) capture(data []byte) {
+	if remain := w.limit - w.body.Len(); remain < len(data) {
+		data = data[:max(remain, 0)]
+		w.truncated = true
+	}
+	w.body.Write(data)
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Capture 按采集配置保存请求与响应内容，需放在 Distribute 之后
+func Capture() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		config := common.GetCaptureConfig()
+		if !config.ShouldCapture(c.GetInt("id"), c.GetInt("token_id"), c.GetInt("channel_id")) {
+			c.Next()
+			return
+		}
+		writer := &captureWriter{ResponseWriter: c.Writer, limit: config.MaxBodySize * captureRawBufferFactor}
+		c.Writer = writer
+		capture := &model.Capture{
+			RequestId: c.GetString(common.RequestIdKey),
+			UserId:    c.GetInt("id"),
+			TokenId:   c.GetInt("token_id"),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+		}
+		c.Next()
+
+		capture.ChannelId = c.GetInt("channel_id")
+		capture.ModelName = c.GetString("original_model")
+		capture.StatusCode = writer.Status()
+		requestContentType := c.Request.Header.Get("Content-Type")
+		responseContentType := writer.Header().Get("Content-Type")
+		capture.IsStream = strings.HasPrefix(responseContentType, "text/event-stream")
+		var requestBody []byte
+		if isCapturableContentType(requestContentType) {
+			requestBody, _ = common.GetRequestBody(c)
+		}
+		responseBody := writer.body.Bytes()
+		truncated := writer.truncated
+		gopool.Go(func() {
+			var requestTruncated, responseTruncated bool
+			if isCapturableContentType(requestContentType) {
+				capture.RequestBody, requestTruncated = config.Redact(string(requestBody))
+			} else {
+				capture.RequestBody = "[" + requestContentType + " 内容未采集]"
+			}
+			if capture.IsStream {
+				responseBody = reassembleStreamResponse(responseBody)
+			}
+			if isCapturableContentType(responseContentType) {
+				capture.ResponseBody, responseTruncated = config.Redact(string(responseBody))
+			} else {
+				capture.ResponseBody = "[" + responseContentType + " 内容未采集]"
+			}
+			capture.Truncated = truncated || requestTruncated || responseTruncated
+			model.RecordCapture(capture)
+		})
+	}
+}
+
+func isCapturableContentType(contentType string) bool {
+	return contentType == "" || strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/")
+}
+
+type captureStreamChunk struct {
+	Choices []struct {
+		Index int    `json:"index"`
+		Text  string `json:"text"`
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage json.RawMessage `json:"usage"`
+}
+
+type captureStreamChoice struct {
+	Index            int    `json:"index"`
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	FinishReason     string `json:"finish_reason,omitempty"`
+}
+
+// reassembleStreamResponse 将 SSE 分片中的增量内容按 choice 拼接为完整内容，无法解析时返回原始内容
+func reassembleStreamResponse(raw []byte) []byte {
+	var choices []*captureStreamChoice
+	var usage json.RawMessage
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 64*1024), len(raw)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk captureStreamChunk
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			continue
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index < 0 || choice.Index >= captureMaxChoices {
+				continue
+			}
+			for len(choices) <= choice.Index {
+				choices = append(choices, &captureStreamChoice{Index: len(choices)})
+			}
+			reassembled := choices[choice.Index]
+			reassembled.Content += choice.Text + choice.Delta.Content
+			reassembled.ReasoningContent += choice.Delta.ReasoningContent
+			if choice.FinishReason != nil {
+				reassembled.FinishReason = *choice.FinishReason
+			}
+		}
+		if len(chunk.Usage) > 0 && string(chunk.Usage) != "null" {
+			usage = chunk.Usage
+		}
+	}
+	if len(choices) == 0 {
+		return raw
+	}
+	reassembled, err := json.Marshal(map[string]any{
+		"choices": choices,
+		"usage":   usage,
+	})
+	if err != nil {
+		return raw
+	}
+	return reassembled
+}
@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -22,6 +23,17 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span, endSpan := common.StartSpan(c, "distribute")
+		defer endSpan()
+		endpointScope := relayconstant.Path2EndpointScope(c.Request.Method, c.Request.URL.Path)
+		if !relayconstant.IsEndpointScopeAllowed(c.GetString("token_endpoint_scopes"), endpointScope) {
+			if strings.Contains(c.Request.URL.Path, "/mj/") {
+				abortWithMidjourneyMessage(c, http.StatusForbidden, constant.MjErrorUnknown, "该令牌无权访问此接口")
+			} else {
+				abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问此接口")
+			}
+			return
+		}
 		userId := c.GetInt("id")
 		var channel *model.Channel
 		channelId, ok := c.Get("specific_channel_id")
@@ -91,6 +103,14 @@ func Distribute() func(c *gin.Context) {
 			}
 		}
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		span.SetAttributes(attribute.String("model", modelRequest.Model))
+		if channel != nil {
+			span.SetAttributes(
+				attribute.Int("channel.id", channel.Id),
+				attribute.Int("channel.type", channel.Type),
+			)
+		}
+		endSpan()
 		c.Next()
 	}
 }
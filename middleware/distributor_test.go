@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "middleware.db")
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	if err := model.InitLogDB(); err != nil {
+		t.Fatalf("init log db: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+	})
+}
+
+// 任务查询类接口不选择渠道，Distribute 不能因渠道为空而 panic
+func TestDistributeWithoutChannelSelection(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"mj task fetch", http.MethodGet, "/mj/task/123/fetch"},
+		{"mj image seed", http.MethodGet, "/mj/task/123/image-seed"},
+		{"suno fetch by id", http.MethodGet, "/suno/fetch/123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("id", 1)
+			})
+			router.Handle(tt.method, tt.path, Distribute(), func(c *gin.Context) {
+				if _, ok := c.Get("channel_id"); ok {
+					t.Errorf("channel should not be selected for %s", tt.path)
+				}
+				c.Status(http.StatusOK)
+			})
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// 令牌设置了接口范围时，范围以外的接口返回 403，Midjourney 接口使用 Midjourney 的错误格式
+func TestDistributeEndpointScopes(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		scopes  string
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"no scopes", "", http.MethodGet, "/suno/fetch/123", true},
+		{"suno allowed", "chat,suno", http.MethodGet, "/suno/fetch/123", true},
+		{"midjourney allowed", "midjourney", http.MethodGet, "/mj/task/123/fetch", true},
+		{"suno rejected", "chat", http.MethodGet, "/suno/fetch/123", false},
+		{"midjourney rejected", "chat", http.MethodGet, "/mj/task/123/fetch", false},
+		{"embeddings rejected", "chat", http.MethodPost, "/v1/embeddings", false},
+		{"unknown endpoint rejected", "chat", http.MethodGet, "/v1/unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("id", 1)
+				c.Set("token_endpoint_scopes", tt.scopes)
+			})
+			router.Handle(tt.method, tt.path, Distribute(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+			allowed := recorder.Code == http.StatusOK
+			if allowed != tt.allowed {
+				t.Fatalf("allowed = %v, want %v, status = %d, body = %s", allowed, tt.allowed, recorder.Code, recorder.Body.String())
+			}
+			if tt.allowed {
+				return
+			}
+			if recorder.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+			}
+			// Midjourney 客户端只识别 description 字段
+			wantField := `"error"`
+			if strings.Contains(tt.path, "/mj/") {
+				wantField = `"description"`
+			}
+			if !strings.Contains(recorder.Body.String(), wantField) {
+				t.Errorf("body = %s, want field %s", recorder.Body.String(), wantField)
+			}
+		})
+	}
+}
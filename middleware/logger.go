@@ -1,25 +1,30 @@
 package middleware
 
 import (
-	"fmt"
 	"github.com/gin-gonic/gin"
+	"log/slog"
 	"one-api/common"
+	"time"
 )
 
+// SetUpLogger 记录访问日志，请求结束后附带鉴权与分发阶段写入的用户、令牌、渠道和模型字段
 func SetUpLogger(server *gin.Engine) {
-	server.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		var requestID string
-		if param.Keys != nil {
-			requestID = param.Keys[common.RequestIdKey].(string)
+	server.Use(func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelWarn
 		}
-		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
-			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
-			requestID,
-			param.StatusCode,
-			param.Latency,
-			param.ClientIP,
-			param.Method,
-			param.Path,
+		common.LogWith(c, level, "request",
+			"source", "gin",
+			"status", status,
+			"latency", time.Since(start).String(),
+			"client_ip", c.ClientIP(),
+			"method", c.Request.Method,
+			"path", path,
 		)
-	}))
+	})
 }
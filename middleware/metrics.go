@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	relayconstant "one-api/relay/constant"
+	"time"
+)
+
+// RelayMetrics 统计转发请求的数量、耗时与重试次数，需放在 TokenAuth 与 Distribute 之前
+func RelayMetrics() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		c.Next()
+		relayMode := relayconstant.Path2EndpointScope(c.Request.Method, c.Request.URL.Path)
+		if relayMode == "" {
+			relayMode = "unknown"
+		}
+		modelName := c.GetString("original_model")
+		common.RecordRelayRequest(relayMode, modelName, c.GetInt("channel_id"), c.Writer.Status(), time.Since(startTime))
+		// use_channel 记录了本次请求依次使用的渠道，除第一个外均为重试
+		if useChannel := c.GetStringSlice("use_channel"); len(useChannel) > 1 {
+			common.RecordRelayRetries(modelName, len(useChannel)-1)
+		}
+	}
+}
+
+// MetricsAuth 校验访问 /metrics 的 Bearer 令牌
+func MetricsAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authorization := c.Request.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+common.MetricsToken)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
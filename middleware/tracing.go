@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"net/http"
+	"one-api/common"
+)
+
+// Tracing 为每个请求创建根 span，需放在 RequestId 之后
+func Tracing() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		span := common.StartServerSpan(c, c.Request.Method+" "+route,
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("request.id", c.GetString(common.RequestIdKey)),
+		)
+		defer span.End()
+		c.Next()
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AnalyticsData 渠道与模型的请求统计，按 analyticsBucketSeconds 时间桶汇总
+// 耗时以直方图保存，查询时合并直方图再估算分位数，因此可以按任意时间范围和维度聚合
+type AnalyticsData struct {
+	Id                  int    `json:"id"`
+	CreatedAt           int64  `json:"created_at" gorm:"bigint;index:idx_ad_created_at_channel,priority:1"`
+	ChannelId           int    `json:"channel_id" gorm:"index:idx_ad_created_at_channel,priority:2"`
+	ModelName           string `json:"model_name" gorm:"size:255;index;default:''"`
+	RequestCount        int    `json:"request_count" gorm:"default:0"`
+	SuccessCount        int    `json:"success_count" gorm:"default:0"`
+	ClientErrorCount    int    `json:"client_error_count" gorm:"default:0"` // 4xx
+	ServerErrorCount    int    `json:"server_error_count" gorm:"default:0"` // 5xx 及其他
+	PromptTokens        int    `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens    int    `json:"completion_tokens" gorm:"default:0"`
+	Quota               int    `json:"quota" gorm:"default:0"`
+	LatencySum          int64  `json:"latency_sum" gorm:"default:0"` // 毫秒
+	LatencyHistogram    string `json:"-" gorm:"type:varchar(255);default:''"`
+	FirstTokenCount     int    `json:"first_token_count" gorm:"default:0"`
+	FirstTokenSum       int64  `json:"first_token_sum" gorm:"default:0"` // 毫秒
+	FirstTokenHistogram string `json:"-" gorm:"type:varchar(255);default:''"`
+}
+
+const analyticsBucketSeconds = 3600
+
+// 耗时直方图的桶上界（毫秒），最后一个桶为超过最大值的部分
+var analyticsLatencyBounds = []int64{100, 250, 500, 1000, 2000, 3000, 5000, 8000, 13000, 20000, 30000, 60000, 120000, 300000}
+
+type latencyHistogram []int64
+
+func newLatencyHistogram() latencyHistogram {
+	return make(latencyHistogram, len(analyticsLatencyBounds)+1)
+}
+
+func parseLatencyHistogram(str string) latencyHistogram {
+	histogram := newLatencyHistogram()
+	if str == "" {
+		return histogram
+	}
+	for i, part := range strings.Split(str, ",") {
+		if i >= len(histogram) {
+			break
+		}
+		histogram[i], _ = strconv.ParseInt(part, 10, 64)
+	}
+	return histogram
+}
+
+func (histogram latencyHistogram) String() string {
+	parts := make([]string, len(histogram))
+	for i, count := range histogram {
+		parts[i] = strconv.FormatInt(count, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (histogram latencyHistogram) observe(latency time.Duration) {
+	ms := latency.Milliseconds()
+	i := sort.Search(len(analyticsLatencyBounds), func(i int) bool {
+		return analyticsLatencyBounds[i] >= ms
+	})
+	histogram[i]++
+}
+
+func (histogram latencyHistogram) merge(other latencyHistogram) {
+	for i := range histogram {
+		histogram[i] += other[i]
+	}
+}
+
+// percentile 在命中的桶内线性插值估算分位数，落在最后一个桶时返回最大上界
+func (histogram latencyHistogram) percentile(p float64) int64 {
+	var total int64
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := p * float64(total)
+	var cumulative int64
+	for i, count := range histogram {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+		if i == len(analyticsLatencyBounds) {
+			return analyticsLatencyBounds[i-1]
+		}
+		var lower int64
+		if i > 0 {
+			lower = analyticsLatencyBounds[i-1]
+		}
+		upper := analyticsLatencyBounds[i]
+		return lower + int64(float64(upper-lower)*(rank-float64(cumulative))/float64(count))
+	}
+	return analyticsLatencyBounds[len(analyticsLatencyBounds)-1]
+}
+
+type analyticsCacheItem struct {
+	data       *AnalyticsData
+	latency    latencyHistogram
+	firstToken latencyHistogram
+}
+
+var analyticsCache = make(map[string]*analyticsCacheItem)
+var analyticsCacheLock sync.Mutex
+
+func getAnalyticsCacheItem(channelId int, modelName string) *analyticsCacheItem {
+	createdAt := time.Now().Unix()
+	createdAt -= createdAt % analyticsBucketSeconds
+	key := fmt.Sprintf("%d-%s-%d", channelId, modelName, createdAt)
+	item, ok := analyticsCache[key]
+	if !ok {
+		item = &analyticsCacheItem{
+			data: &AnalyticsData{
+				CreatedAt: createdAt,
+				ChannelId: channelId,
+				ModelName: modelName,
+			},
+			latency:    newLatencyHistogram(),
+			firstToken: newLatencyHistogram(),
+		}
+		analyticsCache[key] = item
+	}
+	return item
+}
+
+// RecordAnalyticsRequest 记录一次发往渠道的请求（包括重试）的状态码与耗时
+func RecordAnalyticsRequest(channelId int, modelName string, statusCode int, latency time.Duration) {
+	if !common.AnalyticsEnabled || channelId == 0 {
+		return
+	}
+	analyticsCacheLock.Lock()
+	defer analyticsCacheLock.Unlock()
+	item := getAnalyticsCacheItem(channelId, modelName)
+	item.data.RequestCount++
+	switch {
+	case statusCode >= 200 && statusCode < 400:
+		item.data.SuccessCount++
+	case statusCode >= 400 && statusCode < 500:
+		item.data.ClientErrorCount++
+	default:
+		item.data.ServerErrorCount++
+	}
+	item.data.LatencySum += latency.Milliseconds()
+	item.latency.observe(latency)
+}
+
+// RecordAnalyticsUsage 记录成功请求的用量与首字耗时，firstToken 为 0 表示非流式请求
+func RecordAnalyticsUsage(channelId int, modelName string, promptTokens int, completionTokens int, quota int, firstToken time.Duration) {
+	if !common.AnalyticsEnabled || channelId == 0 {
+		return
+	}
+	analyticsCacheLock.Lock()
+	defer analyticsCacheLock.Unlock()
+	item := getAnalyticsCacheItem(channelId, modelName)
+	item.data.PromptTokens += promptTokens
+	item.data.CompletionTokens += completionTokens
+	item.data.Quota += quota
+	if firstToken > 0 {
+		item.data.FirstTokenCount++
+		item.data.FirstTokenSum += firstToken.Milliseconds()
+		item.firstToken.observe(firstToken)
+	}
+}
+
+func UpdateAnalyticsData() {
+	for {
+		time.Sleep(time.Minute)
+		// 单次保存出错不能终止后续的定时保存
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					common.SysLog(fmt.Sprintf("UpdateAnalyticsData panic: %s", r))
+				}
+			}()
+			SaveAnalyticsDataCache()
+		}()
+	}
+}
+
+// SaveAnalyticsDataCache 将内存中的统计合并到数据库，多个节点写入同一时间桶时在事务中加锁合并
+func SaveAnalyticsDataCache() {
+	analyticsCacheLock.Lock()
+	cache := analyticsCache
+	analyticsCache = make(map[string]*analyticsCacheItem)
+	analyticsCacheLock.Unlock()
+	for _, item := range cache {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			existing := &AnalyticsData{}
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("created_at = ? and channel_id = ? and model_name = ?", item.data.CreatedAt, item.data.ChannelId, item.data.ModelName).
+				Limit(1).Find(existing).Error
+			if err != nil {
+				return err
+			}
+			if existing.Id == 0 {
+				item.data.LatencyHistogram = item.latency.String()
+				item.data.FirstTokenHistogram = item.firstToken.String()
+				return tx.Create(item.data).Error
+			}
+			existing.mergeFrom(item.data, item.latency, item.firstToken)
+			return tx.Save(existing).Error
+		})
+		if err != nil {
+			common.SysError("failed to save analytics data: " + err.Error())
+		}
+	}
+}
+
+func (data *AnalyticsData) mergeFrom(other *AnalyticsData, latency latencyHistogram, firstToken latencyHistogram) {
+	data.RequestCount += other.RequestCount
+	data.SuccessCount += other.SuccessCount
+	data.ClientErrorCount += other.ClientErrorCount
+	data.ServerErrorCount += other.ServerErrorCount
+	data.PromptTokens += other.PromptTokens
+	data.CompletionTokens += other.CompletionTokens
+	data.Quota += other.Quota
+	data.LatencySum += other.LatencySum
+	data.FirstTokenCount += other.FirstTokenCount
+	data.FirstTokenSum += other.FirstTokenSum
+	mergedLatency := parseLatencyHistogram(data.LatencyHistogram)
+	mergedLatency.merge(latency)
+	data.LatencyHistogram = mergedLatency.String()
+	mergedFirstToken := parseLatencyHistogram(data.FirstTokenHistogram)
+	mergedFirstToken.merge(firstToken)
+	data.FirstTokenHistogram = mergedFirstToken.String()
+}
+
+type AnalyticsQuery struct {
+	StartTimestamp int64
+	EndTimestamp   int64
+	ChannelId      int
+	ModelName      string
+	GroupBy        []string // channel、model
+	Interval       int64    // 秒，为 analyticsBucketSeconds 的整数倍，0 表示不按时间分组
+}
+
+// AnalyticsStat 聚合后的统计结果，耗时单位为毫秒
+type AnalyticsStat struct {
+	Time             int64   `json:"time,omitempty"`
+	ChannelId        int     `json:"channel_id,omitempty"`
+	ModelName        string  `json:"model_name,omitempty"`
+	RequestCount     int     `json:"request_count"`
+	SuccessCount     int     `json:"success_count"`
+	ClientErrorCount int     `json:"client_error_count"`
+	ServerErrorCount int     `json:"server_error_count"`
+	ErrorRate        float64 `json:"error_rate"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Quota            int     `json:"quota"`
+	LatencyAvg       int64   `json:"latency_avg"`
+	LatencyP50       int64   `json:"latency_p50"`
+	LatencyP95       int64   `json:"latency_p95"`
+	LatencyP99       int64   `json:"latency_p99"`
+	FirstTokenAvg    int64   `json:"first_token_avg"`
+	FirstTokenP50    int64   `json:"first_token_p50"`
+	FirstTokenP95    int64   `json:"first_token_p95"`
+	FirstTokenP99    int64   `json:"first_token_p99"`
+}
+
+func GetAnalytics(query AnalyticsQuery) ([]*AnalyticsStat, error) {
+	tx := DB.Model(&AnalyticsData{})
+	if query.StartTimestamp != 0 {
+		// 包含开始时间所在的时间桶
+		tx = tx.Where("created_at >= ?", query.StartTimestamp-query.StartTimestamp%analyticsBucketSeconds)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	var rows []*AnalyticsData
+	err := tx.Order("created_at asc").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	groupByChannel, groupByModel := false, false
+	for _, field := range query.GroupBy {
+		switch field {
+		case "channel":
+			groupByChannel = true
+		case "model":
+			groupByModel = true
+		}
+	}
+	type group struct {
+		data       *AnalyticsData
+		latency    latencyHistogram
+		firstToken latencyHistogram
+	}
+	groups := make(map[string]*group)
+	keys := make([]string, 0)
+	for _, row := range rows {
+		key := &AnalyticsData{}
+		if query.Interval > 0 {
+			key.CreatedAt = row.CreatedAt - row.CreatedAt%query.Interval
+		}
+		if groupByChannel {
+			key.ChannelId = row.ChannelId
+		}
+		if groupByModel {
+			key.ModelName = row.ModelName
+		}
+		keyStr := fmt.Sprintf("%d-%d-%s", key.CreatedAt, key.ChannelId, key.ModelName)
+		g, ok := groups[keyStr]
+		if !ok {
+			g = &group{data: key, latency: newLatencyHistogram(), firstToken: newLatencyHistogram()}
+			groups[keyStr] = g
+			keys = append(keys, keyStr)
+		}
+		g.data.mergeFrom(row, parseLatencyHistogram(row.LatencyHistogram), parseLatencyHistogram(row.FirstTokenHistogram))
+	}
+	stats := make([]*AnalyticsStat, 0, len(keys))
+	for _, key := range keys {
+		data := groups[key].data
+		latency := parseLatencyHistogram(data.LatencyHistogram)
+		firstToken := parseLatencyHistogram(data.FirstTokenHistogram)
+		stat := &AnalyticsStat{
+			Time:             data.CreatedAt,
+			ChannelId:        data.ChannelId,
+			ModelName:        data.ModelName,
+			RequestCount:     data.RequestCount,
+			SuccessCount:     data.SuccessCount,
+			ClientErrorCount: data.ClientErrorCount,
+			ServerErrorCount: data.ServerErrorCount,
+			PromptTokens:     data.PromptTokens,
+			CompletionTokens: data.CompletionTokens,
+			Quota:            data.Quota,
+			LatencyP50:       latency.percentile(0.5),
+			LatencyP95:       latency.percentile(0.95),
+			LatencyP99:       latency.percentile(0.99),
+			FirstTokenP50:    firstToken.percentile(0.5),
+			FirstTokenP95:    firstToken.percentile(0.95),
+			FirstTokenP99:    firstToken.percentile(0.99),
+		}
+		if data.RequestCount > 0 {
+			stat.ErrorRate = float64(data.ClientErrorCount+data.ServerErrorCount) / float64(data.RequestCount)
+			stat.LatencyAvg = data.LatencySum / int64(data.RequestCount)
+		}
+		if data.FirstTokenCount > 0 {
+			stat.FirstTokenAvg = data.FirstTokenSum / int64(data.FirstTokenCount)
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		p         float64
+		want      int64
+	}{
+		{"empty", nil, 0.5, 0},
+		{"single sample in first bucket", []time.Duration{50 * time.Millisecond}, 0.5, 50},
+		{"boundary belongs to lower bucket", []time.Duration{100 * time.Millisecond}, 1, 100},
+		{"interpolate within bucket", []time.Duration{
+			300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond,
+		}, 0.5, 375},
+		{"median across buckets", []time.Duration{
+			50 * time.Millisecond, 200 * time.Millisecond, 700 * time.Millisecond, 1500 * time.Millisecond,
+		}, 0.5, 250},
+		{"p99 in slow bucket", []time.Duration{
+			50 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond, 4 * time.Second,
+		}, 0.99, 4920},
+		{"overflow bucket returns max bound", []time.Duration{10 * time.Minute}, 0.5, 300000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			histogram := newLatencyHistogram()
+			for _, latency := range tt.latencies {
+				histogram.observe(latency)
+			}
+			if got := histogram.percentile(tt.p); got != tt.want {
+				t.Errorf("percentile(%v) = %d, want %d", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyHistogramParseAndMerge(t *testing.T) {
+	histogram := newLatencyHistogram()
+	histogram.observe(50 * time.Millisecond)
+	histogram.observe(2 * time.Second)
+	parsed := parseLatencyHistogram(histogram.String())
+	if parsed.String() != histogram.String() {
+		t.Fatalf("parse(%q) = %q", histogram.String(), parsed.String())
+	}
+	tests := []struct {
+		name string
+		str  string
+		want int64
+	}{
+		{"empty string", "", 0},
+		{"short string", "3,1", 4},
+		{"too many buckets", "1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1", int64(len(analyticsLatencyBounds) + 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := parseLatencyHistogram(tt.str)
+			if len(other) != len(analyticsLatencyBounds)+1 {
+				t.Fatalf("len = %d", len(other))
+			}
+			var total int64
+			for _, count := range other {
+				total += count
+			}
+			if total != tt.want {
+				t.Errorf("total = %d, want %d", total, tt.want)
+			}
+			merged := parseLatencyHistogram(histogram.String())
+			merged.merge(other)
+			if merged[0] != histogram[0]+other[0] {
+				t.Errorf("merge did not add first bucket")
+			}
+		})
+	}
+}
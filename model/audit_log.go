@@ -0,0 +1,91 @@
+package model
+
+import (
+	"one-api/common"
+)
+
+// AuditLog 记录管理接口的变更操作，由 middleware.AuditLog 在请求结束后写入
+type AuditLog struct {
+	Id                    int    `json:"id"`
+	CreatedAt             int64  `json:"created_at" gorm:"bigint;index"`
+	UserId                int    `json:"user_id" gorm:"index"`
+	Username              string `json:"username" gorm:"index;default:''"`
+	PersonalAccessTokenId int    `json:"personal_access_token_id" gorm:"default:0"`
+	Ip                    string `json:"ip" gorm:"default:''"`
+	RequestId             string `json:"request_id" gorm:"default:''"`
+	Method                string `json:"method" gorm:"type:varchar(16)"`
+	Path                  string `json:"path" gorm:"type:varchar(255)"`
+	Action                string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType            string `json:"target_type" gorm:"type:varchar(32);index"`
+	TargetId              string `json:"target_id" gorm:"type:varchar(64);index"`
+	Diff                  string `json:"diff" gorm:"type:text"`
+	StatusCode            int    `json:"status_code"`
+}
+
+// AuditEvent 由控制器在变更成功后填写，描述操作对象与变更内容
+type AuditEvent struct {
+	Action     string
+	TargetType string
+	TargetId   string
+	Diff       string
+}
+
+type AuditLogQuery struct {
+	UserId         int
+	Username       string
+	Action         string
+	TargetType     string
+	TargetId       string
+	Ip             string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func RecordAuditLog(auditLog *AuditLog) {
+	auditLog.CreatedAt = common.GetTimestamp()
+	// 批量操作的对象 id 可能很长，超出列宽的部分截断
+	if len(auditLog.TargetId) > 64 {
+		auditLog.TargetId = auditLog.TargetId[:61] + "..."
+	}
+	err := LOG_DB.Create(auditLog).Error
+	if err != nil {
+		common.SysError("failed to record audit log: " + err.Error())
+	}
+}
+
+func SearchAuditLogs(query AuditLogQuery, startIdx int, num int) (auditLogs []*AuditLog, total int64, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.Username != "" {
+		tx = tx.Where("username = ?", query.Username)
+	}
+	if query.Action != "" {
+		tx = tx.Where("action like ?", query.Action+"%")
+	}
+	if query.TargetType != "" {
+		tx = tx.Where("target_type = ?", query.TargetType)
+	}
+	if query.TargetId != "" {
+		tx = tx.Where("target_id = ?", query.TargetId)
+	}
+	if query.Ip != "" {
+		tx = tx.Where("ip = ?", query.Ip)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&auditLogs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return auditLogs, total, nil
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,23 +21,28 @@ var (
 	UserId2StatusCacheSeconds = common.SyncFrequency
 )
 
-// 仅用于定时同步缓存
-var token2UserId = make(map[string]int)
-var token2UserIdLock sync.RWMutex
+// 仅用于定时同步缓存，缓存键 -> 令牌 id
+var tokenCacheIds = make(map[string]int)
+var tokenCacheIdsLock sync.RWMutex
 
-func cacheSetToken(token *Token) error {
+// tokenCacheKey 缓存以令牌明文的哈希为键，Redis 中不保存令牌明文
+func tokenCacheKey(key string) string {
+	return "token:" + hex.EncodeToString(common.Sha256Raw(key))
+}
+
+func cacheSetToken(cacheKey string, token *Token) error {
 	jsonBytes, err := json.Marshal(token)
 	if err != nil {
 		return err
 	}
-	err = common.RedisSet(fmt.Sprintf("token:%s", token.Key), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
+	err = common.RedisSet(cacheKey, string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
 	if err != nil {
-		common.SysError(fmt.Sprintf("failed to set token %s to redis: %s", token.Key, err.Error()))
+		common.SysError(fmt.Sprintf("failed to set token #%d to redis: %s", token.Id, err.Error()))
 		return err
 	}
-	token2UserIdLock.Lock()
-	defer token2UserIdLock.Unlock()
-	token2UserId[token.Key] = token.UserId
+	tokenCacheIdsLock.Lock()
+	defer tokenCacheIdsLock.Unlock()
+	tokenCacheIds[cacheKey] = token.Id
 	return nil
 }
 
@@ -45,19 +51,21 @@ func CacheGetTokenByKey(key string) (*Token, error) {
 	if !common.RedisEnabled {
 		return GetTokenByKey(key)
 	}
+	cacheKey := tokenCacheKey(key)
 	var token *Token
-	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", key))
+	tokenObjectString, err := common.RedisGet(cacheKey)
+	common.RecordCacheResult("token", err == nil)
 	if err != nil {
 		// 如果缓存中不存在，则从数据库中获取
 		token, err = GetTokenByKey(key)
 		if err != nil {
 			return nil, err
 		}
-		err = cacheSetToken(token)
+		err = cacheSetToken(cacheKey, token)
 		return token, nil
 	}
 	// 如果缓存中存在，则续期时间
-	err = common.RedisExpire(fmt.Sprintf("token:%s", key), time.Duration(TokenCacheSeconds)*time.Second)
+	err = common.RedisExpire(cacheKey, time.Duration(TokenCacheSeconds)*time.Second)
 	err = json.Unmarshal([]byte(tokenObjectString), &token)
 	return token, err
 }
@@ -66,35 +74,35 @@ func SyncTokenCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
 		common.SysLog("syncing tokens from database")
-		token2UserIdLock.Lock()
-		// 从token2UserId中获取所有的key
-		var copyToken2UserId = make(map[string]int)
-		for s, i := range token2UserId {
-			copyToken2UserId[s] = i
+		tokenCacheIdsLock.Lock()
+		// 从tokenCacheIds中获取所有的缓存键
+		var copyTokenCacheIds = make(map[string]int)
+		for s, i := range tokenCacheIds {
+			copyTokenCacheIds[s] = i
 		}
-		token2UserId = make(map[string]int)
-		token2UserIdLock.Unlock()
+		tokenCacheIds = make(map[string]int)
+		tokenCacheIdsLock.Unlock()
 
-		for key := range copyToken2UserId {
-			token, err := GetTokenByKey(key)
+		for cacheKey, id := range copyTokenCacheIds {
+			token, err := GetTokenById(id)
 			if err != nil {
 				// 如果数据库中不存在，则删除缓存
-				common.SysError(fmt.Sprintf("failed to get token %s from database: %s", key, err.Error()))
+				common.SysError(fmt.Sprintf("failed to get token #%d from database: %s", id, err.Error()))
 				//delete redis
-				err := common.RedisDel(fmt.Sprintf("token:%s", key))
+				err := common.RedisDel(cacheKey)
 				if err != nil {
-					common.SysError(fmt.Sprintf("failed to delete token %s from redis: %s", key, err.Error()))
+					common.SysError(fmt.Sprintf("failed to delete token #%d from redis: %s", id, err.Error()))
 				}
 			} else {
 				// 如果数据库中存在，先检查redis
-				_, err = common.RedisGet(fmt.Sprintf("token:%s", key))
+				_, err = common.RedisGet(cacheKey)
 				if err != nil {
 					// 如果redis中不存在，则跳过
 					continue
 				}
-				err = cacheSetToken(token)
+				err = cacheSetToken(cacheKey, token)
 				if err != nil {
-					common.SysError(fmt.Sprintf("failed to update token %s to redis: %s", key, err.Error()))
+					common.SysError(fmt.Sprintf("failed to update token #%d to redis: %s", id, err.Error()))
 				}
 			}
 		}
@@ -106,6 +114,7 @@ func CacheGetUserGroup(id int) (group string, err error) {
 		return GetUserGroup(id)
 	}
 	group, err = common.RedisGet(fmt.Sprintf("user_group:%d", id))
+	common.RecordCacheResult("user_group", err == nil)
 	if err != nil {
 		group, err = GetUserGroup(id)
 		if err != nil {
@@ -119,11 +128,60 @@ func CacheGetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
+// CacheIsTwoFactorEnabled 管理接口每次请求都会检查两步验证状态，启用或关闭时由 cacheSetTwoFactorEnabled 刷新
+func CacheIsTwoFactorEnabled(id int) bool {
+	if !common.RedisEnabled {
+		return IsTwoFactorEnabled(id)
+	}
+	enabled, err := common.RedisGet(fmt.Sprintf("user_two_factor:%d", id))
+	common.RecordCacheResult("user_two_factor", err == nil)
+	if err != nil {
+		result := IsTwoFactorEnabled(id)
+		cacheSetTwoFactorEnabled(id, result)
+		return result
+	}
+	return enabled == "1"
+}
+
+func cacheSetTwoFactorEnabled(id int, enabled bool) {
+	if !common.RedisEnabled {
+		return
+	}
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	err := common.RedisSet(fmt.Sprintf("user_two_factor:%d", id), value, time.Duration(UserId2StatusCacheSeconds)*time.Second)
+	if err != nil {
+		common.SysError("Redis set user two factor error: " + err.Error())
+	}
+}
+
+func CacheGetUserPermissionRoles(id int) (roles string, err error) {
+	if !common.RedisEnabled {
+		return GetUserPermissionRoles(id)
+	}
+	roles, err = common.RedisGet(fmt.Sprintf("user_permission_roles:%d", id))
+	common.RecordCacheResult("user_permission_roles", err == nil)
+	if err != nil {
+		roles, err = GetUserPermissionRoles(id)
+		if err != nil {
+			return "", err
+		}
+		err = common.RedisSet(fmt.Sprintf("user_permission_roles:%d", id), roles, time.Duration(UserId2GroupCacheSeconds)*time.Second)
+		if err != nil {
+			common.SysError("Redis set user permission roles error: " + err.Error())
+		}
+	}
+	return roles, err
+}
+
 func CacheGetUsername(id int) (username string, err error) {
 	if !common.RedisEnabled {
 		return GetUsernameById(id)
 	}
 	username, err = common.RedisGet(fmt.Sprintf("user_name:%d", id))
+	common.RecordCacheResult("user_name", err == nil)
 	if err != nil {
 		username, err = GetUsernameById(id)
 		if err != nil {
@@ -142,6 +200,7 @@ func CacheGetUserQuota(id int) (quota int, err error) {
 		return GetUserQuota(id)
 	}
 	quotaString, err := common.RedisGet(fmt.Sprintf("user_quota:%d", id))
+	common.RecordCacheResult("user_quota", err == nil)
 	if err != nil {
 		quota, err = GetUserQuota(id)
 		if err != nil {
@@ -181,11 +240,77 @@ func CacheDecreaseUserQuota(id int, quota int) error {
 	return err
 }
 
+func organizationBillingQuotaKey(orgId int, userId int) string {
+	return fmt.Sprintf("org_billing_quota:%d:%d", orgId, userId)
+}
+
+// CacheGetOrganizationBillingQuota 缓存成员可用的组织额度。额度池由多个成员共用，其他成员的消耗不会更新这份缓存，
+// 因此缓存只用于提前拒绝请求，预扣费以 PreConsumeOrganizationQuota 的条件更新为准
+func CacheGetOrganizationBillingQuota(orgId int, userId int) (quota int, err error) {
+	if !common.RedisEnabled {
+		return GetOrganizationBillingQuota(orgId, userId)
+	}
+	quotaString, err := common.RedisGet(organizationBillingQuotaKey(orgId, userId))
+	common.RecordCacheResult("organization_quota", err == nil)
+	if err != nil {
+		quota, err = GetOrganizationBillingQuota(orgId, userId)
+		if err != nil {
+			return 0, err
+		}
+		err = common.RedisSet(organizationBillingQuotaKey(orgId, userId), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
+		if err != nil {
+			common.SysError("Redis set organization quota error: " + err.Error())
+		}
+		return quota, nil
+	}
+	return strconv.Atoi(quotaString)
+}
+
+func CacheUpdateOrganizationBillingQuota(orgId int, userId int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	quota, err := GetOrganizationBillingQuota(orgId, userId)
+	if err != nil {
+		CacheDeleteOrganizationBillingQuota(orgId, userId)
+		return err
+	}
+	return common.RedisSet(organizationBillingQuotaKey(orgId, userId), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
+}
+
+func CacheDecreaseOrganizationBillingQuota(orgId int, userId int, quota int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisDecrease(organizationBillingQuotaKey(orgId, userId), int64(quota))
+}
+
+// CacheDeleteOrganizationBillingQuota 组织或成员变更后清除缓存，未指定成员时清除组织内所有成员的缓存
+func CacheDeleteOrganizationBillingQuota(orgId int, userIds ...int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if len(userIds) == 0 {
+		err := DB.Model(&OrganizationMember{}).Where("org_id = ?", orgId).Pluck("user_id", &userIds).Error
+		if err != nil {
+			common.SysError("failed to get organization members: " + err.Error())
+			return
+		}
+	}
+	for _, userId := range userIds {
+		err := common.RedisDel(organizationBillingQuotaKey(orgId, userId))
+		if err != nil {
+			common.SysError("Redis delete organization quota error: " + err.Error())
+		}
+	}
+}
+
 func CacheIsUserEnabled(userId int) (bool, error) {
 	if !common.RedisEnabled {
 		return IsUserEnabled(userId)
 	}
 	enabled, err := common.RedisGet(fmt.Sprintf("user_enabled:%d", userId))
+	common.RecordCacheResult("user_enabled", err == nil)
 	if err == nil {
 		return enabled == "1", nil
 	}
@@ -362,6 +487,7 @@ func CacheGetChannel(id int) (*Channel, error) {
 	defer channelSyncLock.RUnlock()
 
 	c, ok := channelsIDM[id]
+	common.RecordCacheResult("channel", ok)
 	if !ok {
 		return nil, errors.New(fmt.Sprintf("当前渠道# %d，已不存在", id))
 	}
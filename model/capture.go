@@ -0,0 +1,61 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"time"
+)
+
+// Capture 采集的请求与响应内容，由 middleware.Capture 在请求结束后写入，
+// 流式响应保存由各个分片拼接出的完整内容；通过 RequestId 与同一请求的日志关联
+type Capture struct {
+	Id           int    `json:"id"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+	RequestId    string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	TokenId      int    `json:"token_id" gorm:"default:0"`
+	ChannelId    int    `json:"channel_id" gorm:"default:0"`
+	ModelName    string `json:"model_name" gorm:"default:''"`
+	Method       string `json:"method" gorm:"type:varchar(16)"`
+	Path         string `json:"path" gorm:"type:varchar(255)"`
+	StatusCode   int    `json:"status_code"`
+	IsStream     bool   `json:"is_stream" gorm:"default:false"`
+	RequestBody  string `json:"request_body"`
+	ResponseBody string `json:"response_body"`
+	Truncated    bool   `json:"truncated" gorm:"default:false"`
+}
+
+func RecordCapture(capture *Capture) {
+	capture.CreatedAt = common.GetTimestamp()
+	err := LOG_DB.Create(capture).Error
+	if err != nil {
+		common.SysError("failed to record capture: " + err.Error())
+	}
+}
+
+func GetCaptureByRequestId(requestId string) (*Capture, error) {
+	capture := &Capture{}
+	err := LOG_DB.Where("request_id = ?", requestId).First(capture).Error
+	return capture, err
+}
+
+func DeleteExpiredCaptures() {
+	retentionDays := common.GetCaptureConfig().RetentionDays
+	targetTimestamp := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&Capture{})
+	if result.Error != nil {
+		common.SysError("failed to delete expired captures: " + result.Error.Error())
+		return
+	}
+	if result.RowsAffected > 0 {
+		common.SysLog(fmt.Sprintf("deleted %d expired captures", result.RowsAffected))
+	}
+}
+
+// SyncCaptureRetention 定期删除超过保留天数的采集内容
+func SyncCaptureRetention(frequency int) {
+	for {
+		DeleteExpiredCaptures()
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
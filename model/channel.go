@@ -2,6 +2,7 @@ package model
 
 import (
 	"encoding/json"
+	"fmt"
 	"gorm.io/gorm"
 	"one-api/common"
 	"strings"
@@ -33,6 +34,36 @@ type Channel struct {
 	AutoBan           *int    `json:"auto_ban" gorm:"default:1"`
 	OtherInfo         string  `json:"other_info"`
 	Proxy             *string `json:"proxy" gorm:"default:''"`
+	KeyMasked         string  `json:"key_masked,omitempty" gorm:"-"`
+}
+
+// AfterFind 渠道密钥在数据库中加密保存，读取后解密为明文供转发使用
+func (channel *Channel) AfterFind(tx *gorm.DB) error {
+	key, err := common.DecryptChannelKey(channel.Key)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt key of channel #%d: %w", channel.Id, err)
+	}
+	channel.Key = key
+	return nil
+}
+
+// withEncryptedKey 在写入数据库期间将密钥替换为密文，写入完成后恢复明文
+func (channel *Channel) withEncryptedKey(fn func() error) error {
+	plain := channel.Key
+	encrypted, err := common.EncryptChannelKey(plain)
+	if err != nil {
+		return err
+	}
+	channel.Key = encrypted
+	err = fn()
+	channel.Key = plain
+	return err
+}
+
+// MaskKey 清除明文密钥，只保留脱敏后的密钥用于展示
+func (channel *Channel) MaskKey() {
+	channel.KeyMasked = common.MaskChannelKey(channel.Key)
+	channel.Key = ""
 }
 
 func (channel *Channel) GetModels() []string {
@@ -70,7 +101,9 @@ func (channel *Channel) GetAutoBan() bool {
 }
 
 func (channel *Channel) Save() error {
-	return DB.Save(channel).Error
+	return channel.withEncryptedKey(func() error {
+		return DB.Save(channel).Error
+	})
 }
 
 func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool) (channels []*Channel, total int64, err error) {
@@ -124,11 +157,11 @@ func SearchChannels(keyword string, group string, model string, idSort bool) (ch
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause = "(id = ? OR name LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause = "(id = ? OR name LIKE ?) AND " + modelsCol + " LIKE ?"
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", "%"+model+"%")
 	}
 	baseQuery = baseQuery.Where(whereClause, args...)
 
@@ -158,6 +191,12 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 
 func BatchInsertChannels(channels []Channel) error {
 	var err error
+	for i := range channels {
+		channels[i].Key, err = common.EncryptChannelKey(channels[i].Key)
+		if err != nil {
+			return err
+		}
+	}
 	err = DB.Create(&channels).Error
 	if err != nil {
 		return err
@@ -228,7 +267,9 @@ func (channel *Channel) GetStatusCodeMapping() string {
 
 func (channel *Channel) Insert() error {
 	var err error
-	err = DB.Create(channel).Error
+	err = channel.withEncryptedKey(func() error {
+		return DB.Create(channel).Error
+	})
 	if err != nil {
 		return err
 	}
@@ -238,7 +279,9 @@ func (channel *Channel) Insert() error {
 
 func (channel *Channel) Update() error {
 	var err error
-	err = DB.Model(channel).Updates(channel).Error
+	err = channel.withEncryptedKey(func() error {
+		return DB.Model(channel).Updates(channel).Error
+	})
 	if err != nil {
 		return err
 	}
@@ -328,3 +371,39 @@ func DeleteDisabledChannel() (int64, error) {
 	result := DB.Where("status = ? or status = ?", common.ChannelStatusAutoDisabled, common.ChannelStatusManuallyDisabled).Delete(&Channel{})
 	return result.RowsAffected, result.Error
 }
+
+// ReencryptChannelKeys 将明文密钥或由旧主密钥加密的密钥使用当前主密钥重新加密，返回处理的渠道数量
+func ReencryptChannelKeys() (int, error) {
+	if !common.ChannelKeyEncryptionEnabled() {
+		return 0, nil
+	}
+	var rows []struct {
+		Id  int
+		Key string
+	}
+	// 不经过 Channel 结构体读取，避免 AfterFind 解密
+	err := DB.Table("channels").Select("id", "key").Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, row := range rows {
+		if !common.ChannelKeyNeedsReencryption(row.Key) {
+			continue
+		}
+		plain, err := common.DecryptChannelKey(row.Key)
+		if err != nil {
+			return count, fmt.Errorf("failed to decrypt key of channel #%d: %w", row.Id, err)
+		}
+		encrypted, err := common.EncryptChannelKey(plain)
+		if err != nil {
+			return count, err
+		}
+		err = DB.Table("channels").Where("id = ?", row.Id).Update("key", encrypted).Error
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
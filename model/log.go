@@ -2,12 +2,12 @@ package model
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"one-api/common"
 	"strings"
 	"time"
 
-	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
 )
 
@@ -27,7 +27,9 @@ type Log struct {
 	IsStream         bool   `json:"is_stream" gorm:"default:false"`
 	ChannelId        int    `json:"channel" gorm:"index"`
 	TokenId          int    `json:"token_id" gorm:"default:0;index"`
+	OrgId            int    `json:"org_id" gorm:"default:0;index"`
 	Other            string `json:"other"`
+	RequestId        string `json:"request_id" gorm:"type:varchar(64);index;default:''"`
 }
 
 const (
@@ -36,10 +38,15 @@ const (
 	LogTypeConsume
 	LogTypeManage
 	LogTypeSystem
+	LogTypeError
 )
 
 func GetLogByKey(key string) (logs []*Log, err error) {
-	err = LOG_DB.Joins("left join tokens on tokens.id = logs.token_id").Where("tokens.key = ?", strings.TrimPrefix(key, "sk-")).Find(&logs).Error
+	token, err := GetTokenByKey(strings.TrimPrefix(key, "sk-"))
+	if err != nil {
+		return nil, errors.New("无效的令牌")
+	}
+	err = LOG_DB.Where("token_id = ?", token.Id).Find(&logs).Error
 	return logs, err
 }
 
@@ -63,14 +70,17 @@ func RecordLog(userId int, logType int, content string) {
 
 func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int, content string, tokenId int, userQuota int, useTimeSeconds int, isStream bool, other map[string]interface{}) {
 	common.LogInfo(ctx, fmt.Sprintf("record consume log: userId=%d, 用户调用前余额=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, userQuota, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
+	// gin.Context 的 Value 会返回请求上下文中设置的键
+	group, _ := ctx.Value("group").(string)
+	common.RecordQuotaConsumed(modelName, group, quota)
 	if !common.LogConsumeEnabled {
 		return
 	}
-	username, _ := CacheGetUsername(userId)
 	otherStr := common.MapToJsonStr(other)
+	orgId, _ := ctx.Value("token_org_id").(int)
+	requestId, _ := ctx.Value(common.RequestIdKey).(string)
 	log := &Log{
 		UserId:           userId,
-		Username:         username,
 		CreatedAt:        common.GetTimestamp(),
 		Type:             LogTypeConsume,
 		Content:          content,
@@ -81,21 +91,65 @@ func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptToke
 		Quota:            quota,
 		ChannelId:        channelId,
 		TokenId:          tokenId,
+		OrgId:            orgId,
 		UseTime:          useTimeSeconds,
 		IsStream:         isStream,
 		Other:            otherStr,
+		RequestId:        requestId,
 	}
-	err := LOG_DB.Create(log).Error
-	if err != nil {
-		common.LogError(ctx, "failed to record log: "+err.Error())
+	if common.LogBatchEnabled {
+		// 用户名由写入协程按批查询
+		enqueueConsumeLog(log)
+	} else {
+		log.Username, _ = CacheGetUsername(userId)
+		err := LOG_DB.Create(log).Error
+		if err != nil {
+			common.LogError(ctx, "failed to record log: "+err.Error())
+		}
 	}
 	if common.DataExportEnabled {
-		gopool.Go(func() {
-			LogQuotaData(userId, username, modelName, quota, common.GetTimestamp(), promptTokens+completionTokens)
-		})
+		// 用户名在保存使用数据时按批查询
+		LogQuotaData(userId, orgId, "", modelName, quota, common.GetTimestamp(), promptTokens+completionTokens)
+	}
+}
+
+// RecordErrorLog 记录一次失败的转发尝试，同一请求的多次重试各记录一条
+func RecordErrorLog(ctx context.Context, userId int, channelId int, modelName string, tokenName string, tokenId int, content string, useTimeSeconds int, other map[string]interface{}) {
+	if !common.LogConsumeEnabled {
+		return
+	}
+	requestId, _ := ctx.Value(common.RequestIdKey).(string)
+	orgId, _ := ctx.Value("token_org_id").(int)
+	log := &Log{
+		UserId:    userId,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeError,
+		Content:   content,
+		TokenName: tokenName,
+		ModelName: modelName,
+		ChannelId: channelId,
+		TokenId:   tokenId,
+		OrgId:     orgId,
+		UseTime:   useTimeSeconds,
+		Other:     common.MapToJsonStr(other),
+		RequestId: requestId,
+	}
+	if common.LogBatchEnabled {
+		enqueueConsumeLog(log)
+		return
+	}
+	log.Username, _ = CacheGetUsername(userId)
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		common.LogError(ctx, "failed to record error log: "+err.Error())
 	}
 }
 
+func GetLogsByRequestId(requestId string) (logs []*Log, err error) {
+	err = LOG_DB.Where("request_id = ?", requestId).Order("id asc").Find(&logs).Error
+	return logs, err
+}
+
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int) (logs []*Log, total int64, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
@@ -169,6 +223,40 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	return logs, total, err
 }
 
+// GetOrganizationLogs 查询组织令牌产生的消费日志，userId 不为 0 时只查询该成员
+func GetOrganizationLogs(orgId int, userId int, startTimestamp int64, endTimestamp int64, modelName string, username string, startIdx int, num int) (logs []*Log, total int64, err error) {
+	logs = []*Log{}
+	tx := LOG_DB.Where("org_id = ? and type = ?", orgId, LogTypeConsume)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name like ?", modelName)
+	}
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Model(&Log{}).Count(&total).Error
+	if err != nil || total == 0 {
+		return logs, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id").Find(&logs).Error
+	for i := range logs {
+		otherMap := common.StrToMap(logs[i].Other)
+		if otherMap != nil {
+			delete(otherMap, "admin_info")
+		}
+		logs[i].Other = common.MapToJsonStr(otherMap)
+	}
+	return logs, total, err
+}
+
 func SearchAllLogs(keyword string) (logs []*Log, err error) {
 	err = LOG_DB.Where("type = ? or content LIKE ?", keyword, keyword+"%").Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	return logs, err
@@ -176,6 +264,13 @@ func SearchAllLogs(keyword string) (logs []*Log, err error) {
 
 func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
 	err = LOG_DB.Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(common.MaxRecentItems).Omit("id").Find(&logs).Error
+	for i := range logs {
+		otherMap := common.StrToMap(logs[i].Other)
+		if otherMap != nil {
+			delete(otherMap, "admin_info")
+		}
+		logs[i].Other = common.MapToJsonStr(otherMap)
+	}
 	return logs, err
 }
 
@@ -248,7 +343,9 @@ func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	return token
 }
 
-func DeleteOldLog(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+// DeleteOldLog 分批删除 [startTimestamp, targetTimestamp) 内的日志，startTimestamp 为 0 时不限开始时间，
+// logType 为 LogTypeUnknown 时删除全部类型
+func DeleteOldLog(ctx context.Context, startTimestamp int64, targetTimestamp int64, logType int, limit int) (int64, error) {
 	var total int64 = 0
 
 	for {
@@ -256,7 +353,14 @@ func DeleteOldLog(ctx context.Context, targetTimestamp int64, limit int) (int64,
 			return total, ctx.Err()
 		}
 
-		result := LOG_DB.Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&Log{})
+		tx := LOG_DB.Where("created_at < ?", targetTimestamp)
+		if startTimestamp != 0 {
+			tx = tx.Where("created_at >= ?", startTimestamp)
+		}
+		if logType != LogTypeUnknown {
+			tx = tx.Where("type = ?", logType)
+		}
+		result := tx.Limit(limit).Delete(&Log{})
 		if nil != result.Error {
 			return total, result.Error
 		}
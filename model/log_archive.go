@@ -0,0 +1,363 @@
+package model
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"one-api/common"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// 日志保留与归档（见 common.LogRetentionConfig）
+//
+// 主节点按类型找出早于保留期限的整天日志，逐天导出为 <类型>-<日期>.jsonl.gz（先写临时文件再重命名），
+// 并在 log_archives 中记录已导出的最大 id 后再分批删除，只删除不超过该 id 的日志。
+// 某天已有归档记录时，只把 id 更大的日志（归档后才写入的）追加为新的 gzip 分段，不重复导出。
+// 恢复时按原 id 写回 LOG_DB，已存在的日志会被跳过，恢复过的日期在 logArchiveRestoreHoldDays 天内不会被再次删除。
+
+const (
+	logArchiveDayFormat        = "2006-01-02"
+	logArchiveBatchSize        = 1000
+	logArchiveRestoreHoldDays  = 7
+	logArchiveRestoreBatchSize = 50 // SQLite 单条语句最多 999 个参数
+)
+
+// LogArchive 一个类型一天的日志归档文件
+type LogArchive struct {
+	Id         int    `json:"id"`
+	LogType    int    `json:"log_type" gorm:"uniqueIndex:idx_log_archive_type_day,priority:1"`
+	Day        string `json:"day" gorm:"type:varchar(10);uniqueIndex:idx_log_archive_type_day,priority:2"`
+	FileName   string `json:"file_name" gorm:"type:varchar(255)"`
+	RowCount   int64  `json:"row_count"`
+	MaxId      int    `json:"max_id" gorm:"default:0"` // 已导出日志的最大 id
+	Size       int64  `json:"size"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+	RestoredAt int64  `json:"restored_at" gorm:"bigint;default:0"`
+}
+
+func getLogArchiveDir() string {
+	if common.LogArchiveDir != "" {
+		return common.LogArchiveDir
+	}
+	return filepath.Join(*common.LogDir, "archive")
+}
+
+// SyncLogRetention 定期按保留策略归档并删除过期日志
+func SyncLogRetention(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		config := common.GetLogRetentionConfig()
+		if !config.Enabled {
+			continue
+		}
+		common.SysLog("applying log retention")
+		err := ApplyLogRetention(context.Background(), config)
+		if err != nil {
+			common.SysError("failed to apply log retention: " + err.Error())
+		}
+	}
+}
+
+func ApplyLogRetention(ctx context.Context, config *common.LogRetentionConfig) error {
+	now := time.Now()
+	for name, days := range config.RetentionDays {
+		if days <= 0 {
+			continue
+		}
+		logType := common.LogTypeNames[name]
+		y, m, d := now.AddDate(0, 0, -days).Date()
+		cutoff := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+		count, err := applyLogTypeRetention(ctx, logType, name, cutoff, config.ArchiveEnabled)
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("deleted %d expired %s logs before %s", count, name, cutoff.Format(logArchiveDayFormat)))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyLogTypeRetention(ctx context.Context, logType int, name string, cutoff time.Time, archive bool) (int64, error) {
+	var minCreatedAt int64
+	err := LOG_DB.Model(&Log{}).Where("type = ? and created_at < ?", logType, cutoff.Unix()).
+		Select("coalesce(min(created_at), 0)").Scan(&minCreatedAt).Error
+	if err != nil || minCreatedAt == 0 {
+		return 0, err
+	}
+	if !archive {
+		return DeleteOldLog(ctx, 0, cutoff.Unix(), logType, logArchiveBatchSize)
+	}
+	holdUntil := time.Now().AddDate(0, 0, -logArchiveRestoreHoldDays).Unix()
+	var total int64
+	y, m, d := time.Unix(minCreatedAt, 0).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, time.Local); day.Before(cutoff); day = day.AddDate(0, 0, 1) {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		dayStr := day.Format(logArchiveDayFormat)
+		archived := &LogArchive{}
+		err = LOG_DB.Where("log_type = ? and day = ?", logType, dayStr).Limit(1).Find(archived).Error
+		if err != nil {
+			return total, err
+		}
+		if archived.Id == 0 {
+			archived = nil
+		} else if archived.RestoredAt > holdUntil {
+			continue
+		}
+		archived, err = archiveLogDay(ctx, logType, name, day, archived)
+		if err != nil {
+			return total, fmt.Errorf("归档 %s 日志 %s 失败: %w", name, dayStr, err)
+		}
+		if archived == nil {
+			continue
+		}
+		count, err := deleteArchivedLogDay(ctx, logType, day, archived.MaxId)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// deleteArchivedLogDay 分批删除一天中 id 不超过 maxId（已归档）的日志
+func deleteArchivedLogDay(ctx context.Context, logType int, day time.Time, maxId int) (int64, error) {
+	var total int64
+	for {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		result := LOG_DB.Where("type = ? and created_at >= ? and created_at < ? and id <= ?", logType, day.Unix(), day.AddDate(0, 0, 1).Unix(), maxId).
+			Limit(logArchiveBatchSize).Delete(&Log{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < logArchiveBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// archiveLogDay 导出一天中 id 大于已归档最大 id 的日志，existing 不为 nil 时追加到原归档文件之后。
+// 没有需要导出的日志时返回 existing（首次归档时为 nil）
+func archiveLogDay(ctx context.Context, logType int, name string, day time.Time, existing *LogArchive) (*LogArchive, error) {
+	lastId := 0
+	if existing != nil {
+		lastId = existing.MaxId
+	}
+	var pendingIds []int
+	err := LOG_DB.Model(&Log{}).Where("type = ? and created_at >= ? and created_at < ? and id > ?", logType, day.Unix(), day.AddDate(0, 0, 1).Unix(), lastId).
+		Limit(1).Pluck("id", &pendingIds).Error
+	if err != nil || len(pendingIds) == 0 {
+		return existing, err
+	}
+
+	dir := getLogArchiveDir()
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	dayStr := day.Format(logArchiveDayFormat)
+	fileName := fmt.Sprintf("%s-%s.jsonl.gz", name, dayStr)
+	if existing != nil {
+		fileName = existing.FileName
+	}
+	path := filepath.Join(dir, fileName)
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+	if existing != nil {
+		// gzip 允许多个分段首尾相接，读取时会依次解压
+		if err = copyLogArchiveFile(file, path); err != nil {
+			return nil, err
+		}
+	}
+
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	var rows int64
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var logs []*Log
+		err = LOG_DB.Where("type = ? and created_at >= ? and created_at < ? and id > ?", logType, day.Unix(), day.AddDate(0, 0, 1).Unix(), lastId).
+			Order("id asc").Limit(logArchiveBatchSize).Find(&logs).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			if err = encoder.Encode(log); err != nil {
+				return nil, err
+			}
+		}
+		rows += int64(len(logs))
+		if len(logs) > 0 {
+			lastId = logs[len(logs)-1].Id
+		}
+		if len(logs) < logArchiveBatchSize {
+			break
+		}
+	}
+	if rows == 0 {
+		return existing, nil
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	if err = file.Sync(); err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err = file.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		existing.RowCount += rows
+		existing.MaxId = lastId
+		existing.Size = info.Size()
+		err = LOG_DB.Model(existing).Updates(map[string]interface{}{
+			"row_count": existing.RowCount,
+			"max_id":    existing.MaxId,
+			"size":      existing.Size,
+		}).Error
+		return existing, err
+	}
+	archived := &LogArchive{
+		LogType:   logType,
+		Day:       dayStr,
+		FileName:  fileName,
+		RowCount:  rows,
+		MaxId:     lastId,
+		Size:      info.Size(),
+		CreatedAt: common.GetTimestamp(),
+	}
+	err = LOG_DB.Create(archived).Error
+	return archived, err
+}
+
+func copyLogArchiveFile(dst *os.File, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// GetLogArchives 按日期范围（含首尾，格式 2006-01-02）查询归档，logType 为 LogTypeUnknown 时查询全部类型
+func GetLogArchives(logType int, startDay string, endDay string) (archives []*LogArchive, err error) {
+	tx := LOG_DB.Model(&LogArchive{})
+	if logType != LogTypeUnknown {
+		tx = tx.Where("log_type = ?", logType)
+	}
+	if startDay != "" {
+		tx = tx.Where("day >= ?", startDay)
+	}
+	if endDay != "" {
+		tx = tx.Where("day <= ?", endDay)
+	}
+	err = tx.Order("day asc, log_type asc").Find(&archives).Error
+	return archives, err
+}
+
+// RestoreLogArchives 将日期范围内的归档写回日志表，返回新写入的日志数
+func RestoreLogArchives(ctx context.Context, logType int, startDay string, endDay string) (int64, error) {
+	archives, err := GetLogArchives(logType, startDay, endDay)
+	if err != nil {
+		return 0, err
+	}
+	if len(archives) == 0 {
+		return 0, errors.New("该日期范围内没有归档")
+	}
+	var total int64
+	for _, archived := range archives {
+		count, err := restoreLogArchive(ctx, archived)
+		total += count
+		if err != nil {
+			return total, fmt.Errorf("恢复归档 %s 失败: %w", archived.FileName, err)
+		}
+		archived.RestoredAt = common.GetTimestamp()
+		err = LOG_DB.Model(archived).Update("restored_at", archived.RestoredAt).Error
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func restoreLogArchive(ctx context.Context, archived *LogArchive) (int64, error) {
+	file, err := os.Open(filepath.Join(getLogArchiveDir(), archived.FileName))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer gzipReader.Close()
+
+	var total int64
+	batch := make([]*Log, 0, logArchiveRestoreBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result := LOG_DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&batch)
+		if result.Error != nil {
+			return result.Error
+		}
+		total += result.RowsAffected
+		batch = batch[:0]
+		return nil
+	}
+	reader := bufio.NewReader(gzipReader)
+	for {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			log := &Log{}
+			if jsonErr := json.Unmarshal(line, log); jsonErr != nil {
+				return total, jsonErr
+			}
+			batch = append(batch, log)
+			if len(batch) >= logArchiveRestoreBatchSize {
+				if err := flush(); err != nil {
+					return total, err
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, flush()
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"context"
+	"one-api/common"
+	"testing"
+	"time"
+)
+
+func setupTestLogArchive(t *testing.T) time.Time {
+	t.Helper()
+	setupTestDB(t)
+	dir := common.LogArchiveDir
+	common.LogArchiveDir = t.TempDir()
+	t.Cleanup(func() {
+		common.LogArchiveDir = dir
+	})
+	y, m, d := time.Now().AddDate(0, 0, -30).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+func createTestLogs(t *testing.T, day time.Time, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		log := &Log{UserId: 1, Type: LogTypeConsume, CreatedAt: day.Add(time.Duration(i+1) * time.Minute).Unix(), Content: "test"}
+		if err := LOG_DB.Create(log).Error; err != nil {
+			t.Fatalf("create log: %v", err)
+		}
+	}
+}
+
+func countTestLogs(t *testing.T, day time.Time) int64 {
+	t.Helper()
+	var count int64
+	err := LOG_DB.Model(&Log{}).Where("type = ? and created_at >= ? and created_at < ?", LogTypeConsume, day.Unix(), day.AddDate(0, 0, 1).Unix()).
+		Count(&count).Error
+	if err != nil {
+		t.Fatalf("count logs: %v", err)
+	}
+	return count
+}
+
+// 归档后再写入的日志会追加到归档文件中，恢复时能全部写回
+func TestLogArchiveRoundTrip(t *testing.T) {
+	day := setupTestLogArchive(t)
+	dayStr := day.Format(logArchiveDayFormat)
+	cutoff := day.AddDate(0, 0, 1)
+	ctx := context.Background()
+
+	steps := []struct {
+		name        string
+		newLogs     int
+		wantDeleted int64
+		wantRows    int64
+	}{
+		{"archive day", 3, 3, 3},
+		{"late logs appended", 2, 2, 5},
+		{"nothing new", 0, 0, 5},
+	}
+	for _, step := range steps {
+		createTestLogs(t, day, step.newLogs)
+		// 写入一条未过期的日志，与线上一样让日志 id 持续增长（SQLite 删除最大 id 后会复用）
+		createTestLogs(t, time.Now().Add(-time.Hour), 1)
+		deleted, err := applyLogTypeRetention(ctx, LogTypeConsume, "consume", cutoff, true)
+		if err != nil {
+			t.Fatalf("%s: applyLogTypeRetention error: %v", step.name, err)
+		}
+		if deleted != step.wantDeleted {
+			t.Errorf("%s: deleted %d logs, want %d", step.name, deleted, step.wantDeleted)
+		}
+		archives, err := GetLogArchives(LogTypeConsume, dayStr, dayStr)
+		if err != nil {
+			t.Fatalf("%s: GetLogArchives error: %v", step.name, err)
+		}
+		if len(archives) != 1 || archives[0].RowCount != step.wantRows {
+			t.Fatalf("%s: got archives %+v, want one with %d rows", step.name, archives, step.wantRows)
+		}
+		if count := countTestLogs(t, day); count != 0 {
+			t.Errorf("%s: %d logs left after retention, want 0", step.name, count)
+		}
+	}
+
+	restored, err := RestoreLogArchives(ctx, LogTypeConsume, dayStr, dayStr)
+	if err != nil {
+		t.Fatalf("RestoreLogArchives error: %v", err)
+	}
+	if restored != 5 || countTestLogs(t, day) != 5 {
+		t.Errorf("restored %d logs, table has %d, want 5", restored, countTestLogs(t, day))
+	}
+	restored, err = RestoreLogArchives(ctx, LogTypeConsume, dayStr, dayStr)
+	if err != nil {
+		t.Fatalf("RestoreLogArchives again error: %v", err)
+	}
+	if restored != 0 || countTestLogs(t, day) != 5 {
+		t.Errorf("second restore wrote %d logs, table has %d, want 0 and 5", restored, countTestLogs(t, day))
+	}
+}
+
+// 恢复过的日期在保留窗口内不会被再次删除
+func TestLogArchiveRestoreHold(t *testing.T) {
+	tests := []struct {
+		name        string
+		restoredAgo time.Duration
+		wantDeleted int64
+	}{
+		{"just restored", time.Hour, 0},
+		{"hold expired", (logArchiveRestoreHoldDays + 1) * 24 * time.Hour, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day := setupTestLogArchive(t)
+			dayStr := day.Format(logArchiveDayFormat)
+			cutoff := day.AddDate(0, 0, 1)
+			ctx := context.Background()
+			createTestLogs(t, day, 3)
+			if _, err := applyLogTypeRetention(ctx, LogTypeConsume, "consume", cutoff, true); err != nil {
+				t.Fatalf("applyLogTypeRetention error: %v", err)
+			}
+			if _, err := RestoreLogArchives(ctx, LogTypeConsume, dayStr, dayStr); err != nil {
+				t.Fatalf("RestoreLogArchives error: %v", err)
+			}
+			restoredAt := time.Now().Add(-tt.restoredAgo).Unix()
+			if err := LOG_DB.Model(&LogArchive{}).Where("day = ?", dayStr).Update("restored_at", restoredAt).Error; err != nil {
+				t.Fatalf("update restored_at: %v", err)
+			}
+
+			deleted, err := applyLogTypeRetention(ctx, LogTypeConsume, "consume", cutoff, true)
+			if err != nil {
+				t.Fatalf("applyLogTypeRetention error: %v", err)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("deleted %d logs, want %d", deleted, tt.wantDeleted)
+			}
+			archives, err := GetLogArchives(LogTypeConsume, dayStr, dayStr)
+			if err != nil {
+				t.Fatalf("GetLogArchives error: %v", err)
+			}
+			if len(archives) != 1 || archives[0].RowCount != 3 {
+				t.Errorf("restored logs were archived again: %+v", archives)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"context"
+	"one-api/common"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 用户查询自己的日志时不能看到 admin_info 中上游返回的原始错误信息
+func TestUserLogsHideAdminInfo(t *testing.T) {
+	setupTestDB(t)
+	common.LogConsumeEnabled = true
+	common.LogBatchEnabled = false
+
+	const upstreamMessage = "upstream https://internal.example:8443 rejected key sk-secret"
+	RecordErrorLog(context.Background(), 1, 3, "gpt-4o", "default", 0, "请求失败，状态码 500", 0, map[string]interface{}{
+		"status_code": 500,
+		"admin_info": map[string]interface{}{
+			"error_message": upstreamMessage,
+		},
+	})
+
+	tests := []struct {
+		name  string
+		query func() ([]*Log, error)
+	}{
+		{"get user logs", func() ([]*Log, error) {
+			logs, _, err := GetUserLogs(1, LogTypeUnknown, 0, 0, "", "", 0, 10)
+			return logs, err
+		}},
+		{"search user logs", func() ([]*Log, error) {
+			return SearchUserLogs(1, strconv.Itoa(LogTypeError))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, err := tt.query()
+			if err != nil {
+				t.Fatalf("query logs: %v", err)
+			}
+			if len(logs) != 1 {
+				t.Fatalf("got %d logs, want 1", len(logs))
+			}
+			if strings.Contains(logs[0].Content, "internal.example") || strings.Contains(logs[0].Other, "admin_info") {
+				t.Errorf("upstream error leaked: content = %q, other = %q", logs[0].Content, logs[0].Other)
+			}
+		})
+	}
+
+	logs, _, err := GetAllLogs(LogTypeError, 0, 0, "", "", "", 0, 10, 0)
+	if err != nil {
+		t.Fatalf("get all logs: %v", err)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0].Other, upstreamMessage) {
+		t.Errorf("admin should see upstream error, got %+v", logs)
+	}
+}
+
+// 批量写入时用户名按批查询，已有用户名的日志保持不变
+func TestFillConsumeLogUsernames(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, 500)
+	createTestUser(t, 501)
+	usernames := GetUsernamesByIds([]int{500, 501, 500, 9999})
+	if len(usernames) != 2 {
+		t.Fatalf("GetUsernamesByIds returned %d users, want 2", len(usernames))
+	}
+
+	logs := []*Log{
+		{UserId: 500},
+		{UserId: 501},
+		{UserId: 500},
+		{UserId: 501, Username: "kept"},
+		{UserId: 9999},
+	}
+	fillConsumeLogUsernames(logs)
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, usernames[500]},
+		{1, usernames[501]},
+		{2, usernames[500]},
+		{3, "kept"},
+		{4, ""},
+	}
+	for _, tt := range tests {
+		if logs[tt.index].Username != tt.want {
+			t.Errorf("logs[%d].Username = %q, want %q", tt.index, logs[tt.index].Username, tt.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 消费日志异步批量写入（LOG_BATCH_ENABLED=true 时开启）
+//
+// RecordConsumeLog 只将日志放入内存队列，由单个写入协程按 LOG_BATCH_SIZE 条或每 LOG_BATCH_INTERVAL 秒
+// 通过 CreateInBatches 写入 LOG_DB，用户名也在写入时按批查询。
+//
+// 顺序：同一进程内日志按进入队列的顺序写入；写入失败落盘后再补写的日志 id 会晚于之后的日志，但 created_at 保持不变，
+// 多个节点之间不保证顺序。
+//
+// 丢失：队列满时请求会阻塞等待（背压）。数据库写入失败时整批改为逐条写入，仍失败的日志追加到本地文件
+// （LOG_BATCH_SPILL_FILE，默认为日志目录下的 consume-log-spill.jsonl），每分钟尝试补写一次。
+// 收到 SIGINT/SIGTERM 正常退出时会写完队列中的日志；进程被强制结束时，队列中尚未写入的日志（最多
+// LOG_BATCH_QUEUE_SIZE + LOG_BATCH_SIZE 条）会丢失，落盘也失败的日志同样会丢失。
+// 开启后消费日志写入前无法得知日志 id，请求采集内容不会关联 LogId，可通过请求 ID 查找对应的日志。
+// 失败转发尝试的错误日志同样经由该队列写入。
+
+const consumeLogSpillReplayInterval = time.Minute
+
+var (
+	consumeLogQueue    chan *Log
+	consumeLogStop     chan struct{}
+	consumeLogDone     chan struct{}
+	consumeLogLock     sync.RWMutex
+	consumeLogStopping bool
+	consumeLogSpill    string
+)
+
+func InitConsumeLogWriter() {
+	consumeLogQueue = make(chan *Log, common.LogBatchQueueSize)
+	consumeLogStop = make(chan struct{})
+	consumeLogDone = make(chan struct{})
+	consumeLogSpill = common.LogBatchSpillFile
+	if consumeLogSpill == "" {
+		consumeLogSpill = filepath.Join(*common.LogDir, "consume-log-spill.jsonl")
+	}
+	go runConsumeLogWriter()
+}
+
+// FlushConsumeLogs 停止接收新日志并写完队列中的日志，之后的消费日志改为同步写入
+func FlushConsumeLogs() {
+	if consumeLogQueue == nil {
+		return
+	}
+	consumeLogLock.Lock()
+	if consumeLogStopping {
+		consumeLogLock.Unlock()
+		return
+	}
+	consumeLogStopping = true
+	consumeLogLock.Unlock()
+	close(consumeLogStop)
+	<-consumeLogDone
+	common.SysLog("consume logs flushed")
+}
+
+func enqueueConsumeLog(log *Log) {
+	consumeLogLock.RLock()
+	defer consumeLogLock.RUnlock()
+	if consumeLogStopping {
+		writeConsumeLogs([]*Log{log})
+		return
+	}
+	consumeLogQueue <- log
+}
+
+func runConsumeLogWriter() {
+	replayConsumeLogSpill()
+	lastReplay := time.Now()
+	ticker := time.NewTicker(time.Duration(common.LogBatchInterval) * time.Second)
+	defer ticker.Stop()
+	batch := make([]*Log, 0, common.LogBatchSize)
+	healthy := true
+	flush := func() {
+		if len(batch) > 0 {
+			healthy = writeConsumeLogs(batch)
+			batch = make([]*Log, 0, common.LogBatchSize)
+		}
+	}
+	for {
+		select {
+		case log := <-consumeLogQueue:
+			batch = append(batch, log)
+			if len(batch) >= common.LogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			// 数据库仍不可用时不补写，避免反复落盘
+			if healthy && time.Since(lastReplay) >= consumeLogSpillReplayInterval {
+				replayConsumeLogSpill()
+				lastReplay = time.Now()
+			}
+		case <-consumeLogStop:
+			// FlushConsumeLogs 持有写锁后不会再有日志进入队列
+		drain:
+			for {
+				select {
+				case log := <-consumeLogQueue:
+					batch = append(batch, log)
+				default:
+					break drain
+				}
+			}
+			flush()
+			close(consumeLogDone)
+			return
+		}
+	}
+}
+
+// writeConsumeLogs 批量写入日志，失败时逐条重试，仍失败的日志落盘，返回批量写入是否成功
+func writeConsumeLogs(logs []*Log) bool {
+	fillConsumeLogUsernames(logs)
+	err := LOG_DB.CreateInBatches(logs, common.LogBatchSize).Error
+	if err == nil {
+		return true
+	}
+	common.SysError("failed to batch record logs: " + err.Error())
+	failed := make([]*Log, 0)
+	for _, log := range logs {
+		log.Id = 0
+		if LOG_DB.Create(log).Error != nil {
+			log.Id = 0
+			failed = append(failed, log)
+		}
+	}
+	if len(failed) > 0 {
+		spillConsumeLogs(failed)
+	}
+	return false
+}
+
+// fillConsumeLogUsernames 一次查询补全整批日志的用户名
+func fillConsumeLogUsernames(logs []*Log) {
+	userIds := make([]int, 0)
+	for _, log := range logs {
+		if log.Username == "" {
+			userIds = append(userIds, log.UserId)
+		}
+	}
+	if len(userIds) == 0 {
+		return
+	}
+	usernames := GetUsernamesByIds(userIds)
+	for _, log := range logs {
+		if log.Username == "" {
+			log.Username = usernames[log.UserId]
+		}
+	}
+}
+
+func spillConsumeLogs(logs []*Log) {
+	file, err := os.OpenFile(consumeLogSpill, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to open consume log spill file, %d logs lost: %s", len(logs), err.Error()))
+		return
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, log := range logs {
+		if err = encoder.Encode(log); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		common.SysError("failed to write consume log spill file: " + err.Error())
+		return
+	}
+	common.SysError(fmt.Sprintf("spilled %d consume logs to %s", len(logs), consumeLogSpill))
+}
+
+// replayConsumeLogSpill 补写落盘的日志，先将文件改名，补写失败的日志会重新落盘
+func replayConsumeLogSpill() {
+	replaying := consumeLogSpill + ".replay"
+	// 上次补写中途退出时留下的文件优先处理
+	if _, err := os.Stat(replaying); errors.Is(err, os.ErrNotExist) {
+		if err = os.Rename(consumeLogSpill, replaying); err != nil {
+			return
+		}
+	}
+	file, err := os.Open(replaying)
+	if err != nil {
+		common.SysError("failed to open consume log spill file: " + err.Error())
+		return
+	}
+	total := 0
+	batch := make([]*Log, 0, common.LogBatchSize)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		log := &Log{}
+		if err = json.Unmarshal(scanner.Bytes(), log); err != nil {
+			common.SysError("skip invalid spilled consume log: " + err.Error())
+			continue
+		}
+		batch = append(batch, log)
+		if len(batch) >= common.LogBatchSize {
+			writeConsumeLogs(batch)
+			total += len(batch)
+			batch = make([]*Log, 0, common.LogBatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		writeConsumeLogs(batch)
+		total += len(batch)
+	}
+	if err = scanner.Err(); err != nil {
+		common.SysError("failed to read consume log spill file: " + err.Error())
+	}
+	_ = file.Close()
+	_ = os.Remove(replaying)
+	common.SysLog(fmt.Sprintf("replayed %d spilled consume logs", total))
+}
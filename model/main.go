@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -120,7 +121,11 @@ func InitDB() (err error) {
 func InitLogDB() (err error) {
 	if os.Getenv("LOG_SQL_DSN") == "" {
 		LOG_DB = DB
-		return
+		// 与主库共用时，日志相关的表同样由 migrateLOGDB 迁移
+		if !common.IsMasterNode {
+			return nil
+		}
+		return migrateLOGDB()
 	}
 	db, err := chooseDB("LOG_SQL_DSN")
 	if err == nil {
@@ -159,10 +164,21 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	count, err := ReencryptChannelKeys()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		common.SysLog(fmt.Sprintf("encrypted %d channel keys with current master key", count))
+	}
 	err = DB.AutoMigrate(&Token{})
 	if err != nil {
 		return err
 	}
+	err = migrateTokenKeys()
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&User{})
 	if err != nil {
 		return err
@@ -175,6 +191,38 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&RedemptionCampaign{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&RedemptionUsage{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&QuotaAlert{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&UserIdentity{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&TwoFactor{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Organization{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&OrganizationMember{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&PersonalAccessToken{})
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&Ability{})
 	if err != nil {
 		return err
@@ -195,6 +243,10 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&AnalyticsData{})
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&Task{})
 	if err != nil {
 		return err
@@ -209,6 +261,15 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
+	if err = LOG_DB.AutoMigrate(&Capture{}); err != nil {
+		return err
+	}
+	if err = LOG_DB.AutoMigrate(&LogArchive{}); err != nil {
+		return err
+	}
 	return nil
 }
 
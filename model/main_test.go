@@ -0,0 +1,30 @@
+package model
+
+import (
+	"one-api/common"
+	"path/filepath"
+	"testing"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "model.db")
+	if err := InitDB(); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	if err := InitLogDB(); err != nil {
+		t.Fatalf("init log db: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = CloseDB()
+	})
+}
+
+func createTestUser(t *testing.T, id int) {
+	t.Helper()
+	user := &User{Id: id, Username: common.GetRandomString(12), AffCode: common.GetRandomString(4), AccessToken: common.GetUUID()}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+}
@@ -37,6 +37,7 @@ func InitOptionMap() {
 	common.OptionMap["TurnstileCheckEnabled"] = strconv.FormatBool(common.TurnstileCheckEnabled)
 	common.OptionMap["RegisterEnabled"] = strconv.FormatBool(common.RegisterEnabled)
 	common.OptionMap["UserSelfDeletionEnabled"] = strconv.FormatBool(common.UserSelfDeletionEnabled)
+	common.OptionMap["AdminTwoFactorEnabled"] = strconv.FormatBool(common.AdminTwoFactorEnabled)
 	common.OptionMap["AutomaticDisableChannelEnabled"] = strconv.FormatBool(common.AutomaticDisableChannelEnabled)
 	common.OptionMap["AutomaticEnableChannelEnabled"] = strconv.FormatBool(common.AutomaticEnableChannelEnabled)
 	common.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(common.LogConsumeEnabled)
@@ -45,6 +46,7 @@ func InitOptionMap() {
 	common.OptionMap["DrawingEnabled"] = strconv.FormatBool(common.DrawingEnabled)
 	common.OptionMap["TaskEnabled"] = strconv.FormatBool(common.TaskEnabled)
 	common.OptionMap["DataExportEnabled"] = strconv.FormatBool(common.DataExportEnabled)
+	common.OptionMap["AnalyticsEnabled"] = strconv.FormatBool(common.AnalyticsEnabled)
 	common.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(common.ChannelDisableThreshold, 'f', -1, 64)
 	common.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(common.EmailDomainRestrictionEnabled)
 	common.OptionMap["EmailAliasRestrictionEnabled"] = strconv.FormatBool(common.EmailAliasRestrictionEnabled)
@@ -69,6 +71,7 @@ func InitOptionMap() {
 	common.OptionMap["PaymentEnabled"] = strconv.FormatBool(common.PaymentEnabled)
 	common.OptionMap["StripeUnitPrice"] = strconv.FormatFloat(common.StripeUnitPrice, 'f', -1, 64)
 	common.OptionMap["MinTopUp"] = strconv.Itoa(common.MinTopUp)
+	common.OptionMap["RefundDisableUserEnabled"] = strconv.FormatBool(common.RefundDisableUserEnabled)
 	common.OptionMap["TopupGroupRatio"] = common.TopupGroupRatio2JSONString()
 	common.OptionMap["GitHubClientId"] = ""
 	common.OptionMap["GitHubClientSecret"] = ""
@@ -90,6 +93,14 @@ func InitOptionMap() {
 	common.OptionMap["ModelRatio"] = common.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = common.ModelPrice2JSONString()
 	common.OptionMap["GroupRatio"] = common.GroupRatio2JSONString()
+	common.OptionMap["GroupModelRatio"] = common.GroupModelRatio2JSONString()
+	common.OptionMap["PermissionRoles"] = common.PermissionRoles2JSONString()
+	common.OptionMap["LogLevel"] = common.LogLevel
+	common.OptionMap["CaptureConfig"] = common.CaptureConfig2JSONString()
+	common.OptionMap["LogRetentionConfig"] = common.LogRetentionConfig2JSONString()
+	common.OptionMap["AlertConfig"] = common.AlertConfig2JSONString()
+	common.OptionMap["PricingWindows"] = common.PricingWindows2JSONString()
+	common.OptionMap["OIDCProviders"] = common.OIDCProviders2JSONString()
 	common.OptionMap["CompletionRatio"] = common.CompletionRatio2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	common.OptionMap["ChatLink"] = common.ChatLink
@@ -189,6 +200,8 @@ func updateOptionMap(key string, value string) (err error) {
 			common.RegisterEnabled = boolValue
 		case "UserSelfDeletionEnabled":
 			common.UserSelfDeletionEnabled = boolValue
+		case "AdminTwoFactorEnabled":
+			common.AdminTwoFactorEnabled = boolValue
 		case "EmailDomainRestrictionEnabled":
 			common.EmailDomainRestrictionEnabled = boolValue
 		case "EmailAliasRestrictionEnabled":
@@ -209,6 +222,8 @@ func updateOptionMap(key string, value string) (err error) {
 			common.TaskEnabled = boolValue
 		case "DataExportEnabled":
 			common.DataExportEnabled = boolValue
+		case "AnalyticsEnabled":
+			common.AnalyticsEnabled = boolValue
 		case "DefaultCollapseSidebar":
 			common.DefaultCollapseSidebar = boolValue
 		case "MjNotifyEnabled":
@@ -231,6 +246,8 @@ func updateOptionMap(key string, value string) (err error) {
 			constant.StopOnSensitiveEnabled = boolValue
 		case "SMTPSSLEnabled":
 			common.SMTPSSLEnabled = boolValue
+		case "RefundDisableUserEnabled":
+			common.RefundDisableUserEnabled = boolValue
 		}
 	}
 	switch key {
@@ -315,6 +332,22 @@ func updateOptionMap(key string, value string) (err error) {
 		err = common.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = common.UpdateGroupRatioByJSONString(value)
+	case "GroupModelRatio":
+		err = common.UpdateGroupModelRatioByJSONString(value)
+	case "PermissionRoles":
+		err = common.UpdatePermissionRolesByJSONString(value)
+	case "LogLevel":
+		err = common.SetLogLevel(value)
+	case "CaptureConfig":
+		err = common.UpdateCaptureConfigByJSONString(value)
+	case "LogRetentionConfig":
+		err = common.UpdateLogRetentionConfigByJSONString(value)
+	case "AlertConfig":
+		err = common.UpdateAlertConfigByJSONString(value)
+	case "PricingWindows":
+		err = common.UpdatePricingWindowsByJSONString(value)
+	case "OIDCProviders":
+		err = common.UpdateOIDCProvidersByJSONString(value)
 	case "CompletionRatio":
 		err = common.UpdateCompletionRatioByJSONString(value)
 	case "ModelPrice":
@@ -0,0 +1,372 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Organization 组织，成员可以使用组织令牌消耗组织额度池中的额度
+type Organization struct {
+	Id           int            `json:"id"`
+	Name         string         `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId      int            `json:"owner_id" gorm:"index"`
+	Status       int            `json:"status" gorm:"type:int;default:1"`
+	Quota        int            `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota    int            `json:"used_quota" gorm:"type:int;default:0"`
+	RequestCount int            `json:"request_count" gorm:"type:int;default:0"`
+	CreatedTime  int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// OrganizationMember 组织成员，QuotaLimit 为成员在组织内的消费上限，0 表示不限制
+type OrganizationMember struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"uniqueIndex:idx_org_member"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_org_member;index"`
+	Username    string `json:"username" gorm:"-:all"`
+	Role        int    `json:"role" gorm:"type:int;default:1"`
+	QuotaLimit  int    `json:"quota_limit" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// UserOrganization 用户所在的组织及其在组织中的角色
+type UserOrganization struct {
+	Organization
+	Role            int `json:"role"`
+	QuotaLimit      int `json:"quota_limit"`
+	MemberUsedQuota int `json:"member_used_quota"`
+}
+
+func GetAllOrganizations(startIdx int, num int, keyword string) (orgs []*Organization, total int64, err error) {
+	orgs = []*Organization{}
+	tx := DB.Model(&Organization{})
+	if keyword != "" {
+		tx = tx.Where("name LIKE ?", "%"+keyword+"%")
+	}
+	err = tx.Count(&total).Error
+	if err != nil || total == 0 {
+		return orgs, total, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	org := Organization{}
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetUserOrganizations(userId int) (orgs []*UserOrganization, err error) {
+	orgs = []*UserOrganization{}
+	err = DB.Table("organizations").
+		Select("organizations.*, organization_members.role as role, organization_members.quota_limit as quota_limit, organization_members.used_quota as member_used_quota").
+		Joins("join organization_members on organization_members.org_id = organizations.id").
+		Where("organization_members.user_id = ? and organizations.deleted_at is null", userId).
+		Order("organizations.id desc").Find(&orgs).Error
+	return orgs, err
+}
+
+// Insert 创建组织并将创建者设为所有者
+func (org *Organization) Insert() error {
+	org.CreatedTime = common.GetTimestamp()
+	org.Status = common.OrganizationStatusEnabled
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(org).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrgId:       org.Id,
+			UserId:      org.OwnerId,
+			Role:        common.OrganizationRoleOwner,
+			CreatedTime: org.CreatedTime,
+		}).Error
+	})
+}
+
+func (org *Organization) Update(updateQuota bool) error {
+	var err error
+	if updateQuota {
+		err = DB.Model(org).Select("name", "status", "quota").Updates(org).Error
+	} else {
+		err = DB.Model(org).Select("name", "status").Updates(org).Error
+	}
+	if err != nil {
+		return err
+	}
+	CacheDeleteOrganizationBillingQuota(org.Id)
+	return nil
+}
+
+// DeleteOrganizationById 删除组织，停用组织令牌并将剩余额度退还给所有者
+func DeleteOrganizationById(id int) error {
+	var org Organization
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&org, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		if org.Quota > 0 {
+			err = tx.Model(&User{}).Where("id = ?", org.OwnerId).Update("quota", gorm.Expr("quota + ?", org.Quota)).Error
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Model(&Token{}).Where("org_id = ?", id).Update("status", common.TokenStatusDisabled).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("org_id = ?", id).Delete(&OrganizationMember{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&org).Error
+	})
+	if err != nil {
+		return err
+	}
+	CacheDeleteOrganizationBillingQuota(id)
+	if org.Quota > 0 {
+		_ = CacheUpdateUserQuota(org.OwnerId)
+		RecordLog(org.OwnerId, LogTypeSystem, fmt.Sprintf("组织 %s 解散，退还剩余额度 %s", org.Name, common.LogQuota(org.Quota)))
+	}
+	return nil
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	member := OrganizationMember{}
+	err := DB.First(&member, "org_id = ? and user_id = ?", orgId, userId).Error
+	return &member, err
+}
+
+func GetOrganizationMembers(orgId int) (members []*OrganizationMember, err error) {
+	members = []*OrganizationMember{}
+	err = DB.Where("org_id = ?", orgId).Order("role desc, id asc").Find(&members).Error
+	if err != nil {
+		return members, err
+	}
+	for _, member := range members {
+		member.Username, _ = CacheGetUsername(member.UserId)
+	}
+	return members, nil
+}
+
+func (member *OrganizationMember) Insert() error {
+	member.CreatedTime = common.GetTimestamp()
+	if IsOrganizationMember(member.OrgId, member.UserId) {
+		return errors.New("该用户已是组织成员")
+	}
+	return DB.Create(member).Error
+}
+
+func (member *OrganizationMember) Update() error {
+	err := DB.Model(member).Select("role", "quota_limit").Updates(member).Error
+	if err != nil {
+		return err
+	}
+	CacheDeleteOrganizationBillingQuota(member.OrgId, member.UserId)
+	return nil
+}
+
+func IsOrganizationMember(orgId int, userId int) bool {
+	return DB.Where("org_id = ? and user_id = ?", orgId, userId).Find(&OrganizationMember{}).RowsAffected == 1
+}
+
+// RemoveOrganizationMember 移除成员并停用其签发的组织令牌
+func RemoveOrganizationMember(orgId int, userId int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("org_id = ? and user_id = ? and role < ?", orgId, userId, common.OrganizationRoleOwner).Delete(&OrganizationMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("成员不存在或无法移除组织所有者")
+		}
+		return tx.Model(&Token{}).Where("org_id = ? and user_id = ?", orgId, userId).Update("status", common.TokenStatusDisabled).Error
+	})
+	if err != nil {
+		return err
+	}
+	CacheDeleteOrganizationBillingQuota(orgId, userId)
+	return nil
+}
+
+// TransferUserQuotaToOrganization 将个人额度转入组织额度池
+func TransferUserQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 以余额充足为条件扣减，并发转入时不会把个人额度扣成负数
+		result := tx.Model(&User{}).Where("id = ? and quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("个人额度不足")
+		}
+		result = tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("组织不存在")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_ = CacheUpdateUserQuota(userId)
+	CacheDeleteOrganizationBillingQuota(orgId)
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("向组织 #%d 转入额度 %s", orgId, common.LogQuota(quota)))
+	return nil
+}
+
+// IncreaseOrganizationQuota 退还组织额度，同时减少成员的已用额度
+func IncreaseOrganizationQuota(orgId int, userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return changeOrganizationQuota(orgId, userId, -quota)
+}
+
+// DecreaseOrganizationQuota 扣减组织额度并累加成员的已用额度，用于结算实际消耗，不校验余额
+func DecreaseOrganizationQuota(orgId int, userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return changeOrganizationQuota(orgId, userId, quota)
+}
+
+func changeOrganizationQuota(orgId int, userId int, quota int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota - ?", quota)).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&OrganizationMember{}).Where("org_id = ? and user_id = ?", orgId, userId).
+			Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+	})
+}
+
+// PreConsumeOrganizationQuota 预扣组织额度。成员已用额度与组织额度池在同一事务中以条件更新修改，
+// 超出成员消费上限或额度池不足时不做任何修改，同一成员的并发请求不会超出上限
+func PreConsumeOrganizationQuota(orgId int, userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&OrganizationMember{}).
+			Where("org_id = ? and user_id = ? and (quota_limit = 0 or used_quota + ? <= quota_limit)", orgId, userId, quota).
+			Update("used_quota", gorm.Expr("used_quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("超出成员在组织内的消费上限")
+		}
+		result = tx.Model(&Organization{}).Where("id = ? and status = ? and quota >= ?", orgId, common.OrganizationStatusEnabled, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("组织额度不足")
+		}
+		return nil
+	})
+}
+
+// GetOrganizationBillingQuota 返回成员当前可用的组织额度，受组织额度池与成员消费上限共同约束
+func GetOrganizationBillingQuota(orgId int, userId int) (int, error) {
+	org, err := GetOrganizationById(orgId)
+	if err != nil {
+		return 0, errors.New("组织不存在")
+	}
+	if org.Status != common.OrganizationStatusEnabled {
+		return 0, errors.New("组织已被禁用")
+	}
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return 0, errors.New("用户不是该组织的成员")
+	}
+	quota := org.Quota
+	if member.QuotaLimit > 0 && member.QuotaLimit-member.UsedQuota < quota {
+		quota = member.QuotaLimit - member.UsedQuota
+	}
+	return quota, nil
+}
+
+// UpdateOrganizationUsedQuotaAndRequestCount 更新组织的消耗统计，成员已用额度在扣减额度时已经累加
+func UpdateOrganizationUsedQuotaAndRequestCount(orgId int, quota int) {
+	err := DB.Model(&Organization{}).Where("id = ?", orgId).Updates(
+		map[string]interface{}{
+			"used_quota":    gorm.Expr("used_quota + ?", quota),
+			"request_count": gorm.Expr("request_count + ?", 1),
+		},
+	).Error
+	if err != nil {
+		common.SysError("failed to update organization used quota and request count: " + err.Error())
+	}
+}
+
+// 以下函数根据令牌所属的组织选择计费对象：组织令牌使用组织额度池，个人令牌（orgId 为 0）使用用户额度
+
+func GetBillingQuota(userId int, orgId int) (int, error) {
+	if orgId != 0 {
+		return CacheGetOrganizationBillingQuota(orgId, userId)
+	}
+	return CacheGetUserQuota(userId)
+}
+
+func CacheDecreaseBillingQuota(userId int, orgId int, quota int) error {
+	if orgId != 0 {
+		return CacheDecreaseOrganizationBillingQuota(orgId, userId, quota)
+	}
+	return CacheDecreaseUserQuota(userId, quota)
+}
+
+func CacheUpdateBillingQuota(userId int, orgId int) error {
+	if orgId != 0 {
+		return CacheUpdateOrganizationBillingQuota(orgId, userId)
+	}
+	return CacheUpdateUserQuota(userId)
+}
+
+func UpdateBillingUsedQuotaAndRequestCount(userId int, orgId int, quota int) {
+	if orgId != 0 {
+		UpdateOrganizationUsedQuotaAndRequestCount(orgId, quota)
+		return
+	}
+	UpdateUserUsedQuotaAndRequestCount(userId, quota)
+}
+
+// IncreaseBillingQuota 退还额度，用于异步任务失败后的补偿
+func IncreaseBillingQuota(userId int, orgId int, quota int) error {
+	if orgId != 0 {
+		return IncreaseOrganizationQuota(orgId, userId, quota)
+	}
+	return IncreaseUserQuota(userId, quota)
+}
+
+func ValidateOrganizationName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	if len(name) > 64 {
+		return errors.New("组织名称过长")
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+)
+
+func createTestOrganization(t *testing.T, ownerId int, quota int) *Organization {
+	t.Helper()
+	org := &Organization{Name: "test-org", OwnerId: ownerId}
+	if err := org.Insert(); err != nil {
+		t.Fatalf("insert organization: %v", err)
+	}
+	if err := DB.Model(org).Update("quota", quota).Error; err != nil {
+		t.Fatalf("set organization quota: %v", err)
+	}
+	return org
+}
+
+func TestTransferUserQuotaToOrganization(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, 300)
+	if err := DB.Model(&User{}).Where("id = ?", 300).Update("quota", 1000).Error; err != nil {
+		t.Fatal(err)
+	}
+	org := createTestOrganization(t, 300, 0)
+
+	tests := []struct {
+		name          string
+		orgId         int
+		quota         int
+		wantErr       bool
+		wantUserQuota int
+		wantOrgQuota  int
+	}{
+		{"transfer part", org.Id, 400, false, 600, 400},
+		{"transfer the rest", org.Id, 600, false, 0, 1000},
+		{"insufficient quota", org.Id, 1, true, 0, 1000},
+		{"zero quota", org.Id, 0, true, 0, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := TransferUserQuotaToOrganization(300, tt.orgId, tt.quota)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TransferUserQuotaToOrganization error = %v, wantErr %v", err, tt.wantErr)
+			}
+			userQuota, _ := GetUserQuota(300)
+			got, _ := GetOrganizationById(org.Id)
+			if userQuota != tt.wantUserQuota || got.Quota != tt.wantOrgQuota {
+				t.Errorf("user quota = %d, org quota = %d, want %d, %d", userQuota, got.Quota, tt.wantUserQuota, tt.wantOrgQuota)
+			}
+		})
+	}
+
+	createTestUser(t, 301)
+	DB.Model(&User{}).Where("id = ?", 301).Update("quota", 100)
+	if err := TransferUserQuotaToOrganization(301, 9999, 50); err == nil {
+		t.Errorf("transfer to a missing organization should fail")
+	}
+	if quota, _ := GetUserQuota(301); quota != 100 {
+		t.Errorf("failed transfer should roll back, user quota = %d", quota)
+	}
+}
+
+func TestPreConsumeOrganizationQuota(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, 310)
+	createTestUser(t, 311)
+	org := createTestOrganization(t, 310, 1000)
+	member := &OrganizationMember{OrgId: org.Id, UserId: 311, Role: 1, QuotaLimit: 300}
+	if err := member.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		userId         int
+		quota          int
+		wantErr        bool
+		wantOrgQuota   int
+		wantMemberUsed int
+	}{
+		{"within member limit", 311, 200, false, 800, 200},
+		{"reach member limit", 311, 100, false, 700, 300},
+		{"exceed member limit", 311, 1, true, 700, 300},
+		{"owner without limit", 310, 600, false, 100, 300},
+		{"exceed organization pool", 310, 101, true, 100, 300},
+		{"not a member", 999, 1, true, 100, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PreConsumeOrganizationQuota(org.Id, tt.userId, tt.quota)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PreConsumeOrganizationQuota error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, _ := GetOrganizationById(org.Id)
+			limited, _ := GetOrganizationMember(org.Id, 311)
+			if got.Quota != tt.wantOrgQuota || limited.UsedQuota != tt.wantMemberUsed {
+				t.Errorf("org quota = %d, member used = %d, want %d, %d", got.Quota, limited.UsedQuota, tt.wantOrgQuota, tt.wantMemberUsed)
+			}
+		})
+	}
+
+	// 退还预扣的额度后成员可以继续消费
+	if err := IncreaseBillingQuota(311, org.Id, 100); err != nil {
+		t.Fatal(err)
+	}
+	if quota, err := GetOrganizationBillingQuota(org.Id, 311); err != nil || quota != 100 {
+		t.Errorf("GetOrganizationBillingQuota = %d, %v, want 100", quota, err)
+	}
+}
+
+func TestPreConsumeTokenQuotaWithOrganization(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, 320)
+	org := createTestOrganization(t, 320, 100)
+	token := &Token{UserId: 320, OrgId: org.Id, Key: common.GenerateKey(), Name: "org", Status: common.TokenStatusEnabled, ExpiredTime: -1, RemainQuota: 1000}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		quota           int
+		wantErr         bool
+		wantTokenRemain int
+		wantOrgQuota    int
+	}{
+		{"consume from pool", 60, false, 940, 40},
+		{"pool exhausted", 60, true, 940, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PreConsumeTokenQuota(token.Id, tt.quota)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PreConsumeTokenQuota error = %v, wantErr %v", err, tt.wantErr)
+			}
+			gotToken, _ := GetTokenById(token.Id)
+			gotOrg, _ := GetOrganizationById(org.Id)
+			if gotToken.RemainQuota != tt.wantTokenRemain || gotOrg.Quota != tt.wantOrgQuota {
+				t.Errorf("token remain = %d, org quota = %d, want %d, %d", gotToken.RemainQuota, gotOrg.Quota, tt.wantTokenRemain, tt.wantOrgQuota)
+			}
+		})
+	}
+}
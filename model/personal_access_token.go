@@ -0,0 +1,126 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"one-api/common"
+	"strings"
+)
+
+const (
+	PersonalAccessTokenStatusEnabled = 1
+	PersonalAccessTokenStatusRevoked = 2
+
+	// 个人访问令牌以固定前缀开头，便于与旧的 access token 以及 API 令牌区分
+	PersonalAccessTokenPrefix = "pat-"
+	// 最近使用时间的刷新间隔，避免每次请求都写库
+	personalAccessTokenTouchSeconds = 60
+)
+
+// PersonalAccessToken 用于管理接口的具名访问令牌
+// 数据库中只保存令牌的 SHA-256 摘要，明文只在创建时返回一次；KeyPrefix 用于在列表中辨认令牌。
+type PersonalAccessToken struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"type:varchar(64)"`
+	KeyHash      string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	KeyPrefix    string `json:"key_prefix" gorm:"type:varchar(16)"`
+	Scopes       string `json:"scopes" gorm:"type:varchar(255)"`  // 逗号分隔的权限项
+	AllowIps     string `json:"allow_ips" gorm:"type:text"`       // 逗号或换行分隔的 IP / CIDR，为空表示不限制
+	Status       int    `json:"status" gorm:"type:int;default:1"` // enabled, revoked
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	ExpiredTime  int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint;default:0"`
+	LastUsedIp   string `json:"last_used_ip" gorm:"type:varchar(64);default:''"`
+}
+
+func (token *PersonalAccessToken) GetScopes() []string {
+	return common.ParsePermissionRoleNames(token.Scopes)
+}
+
+func (token *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range token.GetScopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashPersonalAccessToken(key string) string {
+	return hex.EncodeToString(common.Sha256Raw(key))
+}
+
+// CreatePersonalAccessToken 生成令牌并返回明文，调用方需负责校验作用域与 IP 列表
+func CreatePersonalAccessToken(token *PersonalAccessToken) (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	key := PersonalAccessTokenPrefix + hex.EncodeToString(b)
+	token.KeyHash = hashPersonalAccessToken(key)
+	token.KeyPrefix = key[:len(PersonalAccessTokenPrefix)+6]
+	token.Status = PersonalAccessTokenStatusEnabled
+	token.CreatedTime = common.GetTimestamp()
+	err = DB.Create(token).Error
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func GetPersonalAccessTokensByUserId(userId int) (tokens []*PersonalAccessToken, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func RevokePersonalAccessToken(id int, userId int) error {
+	result := DB.Model(&PersonalAccessToken{}).Where("id = ? and user_id = ?", id, userId).
+		Update("status", PersonalAccessTokenStatusRevoked)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("令牌不存在")
+	}
+	return nil
+}
+
+// ValidatePersonalAccessToken 校验令牌状态、有效期与 IP 白名单，成功时返回令牌及其所属用户
+func ValidatePersonalAccessToken(key string, ip string) (*PersonalAccessToken, *User, error) {
+	key = strings.TrimSpace(strings.TrimPrefix(key, "Bearer "))
+	if !strings.HasPrefix(key, PersonalAccessTokenPrefix) {
+		return nil, nil, errors.New("无效的访问令牌")
+	}
+	token := &PersonalAccessToken{}
+	err := DB.Where("key_hash = ?", hashPersonalAccessToken(key)).First(token).Error
+	if err != nil {
+		return nil, nil, errors.New("无效的访问令牌")
+	}
+	if token.Status != PersonalAccessTokenStatusEnabled {
+		return nil, nil, errors.New("访问令牌已被撤销")
+	}
+	now := common.GetTimestamp()
+	if token.ExpiredTime != -1 && token.ExpiredTime < now {
+		return nil, nil, errors.New("访问令牌已过期")
+	}
+	if !common.IsIpAllowed(ip, token.AllowIps) {
+		return nil, nil, errors.New("当前 IP 不在访问令牌的白名单中")
+	}
+	user, err := GetUserById(token.UserId, false)
+	if err != nil {
+		return nil, nil, errors.New("访问令牌所属用户不存在")
+	}
+	if now-token.LastUsedTime >= personalAccessTokenTouchSeconds || token.LastUsedIp != ip {
+		err = DB.Model(token).Updates(map[string]interface{}{
+			"last_used_time": now,
+			"last_used_ip":   ip,
+		}).Error
+		if err != nil {
+			common.SysError("failed to update personal access token last used time: " + err.Error())
+		}
+	}
+	return token, user, nil
+}
@@ -14,6 +14,7 @@ type Pricing struct {
 	ModelPrice      float64  `json:"model_price"`
 	OwnerBy         string   `json:"owner_by"`
 	CompletionRatio float64  `json:"completion_ratio"`
+	GroupRatio      float64  `json:"group_ratio"` // 当前分组在该模型上的实际倍率
 	EnableGroup     []string `json:"enable_group,omitempty"`
 }
 
@@ -30,18 +31,21 @@ func GetPricing(group string) []Pricing {
 	if time.Since(lastGetPricingTime) > time.Minute*1 || len(pricingMap) == 0 {
 		updatePricing()
 	}
+	var models []string
+	ratioGroup := "default"
 	if group != "" {
-		userPricingMap := make([]Pricing, 0)
-		models := GetGroupModels(group)
-		for _, pricing := range pricingMap {
-			if !common.StringsContains(models, pricing.ModelName) {
-				pricing.Available = false
-			}
-			userPricingMap = append(userPricingMap, pricing)
+		models = GetGroupModels(group)
+		ratioGroup = group
+	}
+	userPricingMap := make([]Pricing, 0, len(pricingMap))
+	for _, pricing := range pricingMap {
+		if group != "" && !common.StringsContains(models, pricing.ModelName) {
+			pricing.Available = false
 		}
-		return userPricingMap
+		pricing.GroupRatio = common.GetGroupModelRatio(ratioGroup, pricing.ModelName)
+		userPricingMap = append(userPricingMap, pricing)
 	}
-	return pricingMap
+	return userPricingMap
 }
 
 func updatePricing() {
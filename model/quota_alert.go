@@ -0,0 +1,99 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+)
+
+const (
+	QuotaAlertTypeBalance     = "balance"      // 用户余额低于阈值，阈值单位为额度
+	QuotaAlertTypeTokenBudget = "token_budget" // 令牌已用额度达到预算的百分比，阈值为 0-100
+)
+
+const (
+	QuotaAlertChannelEmail    = "email"
+	QuotaAlertChannelWebhook  = "webhook"
+	QuotaAlertChannelTelegram = "telegram"
+)
+
+// QuotaAlert 用户自定义的额度提醒
+// Triggered 在越过阈值并发送通知后置为 true，额度恢复到阈值之上后重新置为 false，
+// 保证每次越过阈值只通知一次。
+type QuotaAlert struct {
+	Id                int     `json:"id"`
+	UserId            int     `json:"user_id" gorm:"index"`
+	Type              string  `json:"type" gorm:"type:varchar(32)"`
+	TokenId           int     `json:"token_id" gorm:"default:0"` // 仅 token_budget 使用
+	Threshold         float64 `json:"threshold"`
+	Channel           string  `json:"channel" gorm:"type:varchar(32)"`
+	WebhookUrl        string  `json:"webhook_url"`
+	WebhookSecret     string  `json:"webhook_secret,omitempty"`
+	HasWebhookSecret  bool    `json:"has_webhook_secret" gorm:"-"`
+	Enabled           bool    `json:"enabled"`
+	Triggered         bool    `json:"triggered" gorm:"default:false"`
+	LastTriggeredTime int64   `json:"last_triggered_time" gorm:"bigint;default:0"`
+	CreatedTime       int64   `json:"created_time" gorm:"bigint"`
+}
+
+// HideWebhookSecret 返回给前端前清除 Webhook 密钥，只保留是否已设置
+func (alert *QuotaAlert) HideWebhookSecret() {
+	alert.HasWebhookSecret = alert.WebhookSecret != ""
+	alert.WebhookSecret = ""
+}
+
+func GetUserQuotaAlerts(userId int) (alerts []*QuotaAlert, err error) {
+	alerts = []*QuotaAlert{}
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&alerts).Error
+	return alerts, err
+}
+
+func GetEnabledUserQuotaAlerts(userId int) (alerts []*QuotaAlert, err error) {
+	err = DB.Where("user_id = ? and enabled = ?", userId, true).Find(&alerts).Error
+	return alerts, err
+}
+
+func GetQuotaAlertByIds(id int, userId int) (*QuotaAlert, error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	alert := QuotaAlert{}
+	err := DB.First(&alert, "id = ? and user_id = ?", id, userId).Error
+	return &alert, err
+}
+
+func (alert *QuotaAlert) Insert() error {
+	return DB.Create(alert).Error
+}
+
+func (alert *QuotaAlert) Update() error {
+	return DB.Model(alert).Select("type", "token_id", "threshold", "channel", "webhook_url", "webhook_secret", "enabled", "triggered").Updates(alert).Error
+}
+
+func DeleteQuotaAlertById(id int, userId int) error {
+	alert, err := GetQuotaAlertByIds(id, userId)
+	if err != nil {
+		return err
+	}
+	return DB.Delete(alert).Error
+}
+
+// ClaimQuotaAlert 标记提醒已触发，返回 false 表示已被其他请求或节点抢先触发
+func ClaimQuotaAlert(id int) bool {
+	result := DB.Model(&QuotaAlert{}).Where("id = ? and triggered = ?", id, false).Updates(map[string]interface{}{
+		"triggered":           true,
+		"last_triggered_time": common.GetTimestamp(),
+	})
+	if result.Error != nil {
+		common.SysError("failed to claim quota alert: " + result.Error.Error())
+		return false
+	}
+	return result.RowsAffected == 1
+}
+
+// RearmQuotaAlert 额度恢复到阈值之上后重新启用提醒
+func RearmQuotaAlert(id int) {
+	err := DB.Model(&QuotaAlert{}).Where("id = ? and triggered = ?", id, true).Update("triggered", false).Error
+	if err != nil {
+		common.SysError("failed to rearm quota alert: " + err.Error())
+	}
+}
@@ -4,21 +4,43 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"one-api/common"
+	"time"
 )
 
 type Redemption struct {
-	Id           int            `json:"id"`
-	UserId       int            `json:"user_id"`
-	Key          string         `json:"key" gorm:"type:char(32);uniqueIndex"`
-	Status       int            `json:"status" gorm:"default:1"`
-	Name         string         `json:"name" gorm:"index"`
-	Quota        int            `json:"quota" gorm:"default:100"`
-	CreatedTime  int64          `json:"created_time" gorm:"bigint"`
-	RedeemedTime int64          `json:"redeemed_time" gorm:"bigint"`
-	Count        int            `json:"count" gorm:"-:all"` // only for api request
-	UsedUserId   int            `json:"used_user_id"`
-	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	Id               int            `json:"id"`
+	UserId           int            `json:"user_id"`
+	CampaignId       int            `json:"campaign_id" gorm:"index;default:0"`
+	Key              string         `json:"key" gorm:"type:char(32);uniqueIndex"`
+	Status           int            `json:"status" gorm:"default:1"`
+	Name             string         `json:"name" gorm:"index"`
+	Quota            int            `json:"quota" gorm:"default:100"`
+	CreatedTime      int64          `json:"created_time" gorm:"bigint"`
+	RedeemedTime     int64          `json:"redeemed_time" gorm:"bigint"`
+	ExpiredTime      int64          `json:"expired_time" gorm:"bigint;default:0"` // 0 means never expired
+	MaxUses          int            `json:"max_uses" gorm:"default:1"`            // -1 means unlimited
+	UsedCount        int            `json:"used_count" gorm:"default:0"`
+	Group            string         `json:"group" gorm:"type:varchar(64);default:''"` // 兑换后升级到的分组
+	GroupDuration    int64          `json:"group_duration" gorm:"bigint;default:0"`   // 分组升级时长，单位秒，0 表示永久
+	TokenEnabled     bool           `json:"token_enabled" gorm:"default:false"`       // 兑换后是否发放令牌
+	TokenQuota       int            `json:"token_quota" gorm:"default:0"`             // 发放令牌的额度，0 表示无限额度
+	TokenModelLimits string         `json:"token_model_limits" gorm:"type:varchar(1024);default:''"`
+	Count            int            `json:"count" gorm:"-:all"` // only for api request
+	UsedUserId       int            `json:"used_user_id"`
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+}
+
+// RedemptionUsage 记录每一次兑换，用于限制每个用户只能使用同一兑换码一次以及活动统计
+type RedemptionUsage struct {
+	Id           int   `json:"id"`
+	RedemptionId int   `json:"redemption_id" gorm:"uniqueIndex:idx_redemption_user,priority:1"`
+	CampaignId   int   `json:"campaign_id" gorm:"index;default:0"`
+	UserId       int   `json:"user_id" gorm:"uniqueIndex:idx_redemption_user,priority:2"`
+	Quota        int   `json:"quota" gorm:"default:0"`
+	TokenId      int   `json:"token_id" gorm:"default:0"`
+	CreatedTime  int64 `json:"created_time" gorm:"bigint"`
 }
 
 func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
@@ -52,14 +74,15 @@ func GetRedemptionById(id int) (*Redemption, error) {
 	return &redemption, err
 }
 
-func Redeem(key string, userId int) (quota int, err error) {
+func Redeem(key string, userId int) (quota int, tokenKey string, err error) {
 	if key == "" {
-		return 0, errors.New("未提供兑换码")
+		return 0, "", errors.New("未提供兑换码")
 	}
 	if userId == 0 {
-		return 0, errors.New("无效的 user id")
+		return 0, "", errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
+	usage := &RedemptionUsage{}
 
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
@@ -67,28 +90,105 @@ func Redeem(key string, userId int) (quota int, err error) {
 	}
 	common.RandomSleep()
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
 		}
 		if redemption.Status != common.RedemptionCodeStatusEnabled {
 			return errors.New("该兑换码已被使用")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		now := common.GetTimestamp()
+		if redemption.ExpiredTime != 0 && redemption.ExpiredTime < now {
+			return errors.New("该兑换码已过期")
+		}
+		var used int64
+		err = tx.Model(&RedemptionUsage{}).Where("redemption_id = ? and user_id = ?", redemption.Id, userId).Count(&used).Error
 		if err != nil {
 			return err
 		}
-		redemption.RedeemedTime = common.GetTimestamp()
-		redemption.Status = common.RedemptionCodeStatusUsed
-		redemption.UsedUserId = userId
-		err = tx.Save(redemption).Error
-		return err
+		if used > 0 {
+			return errors.New("您已使用过该兑换码")
+		}
+		// 以条件更新占用一次使用次数，SQLite 等不支持行锁时也不会超出可使用次数
+		result := tx.Model(&Redemption{}).
+			Where("id = ? and status = ? and (max_uses = -1 or used_count < max_uses)", redemption.Id, common.RedemptionCodeStatusEnabled).
+			Updates(map[string]interface{}{
+				"used_count":    gorm.Expr("used_count + 1"),
+				"redeemed_time": now,
+				"used_user_id":  userId,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该兑换码已被使用")
+		}
+		err = tx.Model(&Redemption{}).Where("id = ? and max_uses <> -1 and used_count >= max_uses", redemption.Id).
+			Update("status", common.RedemptionCodeStatusUsed).Error
+		if err != nil {
+			return err
+		}
+		if redemption.Quota > 0 {
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+			if err != nil {
+				return err
+			}
+		}
+		if redemption.Group != "" {
+			err = grantUserGroup(tx, userId, redemption.Group, redemption.GroupDuration)
+			if err != nil {
+				return err
+			}
+		}
+		if redemption.TokenEnabled {
+			token := &Token{
+				UserId:             userId,
+				Name:               redemption.Name,
+				Key:                common.GenerateKey(),
+				CreatedTime:        now,
+				AccessedTime:       now,
+				ExpiredTime:        -1,
+				RemainQuota:        redemption.TokenQuota,
+				UnlimitedQuota:     redemption.TokenQuota == 0,
+				ModelLimitsEnabled: redemption.TokenModelLimits != "",
+				ModelLimits:        redemption.TokenModelLimits,
+			}
+			err = token.setKeyHash()
+			if err != nil {
+				return err
+			}
+			err = tx.Create(token).Error
+			if err != nil {
+				return err
+			}
+			usage.TokenId = token.Id
+			tokenKey = token.Key
+		}
+		usage.RedemptionId = redemption.Id
+		usage.CampaignId = redemption.CampaignId
+		usage.UserId = userId
+		usage.Quota = redemption.Quota
+		usage.CreatedTime = now
+		return tx.Create(usage).Error
 	})
 	if err != nil {
-		return 0, errors.New("兑换失败，" + err.Error())
+		return 0, "", errors.New("兑换失败，" + err.Error())
+	}
+	if redemption.Group != "" && common.RedisEnabled {
+		_ = common.RedisSet(fmt.Sprintf("user_group:%d", userId), redemption.Group, time.Duration(UserId2GroupCacheSeconds)*time.Second)
+	}
+	content := fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", common.LogQuota(redemption.Quota), redemption.Id)
+	if redemption.Group != "" {
+		content += fmt.Sprintf("，分组升级为 %s", redemption.Group)
+		if redemption.GroupDuration > 0 {
+			content += fmt.Sprintf("（%s）", common.Seconds2Time(int(redemption.GroupDuration)))
+		}
+	}
+	if usage.TokenId != 0 {
+		content += fmt.Sprintf("，发放令牌ID %d", usage.TokenId)
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", common.LogQuota(redemption.Quota), redemption.Id))
-	return redemption.Quota, nil
+	RecordLog(userId, LogTypeTopup, content)
+	return redemption.Quota, tokenKey, nil
 }
 
 func (redemption *Redemption) Insert() error {
@@ -105,7 +205,8 @@ func (redemption *Redemption) SelectUpdate() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
 	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time").Updates(redemption).Error
+	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "expired_time", "max_uses",
+		"group", "group_duration", "token_enabled", "token_quota", "token_model_limits").Updates(redemption).Error
 	return err
 }
 
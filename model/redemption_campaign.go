@@ -0,0 +1,129 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"one-api/common"
+)
+
+// RedemptionCampaign 兑换码活动，创建活动时按活动配置批量生成兑换码
+type RedemptionCampaign struct {
+	Id               int            `json:"id"`
+	UserId           int            `json:"user_id"`
+	Name             string         `json:"name" gorm:"index"`
+	Description      string         `json:"description"`
+	CreatedTime      int64          `json:"created_time" gorm:"bigint"`
+	ExpiredTime      int64          `json:"expired_time" gorm:"bigint;default:0"` // 0 means never expired
+	CodeCount        int            `json:"code_count" gorm:"default:0"`
+	MaxUses          int            `json:"max_uses" gorm:"default:1"` // -1 means unlimited
+	Quota            int            `json:"quota" gorm:"default:0"`
+	Group            string         `json:"group" gorm:"type:varchar(64);default:''"`
+	GroupDuration    int64          `json:"group_duration" gorm:"bigint;default:0"`
+	TokenEnabled     bool           `json:"token_enabled" gorm:"default:false"`
+	TokenQuota       int            `json:"token_quota" gorm:"default:0"`
+	TokenModelLimits string         `json:"token_model_limits" gorm:"type:varchar(1024);default:''"`
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+}
+
+type RedemptionCampaignStat struct {
+	CampaignId  int   `json:"campaign_id"`
+	CodeCount   int64 `json:"code_count"`
+	UsedCodes   int64 `json:"used_codes"`
+	Redemptions int64 `json:"redemptions"`
+	Users       int64 `json:"users"`
+	Quota       int64 `json:"quota"`
+	Tokens      int64 `json:"tokens"`
+}
+
+func GetAllRedemptionCampaigns(startIdx int, num int) (campaigns []*RedemptionCampaign, total int64, err error) {
+	campaigns = []*RedemptionCampaign{}
+	err = DB.Model(&RedemptionCampaign{}).Count(&total).Error
+	if err != nil || total == 0 {
+		return campaigns, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&campaigns).Error
+	return campaigns, total, err
+}
+
+func GetRedemptionCampaignById(id int) (*RedemptionCampaign, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	campaign := RedemptionCampaign{Id: id}
+	err := DB.First(&campaign, "id = ?", id).Error
+	return &campaign, err
+}
+
+func GetRedemptionsByCampaignId(campaignId int) (redemptions []*Redemption, err error) {
+	err = DB.Where("campaign_id = ?", campaignId).Order("id asc").Find(&redemptions).Error
+	return redemptions, err
+}
+
+// Insert 创建活动并生成 CodeCount 个兑换码，返回生成的兑换码
+func (campaign *RedemptionCampaign) Insert() (keys []string, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(campaign).Error
+		if err != nil {
+			return err
+		}
+		redemptions := make([]*Redemption, 0, campaign.CodeCount)
+		for i := 0; i < campaign.CodeCount; i++ {
+			key := common.GetUUID()
+			redemptions = append(redemptions, &Redemption{
+				UserId:           campaign.UserId,
+				CampaignId:       campaign.Id,
+				Key:              key,
+				Name:             campaign.Name,
+				Quota:            campaign.Quota,
+				CreatedTime:      campaign.CreatedTime,
+				ExpiredTime:      campaign.ExpiredTime,
+				MaxUses:          campaign.MaxUses,
+				Group:            campaign.Group,
+				GroupDuration:    campaign.GroupDuration,
+				TokenEnabled:     campaign.TokenEnabled,
+				TokenQuota:       campaign.TokenQuota,
+				TokenModelLimits: campaign.TokenModelLimits,
+			})
+			keys = append(keys, key)
+		}
+		return tx.CreateInBatches(redemptions, 100).Error
+	})
+	return keys, err
+}
+
+// Delete 删除活动并禁用其下所有未用完的兑换码
+func (campaign *RedemptionCampaign) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Redemption{}).Where("campaign_id = ? and status = ?", campaign.Id, common.RedemptionCodeStatusEnabled).
+			Update("status", common.RedemptionCodeStatusDisabled).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(campaign).Error
+	})
+}
+
+func DeleteRedemptionCampaignById(id int) (err error) {
+	campaign, err := GetRedemptionCampaignById(id)
+	if err != nil {
+		return err
+	}
+	return campaign.Delete()
+}
+
+func GetRedemptionCampaignStat(campaignId int) (stat RedemptionCampaignStat, err error) {
+	stat.CampaignId = campaignId
+	err = DB.Model(&Redemption{}).Where("campaign_id = ?", campaignId).Count(&stat.CodeCount).Error
+	if err != nil {
+		return stat, err
+	}
+	err = DB.Model(&Redemption{}).Where("campaign_id = ? and used_count > 0", campaignId).Count(&stat.UsedCodes).Error
+	if err != nil {
+		return stat, err
+	}
+	err = DB.Model(&RedemptionUsage{}).Where("campaign_id = ?", campaignId).
+		Select("count(*) as redemptions, count(distinct user_id) as users, coalesce(sum(quota),0) as quota, " +
+			"coalesce(sum(case when token_id > 0 then 1 else 0 end),0) as tokens").
+		Scan(&stat).Error
+	return stat, err
+}
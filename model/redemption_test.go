@@ -0,0 +1,78 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+)
+
+func TestRedeemRespectsMaxUses(t *testing.T) {
+	setupTestDB(t)
+
+	tests := []struct {
+		name       string
+		maxUses    int
+		redeemers  int
+		wantUsed   int
+		wantStatus int
+	}{
+		{"single use", 1, 2, 1, common.RedemptionCodeStatusUsed},
+		{"limited uses", 2, 3, 2, common.RedemptionCodeStatusUsed},
+		{"unlimited uses", -1, 3, 3, common.RedemptionCodeStatusEnabled},
+	}
+	userId := 100
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redemption := &Redemption{
+				Name:    tt.name,
+				Key:     common.GetUUID(),
+				Status:  common.RedemptionCodeStatusEnabled,
+				Quota:   10,
+				MaxUses: tt.maxUses,
+			}
+			if err := redemption.Insert(); err != nil {
+				t.Fatalf("insert redemption: %v", err)
+			}
+			used := 0
+			for i := 0; i < tt.redeemers; i++ {
+				userId++
+				createTestUser(t, userId)
+				if _, _, err := Redeem(redemption.Key, userId); err == nil {
+					used++
+				}
+			}
+			if used != tt.wantUsed {
+				t.Errorf("successful redemptions = %d, want %d", used, tt.wantUsed)
+			}
+			got, err := GetRedemptionById(redemption.Id)
+			if err != nil {
+				t.Fatalf("get redemption: %v", err)
+			}
+			if got.UsedCount != tt.wantUsed || got.Status != tt.wantStatus {
+				t.Errorf("used_count = %d, status = %d, want %d, %d", got.UsedCount, got.Status, tt.wantUsed, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRedeemRejectsSameUserTwice(t *testing.T) {
+	setupTestDB(t)
+
+	createTestUser(t, 100)
+	redemption := &Redemption{Name: "twice", Key: common.GetUUID(), Status: common.RedemptionCodeStatusEnabled, Quota: 10, MaxUses: -1}
+	if err := redemption.Insert(); err != nil {
+		t.Fatalf("insert redemption: %v", err)
+	}
+	if _, _, err := Redeem(redemption.Key, 100); err != nil {
+		t.Fatalf("first redeem: %v", err)
+	}
+	if _, _, err := Redeem(redemption.Key, 100); err == nil {
+		t.Fatal("second redeem by the same user should fail")
+	}
+	quota, err := GetUserQuota(100)
+	if err != nil {
+		t.Fatalf("get user quota: %v", err)
+	}
+	if quota != 10 {
+		t.Errorf("user quota = %d, want 10", quota)
+	}
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+	"strconv"
+)
+
+// RequestAttempt 请求的一次转发尝试
+type RequestAttempt struct {
+	Attempt     int    `json:"attempt"` // 从 0 开始，大于 0 的为重试
+	ChannelId   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	CreatedAt   int64  `json:"created_at"`
+	Success     bool   `json:"success"`
+	StatusCode  int    `json:"status_code"`
+	ErrorType   string `json:"error_type,omitempty"`
+	ErrorCode   string `json:"error_code,omitempty"`
+	Message     string `json:"message,omitempty"`
+	LocalError  bool   `json:"local_error"` // 未发往上游的错误，如额度不足
+	UseTimeMs   int64  `json:"use_time_ms"` // 失败尝试为本次尝试的耗时，成功尝试为从请求开始到结束的耗时
+}
+
+// RequestTimeline 按请求 ID 汇总的请求经过，用于排查用户反馈的问题
+type RequestTimeline struct {
+	RequestId  string            `json:"request_id"`
+	UserId     int               `json:"user_id"`
+	Username   string            `json:"username"`
+	TokenName  string            `json:"token_name"`
+	ModelName  string            `json:"model_name"`
+	UseChannel []string          `json:"use_channel"`
+	Attempts   []*RequestAttempt `json:"attempts"`
+	Billing    *Log              `json:"billing"` // 最终的消费日志，请求失败时为空
+	CaptureId  int               `json:"capture_id"`
+	Logs       []*Log            `json:"logs"`
+}
+
+func GetRequestTimeline(requestId string) (*RequestTimeline, error) {
+	logs, err := GetLogsByRequestId(requestId)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, errors.New("未找到该请求的日志")
+	}
+	timeline := &RequestTimeline{
+		RequestId:  requestId,
+		UseChannel: []string{},
+		Attempts:   []*RequestAttempt{},
+		Logs:       logs,
+	}
+	channelIds := make([]int, 0, len(logs))
+	for _, log := range logs {
+		if timeline.UserId == 0 {
+			timeline.UserId = log.UserId
+			timeline.Username = log.Username
+			timeline.TokenName = log.TokenName
+			timeline.ModelName = log.ModelName
+		}
+		other := common.StrToMap(log.Other)
+		// use_channel 在每次尝试时追加，以最后一条日志中的为准
+		if adminInfo, ok := other["admin_info"].(map[string]interface{}); ok {
+			if useChannel, ok := adminInfo["use_channel"].([]interface{}); ok {
+				timeline.UseChannel = timeline.UseChannel[:0]
+				for _, id := range useChannel {
+					if s, ok := id.(string); ok {
+						timeline.UseChannel = append(timeline.UseChannel, s)
+					}
+				}
+			}
+		}
+		switch log.Type {
+		case LogTypeError:
+			attempt := &RequestAttempt{
+				Attempt:    getOtherInt(other, "attempt"),
+				ChannelId:  log.ChannelId,
+				CreatedAt:  log.CreatedAt,
+				StatusCode: getOtherInt(other, "status_code"),
+				Message:    getLogErrorMessage(log, other),
+				UseTimeMs:  int64(getOtherInt(other, "use_time_ms")),
+			}
+			attempt.ErrorType, _ = other["error_type"].(string)
+			attempt.ErrorCode, _ = other["error_code"].(string)
+			attempt.LocalError, _ = other["local_error"].(bool)
+			timeline.Attempts = append(timeline.Attempts, attempt)
+		case LogTypeConsume:
+			timeline.Billing = log
+			timeline.Attempts = append(timeline.Attempts, &RequestAttempt{
+				ChannelId:  log.ChannelId,
+				CreatedAt:  log.CreatedAt,
+				Success:    true,
+				StatusCode: 200,
+				UseTimeMs:  int64(log.UseTime) * 1000,
+			})
+		default:
+			continue
+		}
+		channelIds = append(channelIds, log.ChannelId)
+	}
+	// 成功的尝试为 use_channel 中的最后一个渠道
+	if timeline.Billing != nil && len(timeline.UseChannel) > 0 {
+		timeline.Attempts[len(timeline.Attempts)-1].Attempt = len(timeline.UseChannel) - 1
+	}
+
+	var channels []*Channel
+	if len(channelIds) > 0 {
+		err = DB.Select("id", "name").Where("id in ?", channelIds).Find(&channels).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	channelNames := make(map[int]string, len(channels))
+	for _, channel := range channels {
+		channelNames[channel.Id] = channel.Name
+	}
+	for _, attempt := range timeline.Attempts {
+		attempt.ChannelName = channelNames[attempt.ChannelId]
+	}
+
+	var captureIds []int
+	LOG_DB.Model(&Capture{}).Where("request_id = ?", requestId).Limit(1).Pluck("id", &captureIds)
+	if len(captureIds) > 0 {
+		timeline.CaptureId = captureIds[0]
+	}
+	return timeline, nil
+}
+
+// JSON 解析后数字为 float64，数字字符串也一并兼容
+func getOtherInt(other map[string]interface{}, key string) int {
+	switch v := other[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+	return 0
+}
+
+// 错误日志的 Content 只保存通用描述，上游返回的原始错误信息保存在 admin_info 中
+func getLogErrorMessage(log *Log, other map[string]interface{}) string {
+	if adminInfo, ok := other["admin_info"].(map[string]interface{}); ok {
+		if message, ok := adminInfo["error_message"].(string); ok && message != "" {
+			return message
+		}
+	}
+	return log.Content
+}
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
@@ -9,10 +12,16 @@ import (
 	"strings"
 )
 
+// 令牌明文的前若干位单独保存，用于缩小哈希比对范围以及在列表中辨认令牌
+const tokenKeyPrefixLength = 8
+
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key                string         `json:"key,omitempty" gorm:"-"`                   // 明文只在创建时返回一次，不保存到数据库
+	KeyPrefix          string         `json:"key_prefix" gorm:"type:varchar(16);index"` // 用于查找与展示
+	KeySalt            string         `json:"-" gorm:"type:varchar(32)"`
+	KeyHash            string         `json:"-" gorm:"type:char(64)"`
 	Status             int            `json:"status" gorm:"default:1"`
 	Name               string         `json:"name" gorm:"index" `
 	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
@@ -22,7 +31,11 @@ type Token struct {
 	UnlimitedQuota     bool           `json:"unlimited_quota" gorm:"default:false"`
 	ModelLimitsEnabled bool           `json:"model_limits_enabled" gorm:"default:false"`
 	ModelLimits        string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
-	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
+	UsedQuota          int            `json:"used_quota" gorm:"default:0"`   // used quota
+	OrgId              int            `json:"org_id" gorm:"default:0;index"` // 不为 0 时消耗组织额度池
+	AllowIps           string         `json:"allow_ips" gorm:"type:text"`    // 逗号或换行分隔的 IP / CIDR，为空表示不限制
+	IpViolationCount   int            `json:"ip_violation_count" gorm:"default:0"`
+	EndpointScopes     string         `json:"endpoint_scopes" gorm:"type:varchar(255);default:''"` // 逗号分隔的接口范围，为空表示不限制
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -40,9 +53,16 @@ func GetAllUserTokens(userId int, startIdx int, num int) (tokens []*Token, total
 func SearchUserTokens(userId int, keyword string, token string) (tokens []*Token, total int64, err error) {
 	tokens = []*Token{}
 	if token != "" {
-		token = strings.Trim(token, "sk-")
+		token = strings.TrimPrefix(token, "sk-")
+	}
+	baseQuery := DB.Where("user_id = ?", userId).Where("name LIKE ?", "%"+keyword+"%")
+	if token != "" {
+		// 令牌只保存了前缀，按前缀匹配
+		if len(token) > tokenKeyPrefixLength {
+			token = token[:tokenKeyPrefixLength]
+		}
+		baseQuery = baseQuery.Where("key_prefix LIKE ?", token+"%")
 	}
-	baseQuery := DB.Where("user_id = ?", userId).Where("name LIKE ?", "%"+keyword+"%").Where("`key` LIKE ?", "%"+token+"%")
 	err = baseQuery.Model(&Token{}).Count(&total).Error
 	if err != nil || total == 0 {
 		return tokens, 0, err
@@ -112,37 +132,123 @@ func GetTokenById(id int) (*Token, error) {
 	token := Token{Id: id}
 	var err error = nil
 	err = DB.First(&token, "id = ?", id).Error
+	return &token, err
+}
+
+// GetTokenByKey 按前缀找出候选令牌，再比对加盐哈希
+func GetTokenByKey(key string) (*Token, error) {
+	if len(key) < tokenKeyPrefixLength {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var tokens []*Token
+	err := DB.Where("key_prefix = ?", key[:tokenKeyPrefixLength]).Find(&tokens).Error
 	if err != nil {
-		if common.RedisEnabled {
-			go cacheSetToken(&token)
+		return nil, err
+	}
+	for _, token := range tokens {
+		if token.KeyHash != "" && subtle.ConstantTimeCompare([]byte(hashTokenKey(token.KeySalt, key)), []byte(token.KeyHash)) == 1 {
+			return token, nil
 		}
 	}
-	return &token, err
+	return nil, gorm.ErrRecordNotFound
 }
 
-func GetTokenByKey(key string) (*Token, error) {
+func hashTokenKey(salt string, key string) string {
+	return hex.EncodeToString(common.Sha256Raw(salt + key))
+}
+
+// setKeyHash 为明文 Key 生成前缀、盐与哈希，必须在写入数据库前调用
+func (token *Token) setKeyHash() error {
+	if len(token.Key) < tokenKeyPrefixLength {
+		return errors.New("无效的令牌")
+	}
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return err
+	}
+	token.KeyPrefix = token.Key[:tokenKeyPrefixLength]
+	token.KeySalt = hex.EncodeToString(salt)
+	token.KeyHash = hashTokenKey(token.KeySalt, token.Key)
+	return nil
+}
+
+// migrateTokenKeys 将旧版本明文保存在 key 列中的令牌转换为前缀 + 加盐哈希，并清空明文
+func migrateTokenKeys() error {
+	columnTypes, err := DB.Migrator().ColumnTypes(&Token{})
+	if err != nil {
+		return err
+	}
+	hasKeyColumn := false
+	for _, columnType := range columnTypes {
+		if columnType.Name() == "key" {
+			hasKeyColumn = true
+		}
+	}
+	if !hasKeyColumn {
+		return nil
+	}
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
-	var token Token
-	err := DB.Where(keyCol+" = ?", key).First(&token).Error
-	return &token, err
+	migrated := 0
+	for {
+		var legacyTokens []struct {
+			Id  int
+			Key string
+		}
+		err = DB.Table("tokens").Select("id", "key").Where(keyCol + " IS NOT NULL AND " + keyCol + " <> ''").Limit(1000).Find(&legacyTokens).Error
+		if err != nil {
+			return err
+		}
+		if len(legacyTokens) == 0 {
+			break
+		}
+		for _, legacyToken := range legacyTokens {
+			token := Token{Key: legacyToken.Key}
+			err = token.setKeyHash()
+			if err != nil {
+				return err
+			}
+			err = DB.Table("tokens").Where("id = ?", legacyToken.Id).Updates(map[string]interface{}{
+				"key_prefix": token.KeyPrefix,
+				"key_salt":   token.KeySalt,
+				"key_hash":   token.KeyHash,
+				"key":        nil,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		migrated += len(legacyTokens)
+	}
+	if migrated > 0 {
+		common.SysLog(fmt.Sprintf("migrated %d plain text token keys to hashes", migrated))
+	}
+	return nil
 }
 
 func (token *Token) Insert() error {
-	var err error
-	err = DB.Create(token).Error
-	return err
+	err := token.setKeyHash()
+	if err != nil {
+		return err
+	}
+	return DB.Create(token).Error
 }
 
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() error {
 	var err error
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "model_limits_enabled", "model_limits").Updates(token).Error
+	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "model_limits_enabled", "model_limits", "allow_ips", "endpoint_scopes").Updates(token).Error
 	return err
 }
 
+// IncreaseTokenIpViolationCount 累计令牌被白名单以外的 IP 使用的次数
+func IncreaseTokenIpViolationCount(id int) error {
+	return DB.Model(&Token{}).Where("id = ?", id).Update("ip_violation_count", gorm.Expr("ip_violation_count + ?", 1)).Error
+}
+
 func (token *Token) SelectUpdate() error {
 	// This can update zero values
 	return DB.Model(token).Select("accessed_time", "status").Updates(token).Error
@@ -241,6 +347,16 @@ func decreaseTokenQuota(id int, quota int) (err error) {
 	return err
 }
 
+// QuotaConsumedHook 令牌扣费成功后调用，文本、Midjourney 与异步任务的扣费都会经过这里，
+// 由 service 注册额度提醒检查，避免 model 依赖 service
+var QuotaConsumedHook func(userId int, tokenId int)
+
+func notifyQuotaConsumed(userId int, tokenId int) {
+	if QuotaConsumedHook != nil {
+		QuotaConsumedHook(userId, tokenId)
+	}
+}
+
 func PreConsumeTokenQuota(tokenId int, quota int) (userQuota int, err error) {
 	if quota < 0 {
 		return 0, errors.New("quota 不能为负数！")
@@ -252,6 +368,25 @@ func PreConsumeTokenQuota(tokenId int, quota int) (userQuota int, err error) {
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return 0, errors.New("令牌额度不足")
 	}
+	if token.OrgId != 0 {
+		userQuota, err = GetOrganizationBillingQuota(token.OrgId, token.UserId)
+		if err != nil {
+			return 0, err
+		}
+		if userQuota < quota {
+			return 0, errors.New(fmt.Sprintf("组织额度不足，剩余额度为 %d", userQuota))
+		}
+		// 先原子地预扣组织额度，失败时令牌额度保持不变
+		err = PreConsumeOrganizationQuota(token.OrgId, token.UserId, quota)
+		if err != nil {
+			return 0, err
+		}
+		err = DecreaseTokenQuota(tokenId, quota)
+		if err == nil {
+			notifyQuotaConsumed(token.UserId, tokenId)
+		}
+		return userQuota - quota, err
+	}
 	userQuota, err = GetUserQuota(token.UserId)
 	if err != nil {
 		return 0, err
@@ -264,13 +399,24 @@ func PreConsumeTokenQuota(tokenId int, quota int) (userQuota int, err error) {
 		return 0, err
 	}
 	err = DecreaseUserQuota(token.UserId, quota)
+	if err == nil {
+		notifyQuotaConsumed(token.UserId, tokenId)
+	}
 	return userQuota - quota, err
 }
 
 func PostConsumeTokenQuota(tokenId int, userQuota int, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 	token, err := GetTokenById(tokenId)
 
-	if quota > 0 {
+	if token.OrgId != 0 {
+		if quota > 0 {
+			err = DecreaseOrganizationQuota(token.OrgId, token.UserId, quota)
+		} else {
+			err = IncreaseOrganizationQuota(token.OrgId, token.UserId, -quota)
+		}
+		// 组织额度不足的提醒不发送给成员个人
+		sendEmail = false
+	} else if quota > 0 {
 		err = DecreaseUserQuota(token.UserId, quota)
 	} else {
 		err = IncreaseUserQuota(token.UserId, -quota)
@@ -287,6 +433,9 @@ func PostConsumeTokenQuota(tokenId int, userQuota int, quota int, preConsumedQuo
 	if err != nil {
 		return err
 	}
+	if quota > 0 {
+		notifyQuotaConsumed(token.UserId, tokenId)
+	}
 
 	if sendEmail {
 		if (quota + preConsumedQuota) != 0 {
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestTokenKeyHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"normal key", "abcdefgh1234567890abcdefgh1234567890abcdefgh12", false},
+		{"minimum length", "abcdefgh", false},
+		{"too short", "abcdefg", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &Token{Key: tt.key}
+			err := token.setKeyHash()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setKeyHash error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if token.KeyPrefix != tt.key[:tokenKeyPrefixLength] {
+				t.Errorf("KeyPrefix = %q", token.KeyPrefix)
+			}
+			if token.KeyHash != hashTokenKey(token.KeySalt, tt.key) || len(token.KeyHash) != 64 {
+				t.Errorf("KeyHash does not match salted hash")
+			}
+			other := &Token{Key: tt.key}
+			_ = other.setKeyHash()
+			if other.KeySalt == token.KeySalt || other.KeyHash == token.KeyHash {
+				t.Errorf("each token should use its own salt")
+			}
+		})
+	}
+}
+
+func TestGetTokenByKey(t *testing.T) {
+	setupTestDB(t)
+	// 两个令牌前缀相同，需要依靠哈希区分
+	keys := []string{"sharedpfAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", "sharedpfBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"}
+	ids := make(map[string]int)
+	for i, key := range keys {
+		token := &Token{UserId: 1, Key: key, Name: "test", Status: 1, ExpiredTime: -1}
+		if err := token.Insert(); err != nil {
+			t.Fatalf("insert token %d: %v", i, err)
+		}
+		ids[key] = token.Id
+	}
+	var stored Token
+	if err := DB.First(&stored, ids[keys[0]]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Key != "" || stored.KeyHash == "" {
+		t.Errorf("plain text key should not be stored")
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		wantId int
+	}{
+		{"first key", keys[0], ids[keys[0]]},
+		{"second key", keys[1], ids[keys[1]]},
+		{"same prefix wrong key", "sharedpfCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC", 0},
+		{"unknown prefix", "unknownpAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", 0},
+		{"too short", "shared", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := GetTokenByKey(tt.key)
+			if tt.wantId == 0 {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					t.Errorf("GetTokenByKey error = %v, want record not found", err)
+				}
+				return
+			}
+			if err != nil || token.Id != tt.wantId {
+				t.Errorf("GetTokenByKey = %v, %v, want id %d", token, err, tt.wantId)
+			}
+		})
+	}
+}
@@ -4,18 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"one-api/common"
 )
 
 type TopUp struct {
-	Id           int     `json:"id"`
-	UserId       int     `json:"user_id" gorm:"index"`
-	Amount       int     `json:"amount"`
-	Money        float64 `json:"money"`
-	TradeNo      string  `json:"trade_no" gorm:"unique"`
-	CreateTime   int64   `json:"create_time"`
-	CompleteTime int64   `json:"complete_time"`
-	Status       string  `json:"status"`
+	Id            int     `json:"id"`
+	UserId        int     `json:"user_id" gorm:"index"`
+	Amount        int     `json:"amount"`
+	Money         float64 `json:"money"`
+	TradeNo       string  `json:"trade_no" gorm:"unique"`
+	PaymentId     string  `json:"payment_id" gorm:"index"` // 支付渠道侧的交易号，用于关联退款与争议
+	CreateTime    int64   `json:"create_time"`
+	CompleteTime  int64   `json:"complete_time"`
+	Status        string  `json:"status"`
+	RefundedQuota int     `json:"refunded_quota" gorm:"default:0"` // 已因退款或争议扣回的额度
 }
 
 func (topUp *TopUp) Insert() error {
@@ -50,7 +53,7 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
-func Recharge(referenceId string, customerId string) (err error) {
+func Recharge(referenceId string, customerId string, paymentId string) (err error) {
 	if referenceId == "" {
 		return errors.New("未提供支付单号")
 	}
@@ -64,7 +67,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(refCol+" = ?", referenceId).First(topUp).Error
 		if err != nil {
 			return errors.New("充值订单不存在")
 		}
@@ -75,6 +78,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
+		topUp.PaymentId = paymentId
 		err = tx.Save(topUp).Error
 		if err != nil {
 			return err
@@ -97,3 +101,93 @@ func Recharge(referenceId string, customerId string) (err error) {
 
 	return nil
 }
+
+// TopUpExistsByPaymentId 判断是否有订单记录了该支付交易号
+func TopUpExistsByPaymentId(paymentId string) bool {
+	var count int64
+	DB.Model(&TopUp{}).Where("payment_id = ?", paymentId).Count(&count)
+	return count > 0
+}
+
+// ReverseTopUp 因退款或争议扣回充值额度。
+// ratio 为累计退款（或争议）金额占订单金额的比例，重复通知只会扣除尚未扣回的部分；
+// 扣除后用户余额允许为负数，若开启了 RefundDisableUserEnabled 则同时禁用该用户。
+// 早于记录支付交易号的订单没有 payment_id（迁移新增的列为 NULL），此时按 tradeNo 查找订单并补记交易号。
+// 目前只有 Stripe 会推送退款与争议通知，其他支付方式的退款需由管理员手动调整用户额度。
+func ReverseTopUp(paymentId string, tradeNo string, ratio float64, status string, reason string) (err error) {
+	if paymentId == "" {
+		return errors.New("未提供支付交易号")
+	}
+	if ratio <= 0 {
+		return nil
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+
+	var deducted int
+	var disabled bool
+	topUp := &TopUp{}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("payment_id = ?", paymentId).Limit(1).Find(topUp).Error
+		if err != nil {
+			return err
+		}
+		if topUp.Id == 0 && tradeNo != "" {
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("trade_no = ? and (payment_id = ? or payment_id is null)", tradeNo, "").Limit(1).Find(topUp).Error
+			if err != nil {
+				return err
+			}
+			topUp.PaymentId = paymentId
+		}
+		if topUp.Id == 0 {
+			return errors.New("充值订单不存在")
+		}
+
+		if topUp.Status == common.TopUpStatusPending || topUp.Status == common.TopUpStatusExpired {
+			return errors.New("充值订单状态错误")
+		}
+
+		target := int(topUp.Money * common.QuotaPerUnit * ratio)
+		deducted = target - topUp.RefundedQuota
+		if deducted <= 0 {
+			return nil
+		}
+
+		topUp.RefundedQuota = target
+		if ratio >= 1 {
+			topUp.Status = status
+		}
+		err = tx.Save(topUp).Error
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"quota": gorm.Expr("quota - ?", deducted)}
+		if common.RefundDisableUserEnabled {
+			updates["status"] = common.UserStatusDisabled
+			disabled = true
+		}
+		return tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updates).Error
+	})
+
+	if err != nil {
+		return errors.New("扣回充值额度失败，" + err.Error())
+	}
+	if deducted <= 0 {
+		return nil
+	}
+
+	_ = CacheUpdateUserQuota(topUp.UserId)
+	content := fmt.Sprintf("%s，扣回额度: %v，订单号：%s", reason, common.LogQuota(deducted), topUp.TradeNo)
+	if disabled {
+		if common.RedisEnabled {
+			_ = common.RedisDel(fmt.Sprintf("user_enabled:%d", topUp.UserId))
+		}
+		content += "，用户已被禁用"
+	}
+	RecordLog(topUp.UserId, LogTypeTopup, content)
+
+	return nil
+}
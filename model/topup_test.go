@@ -0,0 +1,70 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestReverseTopUp(t *testing.T) {
+	setupTestDB(t)
+	common.QuotaPerUnit = 100
+	common.RefundDisableUserEnabled = false
+
+	tests := []struct {
+		name        string
+		paymentId   string // 订单上记录的支付交易号，为空表示早期订单
+		notifyId    string // 通知中的支付交易号
+		tradeNo     string // 通知时找回的订单号
+		ratios      []float64
+		wantErr     bool
+		wantQuota   int
+		wantPayment string
+		nullPayment bool // 模拟迁移前的订单，payment_id 为 NULL
+	}{
+		{"partial then full refund", "pi_new", "pi_new", "", []float64{0.5, 0.5, 1}, false, 0, "pi_new", false},
+		{"legacy order found by trade no", "", "pi_legacy", "legacy-trade", []float64{0.25}, false, 750, "pi_legacy", false},
+		{"legacy order without trade no", "", "pi_unknown", "", []float64{1}, true, 1000, "", false},
+		{"legacy order with null payment id", "", "pi_null", "null-trade", []float64{1}, false, 0, "pi_null", true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userId := 200 + i
+			createTestUser(t, userId)
+			if err := DB.Model(&User{}).Where("id = ?", userId).Update("quota", 1000).Error; err != nil {
+				t.Fatalf("set quota: %v", err)
+			}
+			tradeNo := tt.tradeNo
+			if tradeNo == "" {
+				tradeNo = common.GetUUID()
+			}
+			topUp := &TopUp{UserId: userId, Money: 10, TradeNo: tradeNo, PaymentId: tt.paymentId, Status: common.TopUpStatusSuccess}
+			if err := topUp.Insert(); err != nil {
+				t.Fatalf("insert top up: %v", err)
+			}
+			if tt.nullPayment {
+				if err := DB.Model(topUp).Update("payment_id", gorm.Expr("NULL")).Error; err != nil {
+					t.Fatalf("clear payment id: %v", err)
+				}
+			}
+			var err error
+			for _, ratio := range tt.ratios {
+				err = ReverseTopUp(tt.notifyId, tt.tradeNo, ratio, common.TopUpStatusRefunded, "refund")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReverseTopUp error = %v, want error %v", err, tt.wantErr)
+			}
+			quota, err := GetUserQuota(userId)
+			if err != nil {
+				t.Fatalf("get user quota: %v", err)
+			}
+			if quota != tt.wantQuota {
+				t.Errorf("user quota = %d, want %d", quota, tt.wantQuota)
+			}
+			if got := GetTopUpById(topUp.Id); got.PaymentId != tt.wantPayment {
+				t.Errorf("payment id = %q, want %q", got.PaymentId, tt.wantPayment)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strings"
+	"time"
+)
+
+const twoFactorRecoveryCodeCount = 10
+
+// TwoFactor 用户的 TOTP 两步验证配置
+// 恢复码仅保存 SHA-256 摘要，明文只在生成时返回一次；LastUsedStep 记录最近一次使用的时间步，防止验证码被重放。
+type TwoFactor struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"uniqueIndex"`
+	Secret        string `json:"-" gorm:"type:varchar(64)"`
+	Enabled       bool   `json:"enabled"`
+	RecoveryCodes string `json:"-" gorm:"type:text"`
+	LastUsedStep  int64  `json:"-" gorm:"bigint;default:0"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	EnabledTime   int64  `json:"enabled_time" gorm:"bigint;default:0"`
+}
+
+func GetTwoFactorByUserId(userId int) (*TwoFactor, error) {
+	if userId == 0 {
+		return nil, errors.New("userId 为空！")
+	}
+	twoFactor := TwoFactor{}
+	err := DB.First(&twoFactor, "user_id = ?", userId).Error
+	return &twoFactor, err
+}
+
+func IsTwoFactorEnabled(userId int) bool {
+	return DB.Where("user_id = ? and enabled = ?", userId, true).Find(&TwoFactor{}).RowsAffected == 1
+}
+
+// SetupTwoFactor 生成新的密钥，在使用验证码确认之前不会生效
+func SetupTwoFactor(userId int) (string, error) {
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	twoFactor, err := GetTwoFactorByUserId(userId)
+	if err == nil {
+		if twoFactor.Enabled {
+			return "", errors.New("已启用两步验证，请先关闭后再重新绑定")
+		}
+		err = DB.Model(twoFactor).Updates(map[string]interface{}{
+			"secret":         secret,
+			"last_used_step": 0,
+		}).Error
+		return secret, err
+	}
+	twoFactor = &TwoFactor{
+		UserId:      userId,
+		Secret:      secret,
+		CreatedTime: common.GetTimestamp(),
+	}
+	return secret, DB.Create(twoFactor).Error
+}
+
+// EnableTwoFactor 使用验证器生成的验证码确认绑定，成功后返回恢复码明文
+func EnableTwoFactor(userId int, code string) ([]string, error) {
+	twoFactor, err := GetTwoFactorByUserId(userId)
+	if err != nil {
+		return nil, errors.New("请先生成两步验证密钥")
+	}
+	if twoFactor.Enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+	step, ok := common.ValidateTOTP(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("验证码错误")
+	}
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(twoFactor).Updates(map[string]interface{}{
+		"enabled":        true,
+		"enabled_time":   common.GetTimestamp(),
+		"last_used_step": step,
+		"recovery_codes": hashed,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	cacheSetTwoFactorEnabled(userId, true)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes 生成新的恢复码，旧恢复码全部失效
+func RegenerateRecoveryCodes(userId int) ([]string, error) {
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	result := DB.Model(&TwoFactor{}).Where("user_id = ? and enabled = ?", userId, true).Update("recovery_codes", hashed)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("未启用两步验证")
+	}
+	return codes, nil
+}
+
+func DeleteTwoFactor(userId int) error {
+	err := DB.Where("user_id = ?", userId).Delete(&TwoFactor{}).Error
+	if err != nil {
+		return err
+	}
+	cacheSetTwoFactorEnabled(userId, false)
+	return nil
+}
+
+// VerifyTwoFactorCode 校验 TOTP 验证码或恢复码，恢复码使用后即作废
+func VerifyTwoFactorCode(userId int, code string) error {
+	twoFactor, err := GetTwoFactorByUserId(userId)
+	if err != nil || !twoFactor.Enabled {
+		return errors.New("未启用两步验证")
+	}
+	code = strings.TrimSpace(code)
+	if step, ok := common.ValidateTOTP(twoFactor.Secret, code, time.Now()); ok {
+		result := DB.Model(&TwoFactor{}).Where("id = ? and last_used_step < ?", twoFactor.Id, step).Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("验证码已被使用，请等待下一个验证码")
+		}
+		return nil
+	}
+	return useRecoveryCode(twoFactor, code)
+}
+
+// RemainingRecoveryCodes 返回未使用的恢复码数量
+func (twoFactor *TwoFactor) RemainingRecoveryCodes() int {
+	var hashes []string
+	_ = json.Unmarshal([]byte(twoFactor.RecoveryCodes), &hashes)
+	return len(hashes)
+}
+
+func useRecoveryCode(twoFactor *TwoFactor, code string) error {
+	var hashes []string
+	_ = json.Unmarshal([]byte(twoFactor.RecoveryCodes), &hashes)
+	hashed := hex.EncodeToString(common.Sha256Raw(strings.ToLower(code)))
+	for i, h := range hashes {
+		if h != hashed {
+			continue
+		}
+		remaining := append(hashes[:i:i], hashes[i+1:]...)
+		jsonBytes, err := json.Marshal(remaining)
+		if err != nil {
+			return err
+		}
+		// 以原值为条件更新，避免并发请求重复使用同一恢复码
+		result := DB.Model(&TwoFactor{}).Where("id = ? and recovery_codes = ?", twoFactor.Id, twoFactor.RecoveryCodes).Update("recovery_codes", string(jsonBytes))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("恢复码已被使用")
+		}
+		common.SysLog(fmt.Sprintf("user %d used a 2fa recovery code", twoFactor.UserId))
+		return nil
+	}
+	return errors.New("验证码错误")
+}
+
+func generateRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, 0, twoFactorRecoveryCodeCount)
+	hashes := make([]string, 0, twoFactorRecoveryCodeCount)
+	for i := 0; i < twoFactorRecoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, "", err
+		}
+		raw := hex.EncodeToString(b)
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hex.EncodeToString(common.Sha256Raw(code)))
+	}
+	jsonBytes, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, string(jsonBytes), nil
+}
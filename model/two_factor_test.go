@@ -0,0 +1,64 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"one-api/common"
+)
+
+// 按 RFC 6238 生成指定时间的验证码
+func testTOTPCode(secret []byte, at time.Time) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(at.Unix()/common.TOTPPeriod))
+	h := hmac.New(sha1.New, secret)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+func TestVerifyTwoFactorCodeReplay(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, 2)
+	key := []byte("12345678901234567890")
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+	now := time.Now()
+	twoFactor := &TwoFactor{UserId: 2, Secret: secret, Enabled: true, RecoveryCodes: "[]", CreatedTime: now.Unix()}
+	if err := DB.Create(twoFactor).Error; err != nil {
+		t.Fatal(err)
+	}
+	current := now.Unix() / common.TOTPPeriod
+	previousCode := testTOTPCode(key, now.Add(-common.TOTPPeriod*time.Second))
+	currentCode := testTOTPCode(key, now)
+
+	tests := []struct {
+		name     string
+		lastStep int64
+		code     string
+		wantErr  bool
+	}{
+		{"first use", 0, currentCode, false},
+		{"replay same code", -1, currentCode, true},
+		{"older step after newer", current, previousCode, true},
+		{"previous step not yet used", current - 2, previousCode, false},
+		{"wrong code", 0, "000000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.lastStep >= 0 {
+				DB.Model(twoFactor).Update("last_used_step", tt.lastStep)
+			}
+			err := VerifyTwoFactorCode(2, tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyTwoFactorCode error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
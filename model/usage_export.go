@@ -0,0 +1,191 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const usageExportBatchSize = 1000
+
+// UsageExportFilter 用量导出的筛选条件，与日志查询一致，UserId 不为 0 时只导出该用户
+type UsageExportFilter struct {
+	UserId         int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+}
+
+// UsageAggregate 按天或按模型汇总的用量，按天汇总时 Key 为当天零点（服务器时区）的时间戳
+type UsageAggregate struct {
+	Key              string `json:"key" gorm:"column:group_key"`
+	Count            int64  `json:"count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TokenUsed        int64  `json:"token_used"`
+	Quota            int64  `json:"quota"`
+}
+
+func (filter *UsageExportFilter) applyToLogs(tx *gorm.DB) *gorm.DB {
+	tx = tx.Where("type = ?", LogTypeConsume)
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	if filter.ModelName != "" {
+		tx = tx.Where("model_name like ?", filter.ModelName)
+	}
+	if filter.Username != "" {
+		tx = tx.Where("username = ?", filter.Username)
+	}
+	if filter.TokenName != "" {
+		tx = tx.Where("token_name = ?", filter.TokenName)
+	}
+	if filter.Channel != 0 {
+		tx = tx.Where("channel_id = ?", filter.Channel)
+	}
+	return tx
+}
+
+// 令牌与渠道不在使用数据中记录，这两个筛选条件对 QuotaData 无效
+func (filter *UsageExportFilter) applyToQuotaData(tx *gorm.DB) *gorm.DB {
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	if filter.ModelName != "" {
+		tx = tx.Where("model_name like ?", filter.ModelName)
+	}
+	if filter.Username != "" {
+		tx = tx.Where("username = ?", filter.Username)
+	}
+	return tx
+}
+
+// ExportConsumeLogs 按 id 分批读取消费日志并逐条交给 fn，内存占用与导出总量无关
+func ExportConsumeLogs(ctx context.Context, filter *UsageExportFilter, fn func(log *Log) error) error {
+	lastId := 0
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var logs []*Log
+		err := filter.applyToLogs(LOG_DB.Model(&Log{})).Where("id > ?", lastId).
+			Order("id asc").Limit(usageExportBatchSize).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			if err = fn(log); err != nil {
+				return err
+			}
+		}
+		if len(logs) < usageExportBatchSize {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+	}
+}
+
+// ExportQuotaData 按 id 分批读取使用数据并逐条交给 fn
+func ExportQuotaData(ctx context.Context, filter *UsageExportFilter, fn func(data *QuotaData) error) error {
+	lastId := 0
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var quotaDatas []*QuotaData
+		err := filter.applyToQuotaData(DB.Table("quota_data")).Where("id > ?", lastId).
+			Order("id asc").Limit(usageExportBatchSize).Find(&quotaDatas).Error
+		if err != nil {
+			return err
+		}
+		for _, data := range quotaDatas {
+			if err = fn(data); err != nil {
+				return err
+			}
+		}
+		if len(quotaDatas) < usageExportBatchSize {
+			return nil
+		}
+		lastId = quotaDatas[len(quotaDatas)-1].Id
+	}
+}
+
+// 时区偏移都是 15 分钟的整数倍，按天汇总时先在数据库中按 15 分钟分组，
+// 再按每组所在的本地日期合并，夏令时切换前后的日志也能归入正确的日期
+const usageAggregateDayBucketSeconds = 900
+
+func usageAggregateKey(groupBy string) (string, error) {
+	switch groupBy {
+	case "day":
+		return fmt.Sprintf("created_at - created_at %% %d", usageAggregateDayBucketSeconds), nil
+	case "model":
+		return "model_name", nil
+	}
+	return "", fmt.Errorf("不支持的汇总方式: %s", groupBy)
+}
+
+func aggregateUsage(tx *gorm.DB, groupBy string, fields string) (aggregates []*UsageAggregate, err error) {
+	key, err := usageAggregateKey(groupBy)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Select(key + " as group_key, " + fields).Group(key).Order(key).Scan(&aggregates).Error
+	if err != nil || groupBy != "day" {
+		return aggregates, err
+	}
+	return mergeUsageAggregatesByDay(aggregates)
+}
+
+// mergeUsageAggregatesByDay 将按时间排序的 15 分钟分组合并为按本地日期的汇总，Key 为当天零点的时间戳
+func mergeUsageAggregatesByDay(buckets []*UsageAggregate) ([]*UsageAggregate, error) {
+	days := make([]*UsageAggregate, 0)
+	var current *UsageAggregate
+	for _, bucket := range buckets {
+		timestamp, err := strconv.ParseInt(bucket.Key, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		y, m, d := time.Unix(timestamp, 0).Date()
+		key := strconv.FormatInt(time.Date(y, m, d, 0, 0, 0, 0, time.Local).Unix(), 10)
+		if current == nil || current.Key != key {
+			current = &UsageAggregate{Key: key}
+			days = append(days, current)
+		}
+		current.Count += bucket.Count
+		current.PromptTokens += bucket.PromptTokens
+		current.CompletionTokens += bucket.CompletionTokens
+		current.TokenUsed += bucket.TokenUsed
+		current.Quota += bucket.Quota
+	}
+	return days, nil
+}
+
+// AggregateConsumeLogs 按天（day）或按模型（model）汇总消费日志
+func AggregateConsumeLogs(filter *UsageExportFilter, groupBy string) ([]*UsageAggregate, error) {
+	return aggregateUsage(filter.applyToLogs(LOG_DB.Model(&Log{})), groupBy,
+		"count(*) as count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(prompt_tokens) + sum(completion_tokens) as token_used, sum(quota) as quota")
+}
+
+// AggregateQuotaData 按天（day）或按模型（model）汇总使用数据
+func AggregateQuotaData(filter *UsageExportFilter, groupBy string) ([]*UsageAggregate, error) {
+	return aggregateUsage(filter.applyToQuotaData(DB.Table("quota_data")), groupBy,
+		"sum(count) as count, sum(token_used) as token_used, sum(quota) as quota")
+}
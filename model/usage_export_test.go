@@ -0,0 +1,198 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func createTestUsageLogs(t *testing.T, logs []*Log) {
+	t.Helper()
+	for _, log := range logs {
+		if err := LOG_DB.Create(log).Error; err != nil {
+			t.Fatalf("create log: %v", err)
+		}
+	}
+}
+
+func exportedLogContents(t *testing.T, filter *UsageExportFilter) []string {
+	t.Helper()
+	contents := make([]string, 0)
+	err := ExportConsumeLogs(context.Background(), filter, func(log *Log) error {
+		contents = append(contents, log.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExportConsumeLogs error: %v", err)
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+func logContents(logs []*Log) []string {
+	contents := make([]string, 0, len(logs))
+	for _, log := range logs {
+		contents = append(contents, log.Content)
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 导出的日志与日志页面使用相同条件查询到的消费日志一致
+func TestUsageExportFilterParity(t *testing.T) {
+	setupTestDB(t)
+	createTestUsageLogs(t, []*Log{
+		{UserId: 1, Username: "root", Type: LogTypeConsume, CreatedAt: 1000, ModelName: "gpt-4o", TokenName: "a", ChannelId: 1, Content: "1"},
+		{UserId: 1, Username: "root", Type: LogTypeConsume, CreatedAt: 2000, ModelName: "gpt-4o-mini", TokenName: "b", ChannelId: 2, Content: "2"},
+		{UserId: 2, Username: "alice", Type: LogTypeConsume, CreatedAt: 3000, ModelName: "gpt-4o", TokenName: "a", ChannelId: 2, Content: "3"},
+		{UserId: 2, Username: "alice", Type: LogTypeConsume, CreatedAt: 4000, ModelName: "claude-3", TokenName: "c", ChannelId: 1, Content: "4"},
+		{UserId: 2, Username: "alice", Type: LogTypeError, CreatedAt: 3500, ModelName: "gpt-4o", TokenName: "a", ChannelId: 2, Content: "5"},
+		{UserId: 1, Username: "root", Type: LogTypeTopup, CreatedAt: 1500, Content: "6"},
+	})
+
+	tests := []struct {
+		name   string
+		filter UsageExportFilter
+	}{
+		{"no filter", UsageExportFilter{}},
+		{"time range", UsageExportFilter{StartTimestamp: 2000, EndTimestamp: 3500}},
+		{"model like", UsageExportFilter{ModelName: "gpt-4o%"}},
+		{"username", UsageExportFilter{Username: "alice"}},
+		{"token name", UsageExportFilter{TokenName: "a"}},
+		{"channel", UsageExportFilter{Channel: 2}},
+		{"user", UsageExportFilter{UserId: 2}},
+		{"user and model", UsageExportFilter{UserId: 1, ModelName: "gpt-4o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			var logs []*Log
+			var err error
+			if filter.UserId != 0 {
+				logs, _, err = GetUserLogs(filter.UserId, LogTypeConsume, filter.StartTimestamp, filter.EndTimestamp, filter.ModelName, filter.TokenName, 0, 100)
+			} else {
+				logs, _, err = GetAllLogs(LogTypeConsume, filter.StartTimestamp, filter.EndTimestamp, filter.ModelName, filter.Username, filter.TokenName, 0, 100, filter.Channel)
+			}
+			if err != nil {
+				t.Fatalf("query logs: %v", err)
+			}
+			want := logContents(logs)
+			if got := exportedLogContents(t, &filter); !equalStrings(got, want) {
+				t.Errorf("exported logs %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// 按天汇总以本地日期分组，夏令时切换当天不会把日志归入相邻的日期
+func TestAggregateUsageByDay(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	local := time.Local
+	time.Local = location
+	t.Cleanup(func() {
+		time.Local = local
+	})
+	setupTestDB(t)
+
+	at := func(value string) int64 {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+		if err != nil {
+			t.Fatalf("parse time: %v", err)
+		}
+		return parsed.Unix()
+	}
+	midnight := func(day string) string {
+		return strconv.FormatInt(at(day+" 00:00"), 10)
+	}
+	// 2024-03-10 与 2024-11-03 为纽约夏令时的开始与结束日
+	createTestUsageLogs(t, []*Log{
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: at("2024-03-09 23:30"), ModelName: "gpt-4o", PromptTokens: 1, CompletionTokens: 2, Quota: 10},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: at("2024-03-10 00:10"), ModelName: "gpt-4o", PromptTokens: 3, CompletionTokens: 4, Quota: 20},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: at("2024-03-10 23:50"), ModelName: "claude-3", PromptTokens: 5, CompletionTokens: 6, Quota: 30},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: at("2024-11-03 00:05"), ModelName: "gpt-4o", PromptTokens: 7, CompletionTokens: 8, Quota: 40},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: at("2024-11-03 23:55"), ModelName: "claude-3", PromptTokens: 9, CompletionTokens: 10, Quota: 50},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: at("2024-11-04 00:00"), ModelName: "gpt-4o", PromptTokens: 11, CompletionTokens: 12, Quota: 60},
+	})
+
+	tests := []struct {
+		groupBy string
+		want    []UsageAggregate
+	}{
+		{"day", []UsageAggregate{
+			{Key: midnight("2024-03-09"), Count: 1, PromptTokens: 1, CompletionTokens: 2, TokenUsed: 3, Quota: 10},
+			{Key: midnight("2024-03-10"), Count: 2, PromptTokens: 8, CompletionTokens: 10, TokenUsed: 18, Quota: 50},
+			{Key: midnight("2024-11-03"), Count: 2, PromptTokens: 16, CompletionTokens: 18, TokenUsed: 34, Quota: 90},
+			{Key: midnight("2024-11-04"), Count: 1, PromptTokens: 11, CompletionTokens: 12, TokenUsed: 23, Quota: 60},
+		}},
+		{"model", []UsageAggregate{
+			{Key: "claude-3", Count: 2, PromptTokens: 14, CompletionTokens: 16, TokenUsed: 30, Quota: 80},
+			{Key: "gpt-4o", Count: 4, PromptTokens: 22, CompletionTokens: 26, TokenUsed: 48, Quota: 130},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			aggregates, err := AggregateConsumeLogs(&UsageExportFilter{}, tt.groupBy)
+			if err != nil {
+				t.Fatalf("AggregateConsumeLogs error: %v", err)
+			}
+			if len(aggregates) != len(tt.want) {
+				t.Fatalf("got %d aggregates, want %d", len(aggregates), len(tt.want))
+			}
+			for i, aggregate := range aggregates {
+				if *aggregate != tt.want[i] {
+					t.Errorf("aggregate %d = %+v, want %+v", i, *aggregate, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateQuotaDataByDay(t *testing.T) {
+	setupTestDB(t)
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	yesterday := today.AddDate(0, 0, -1)
+	for _, data := range []*QuotaData{
+		{UserID: 1, ModelName: "gpt-4o", CreatedAt: yesterday.Add(23 * time.Hour).Unix(), Count: 2, TokenUsed: 100, Quota: 10},
+		{UserID: 1, ModelName: "gpt-4o", CreatedAt: today.Unix(), Count: 1, TokenUsed: 50, Quota: 5},
+		{UserID: 1, ModelName: "claude-3", CreatedAt: today.Add(time.Hour).Unix(), Count: 3, TokenUsed: 30, Quota: 7},
+	} {
+		if err := DB.Create(data).Error; err != nil {
+			t.Fatalf("create quota data: %v", err)
+		}
+	}
+	aggregates, err := AggregateQuotaData(&UsageExportFilter{}, "day")
+	if err != nil {
+		t.Fatalf("AggregateQuotaData error: %v", err)
+	}
+	want := []UsageAggregate{
+		{Key: strconv.FormatInt(yesterday.Unix(), 10), Count: 2, TokenUsed: 100, Quota: 10},
+		{Key: strconv.FormatInt(today.Unix(), 10), Count: 4, TokenUsed: 80, Quota: 12},
+	}
+	if len(aggregates) != len(want) {
+		t.Fatalf("got %d aggregates, want %d", len(aggregates), len(want))
+	}
+	for i, aggregate := range aggregates {
+		if *aggregate != want[i] {
+			t.Errorf("aggregate %d = %+v, want %+v", i, *aggregate, want[i])
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 type QuotaData struct {
 	Id        int    `json:"id"`
 	UserID    int    `json:"user_id" gorm:"index"`
+	OrgId     int    `json:"org_id" gorm:"default:0;index"`
 	Username  string `json:"username" gorm:"index:idx_qdt_model_user_name,priority:2;size:64;default:''"`
 	ModelName string `json:"model_name" gorm:"index:idx_qdt_model_user_name,priority:1;size:64;default:''"`
 	CreatedAt int64  `json:"created_at" gorm:"bigint;index:idx_qdt_created_at,priority:2"`
@@ -38,8 +39,8 @@ func UpdateQuotaData() {
 var CacheQuotaData = make(map[string]*QuotaData)
 var CacheQuotaDataLock = sync.Mutex{}
 
-func logQuotaDataCache(userId int, username string, modelName string, quota int, createdAt int64, tokenUsed int) {
-	key := fmt.Sprintf("%d-%s-%s-%d", userId, username, modelName, createdAt)
+func logQuotaDataCache(userId int, orgId int, username string, modelName string, quota int, createdAt int64, tokenUsed int) {
+	key := fmt.Sprintf("%d-%d-%s-%s-%d", userId, orgId, username, modelName, createdAt)
 	quotaData, ok := CacheQuotaData[key]
 	if ok {
 		quotaData.Count += 1
@@ -48,6 +49,7 @@ func logQuotaDataCache(userId int, username string, modelName string, quota int,
 	} else {
 		quotaData = &QuotaData{
 			UserID:    userId,
+			OrgId:     orgId,
 			Username:  username,
 			ModelName: modelName,
 			CreatedAt: createdAt,
@@ -59,13 +61,13 @@ func logQuotaDataCache(userId int, username string, modelName string, quota int,
 	CacheQuotaData[key] = quotaData
 }
 
-func LogQuotaData(userId int, username string, modelName string, quota int, createdAt int64, tokenUsed int) {
+func LogQuotaData(userId int, orgId int, username string, modelName string, quota int, createdAt int64, tokenUsed int) {
 	// 只精确到小时
 	createdAt = createdAt - (createdAt % 3600)
 
 	CacheQuotaDataLock.Lock()
 	defer CacheQuotaDataLock.Unlock()
-	logQuotaDataCache(userId, username, modelName, quota, createdAt, tokenUsed)
+	logQuotaDataCache(userId, orgId, username, modelName, quota, createdAt, tokenUsed)
 }
 
 func SaveQuotaDataCache() {
@@ -76,19 +78,20 @@ func SaveQuotaDataCache() {
 		return
 	}
 	common.SysLog("正在更新数据看板数据...")
+	fillQuotaDataUsernames()
 	// 如果缓存中有数据，就保存到数据库中
 	// 1. 先查询数据库中是否有数据
 	// 2. 如果有数据，就更新数据
 	// 3. 如果没有数据，就插入数据
 	for _, quotaData := range CacheQuotaData {
 		quotaDataDB := &QuotaData{}
-		DB.Table("quota_data").Where("user_id = ? and username = ? and model_name = ? and created_at = ?",
-			quotaData.UserID, quotaData.Username, quotaData.ModelName, quotaData.CreatedAt).First(quotaDataDB)
+		DB.Table("quota_data").Where("user_id = ? and org_id = ? and username = ? and model_name = ? and created_at = ?",
+			quotaData.UserID, quotaData.OrgId, quotaData.Username, quotaData.ModelName, quotaData.CreatedAt).First(quotaDataDB)
 		if quotaDataDB.Id > 0 {
 			//quotaDataDB.Count += quotaData.Count
 			//quotaDataDB.Quota += quotaData.Quota
 			//DB.Table("quota_data").Save(quotaDataDB)
-			increaseQuotaData(quotaData.UserID, quotaData.Username, quotaData.ModelName, quotaData.Count, quotaData.Quota, quotaData.CreatedAt)
+			increaseQuotaData(quotaData.UserID, quotaData.OrgId, quotaData.Username, quotaData.ModelName, quotaData.Count, quotaData.Quota, quotaData.CreatedAt)
 		} else {
 			DB.Table("quota_data").Create(quotaData)
 		}
@@ -97,9 +100,28 @@ func SaveQuotaDataCache() {
 	common.SysLog(fmt.Sprintf("保存数据看板数据成功，共保存%d条数据", size))
 }
 
-func increaseQuotaData(userId int, username string, modelName string, count int, quota int, createdAt int64) {
-	err := DB.Table("quota_data").Where("user_id = ? and username = ? and model_name = ? and created_at = ?",
-		userId, username, modelName, createdAt).Updates(map[string]interface{}{
+// fillQuotaDataUsernames 一次查询补全缓存中未记录用户名的使用数据
+func fillQuotaDataUsernames() {
+	userIds := make([]int, 0)
+	for _, quotaData := range CacheQuotaData {
+		if quotaData.Username == "" {
+			userIds = append(userIds, quotaData.UserID)
+		}
+	}
+	if len(userIds) == 0 {
+		return
+	}
+	usernames := GetUsernamesByIds(userIds)
+	for _, quotaData := range CacheQuotaData {
+		if quotaData.Username == "" {
+			quotaData.Username = usernames[quotaData.UserID]
+		}
+	}
+}
+
+func increaseQuotaData(userId int, orgId int, username string, modelName string, count int, quota int, createdAt int64) {
+	err := DB.Table("quota_data").Where("user_id = ? and org_id = ? and username = ? and model_name = ? and created_at = ?",
+		userId, orgId, username, modelName, createdAt).Updates(map[string]interface{}{
 		"count": gorm.Expr("count + ?", count),
 		"quota": gorm.Expr("quota + ?", quota),
 	}).Error
@@ -122,6 +144,17 @@ func GetQuotaDataByUserId(userId int, startTime int64, endTime int64) (quotaData
 	return quotaDatas, err
 }
 
+// GetQuotaDataByOrgId 按模型与时间汇总组织的使用数据，username 不为空时只统计该成员
+func GetQuotaDataByOrgId(orgId int, startTime int64, endTime int64, username string) (quotaData []*QuotaData, err error) {
+	var quotaDatas []*QuotaData
+	tx := DB.Table("quota_data").Where("org_id = ? and created_at >= ? and created_at <= ?", orgId, startTime, endTime)
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	err = tx.Select("model_name, sum(count) as count, sum(quota) as quota, sum(token_used) as token_used, created_at").Group("model_name, created_at").Find(&quotaDatas).Error
+	return quotaDatas, err
+}
+
 func GetAllQuotaDates(startTime int64, endTime int64, username string) (quotaData []*QuotaData, err error) {
 	if username != "" {
 		return GetQuotaDataByUsername(username, startTime, endTime)
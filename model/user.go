@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // User if you add sensitive fields, don't forget to clean them in setupLogin function.
@@ -32,12 +33,15 @@ type User struct {
 	UsedQuota        int            `json:"used_quota" gorm:"type:int;default:0;column:used_quota"` // used quota
 	RequestCount     int            `json:"request_count" gorm:"type:int;default:0;"`               // request number
 	Group            string         `json:"group" gorm:"type:varchar(64);default:'default'"`
+	PreviousGroup    string         `json:"previous_group" gorm:"type:varchar(64);default:''"` // 临时分组到期后恢复的分组
+	GroupExpiredTime int64          `json:"group_expired_time" gorm:"bigint;default:0"`        // 临时分组到期时间，0 表示永久
 	AffCode          string         `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	AffCount         int            `json:"aff_count" gorm:"type:int;default:0;column:aff_count"`
 	AffQuota         int            `json:"aff_quota" gorm:"type:int;default:0;column:aff_quota"`           // 邀请剩余额度
 	AffHistoryQuota  int            `json:"aff_history_quota" gorm:"type:int;default:0;column:aff_history"` // 邀请历史额度
 	InviterId        int            `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"column:stripe_customer;index"`
+	PermissionRoles  string         `json:"permission_roles" gorm:"type:varchar(255);default:''"` // 逗号分隔的自定义权限角色
 	DeletedAt        gorm.DeletedAt `gorm:"index"`
 }
 
@@ -221,6 +225,41 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 }
 
 func (user *User) Insert(inviterId int) error {
+	err := user.prepareInsert()
+	if err != nil {
+		return err
+	}
+	result := DB.Create(user)
+	if result.Error != nil {
+		return result.Error
+	}
+	user.afterInsert(inviterId)
+	return nil
+}
+
+// InsertWithIdentity 在同一事务中创建用户与第三方登录身份，避免身份写入失败时留下无法登录的用户
+func (user *User) InsertWithIdentity(inviterId int, identity *UserIdentity) error {
+	err := user.prepareInsert()
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserId = user.Id
+		identity.CreatedTime = common.GetTimestamp()
+		identity.LastLoginTime = identity.CreatedTime
+		return tx.Create(identity).Error
+	})
+	if err != nil {
+		return err
+	}
+	user.afterInsert(inviterId)
+	return nil
+}
+
+func (user *User) prepareInsert() error {
 	var err error
 	if user.Password != "" {
 		user.Password, err = common.Password2Hash(user.Password)
@@ -231,10 +270,11 @@ func (user *User) Insert(inviterId int) error {
 	user.Quota = common.QuotaForNewUser
 	user.AccessToken = common.GetUUID()
 	user.AffCode = common.GetRandomString(4)
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
-	}
+	return nil
+}
+
+// afterInsert 记录注册赠送额度并处理邀请奖励
+func (user *User) afterInsert(inviterId int) {
 	if common.QuotaForNewUser > 0 {
 		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(common.QuotaForNewUser)))
 	}
@@ -249,7 +289,6 @@ func (user *User) Insert(inviterId int) error {
 			_ = inviteUser(inviterId)
 		}
 	}
-	return nil
 }
 
 func (user *User) Update(updatePassword bool) error {
@@ -291,6 +330,11 @@ func (user *User) Edit(updatePassword bool) error {
 		updates["password"] = newUser.Password
 	}
 	DB.First(&user, user.Id)
+	if user.Group != newUser.Group {
+		// 管理员手动修改分组时取消临时分组
+		updates["previous_group"] = ""
+		updates["group_expired_time"] = 0
+	}
 	err = DB.Model(user).Updates(updates).Error
 	if err == nil {
 		if common.RedisEnabled {
@@ -499,6 +543,11 @@ func GetUserEmail(id int) (email string, err error) {
 	return email, err
 }
 
+func GetUserTelegramId(id int) (telegramId string, err error) {
+	err = DB.Model(&User{}).Where("id = ?", id).Select("telegram_id").Find(&telegramId).Error
+	return telegramId, err
+}
+
 func GetUserGroup(id int) (group string, err error) {
 	groupCol := "`group`"
 	if common.UsingPostgreSQL {
@@ -589,3 +638,164 @@ func GetUsernameById(id int) (username string, err error) {
 	err = DB.Model(&User{}).Where("id = ?", id).Select("username").Find(&username).Error
 	return username, err
 }
+
+// GetUsernamesByIds 批量查询用户名，用于批量写入日志与使用数据
+func GetUsernamesByIds(ids []int) map[int]string {
+	usernames := make(map[int]string)
+	seen := make(map[int]bool, len(ids))
+	uniqueIds := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			uniqueIds = append(uniqueIds, id)
+		}
+	}
+	ids = uniqueIds
+	for start := 0; start < len(ids); start += 500 {
+		end := start + 500
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var users []*User
+		err := DB.Unscoped().Select("id", "username").Where("id in ?", ids[start:end]).Find(&users).Error
+		if err != nil {
+			common.SysError("failed to get usernames: " + err.Error())
+			continue
+		}
+		for _, user := range users {
+			usernames[user.Id] = user.Username
+		}
+	}
+	return usernames
+}
+
+// grantUserGroup 将用户升级到指定分组，duration 大于 0 时到期后恢复原分组
+func grantUserGroup(tx *gorm.DB, id int, group string, duration int64) error {
+	user := &User{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "group", "previous_group", "group_expired_time").First(user, "id = ?", id).Error
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"group": group}
+	now := common.GetTimestamp()
+	temporary := user.GroupExpiredTime > now
+	if duration <= 0 {
+		updates["previous_group"] = ""
+		updates["group_expired_time"] = 0
+	} else if temporary && user.Group == group {
+		updates["group_expired_time"] = user.GroupExpiredTime + duration
+	} else {
+		if !temporary {
+			updates["previous_group"] = user.Group
+		}
+		updates["group_expired_time"] = now + duration
+	}
+	return tx.Model(&User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// SetUserGroup 永久设置用户分组并刷新缓存，用于外部登录提供方的分组同步
+func SetUserGroup(id int, group string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return grantUserGroup(tx, id, group, 0)
+	})
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		_ = common.RedisSet(fmt.Sprintf("user_group:%d", id), group, time.Duration(UserId2GroupCacheSeconds)*time.Second)
+	}
+	return nil
+}
+
+func GetUserPermissionRoles(id int) (roles string, err error) {
+	err = DB.Model(&User{}).Where("id = ?", id).Select("permission_roles").Find(&roles).Error
+	return roles, err
+}
+
+// SetUserPermissionRoles 为用户分配自定义权限角色并刷新缓存
+func SetUserPermissionRoles(id int, roleNames []string) error {
+	roles := strings.Join(roleNames, ",")
+	result := DB.Model(&User{}).Where("id = ?", id).Update("permission_roles", roles)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用户不存在")
+	}
+	if common.RedisEnabled {
+		_ = common.RedisSet(fmt.Sprintf("user_permission_roles:%d", id), roles, time.Duration(UserId2GroupCacheSeconds)*time.Second)
+	}
+	return nil
+}
+
+// GetUserPermissions 返回用户等级与自定义角色合并后的权限列表
+func GetUserPermissions(id int, role int) []string {
+	roles, err := CacheGetUserPermissionRoles(id)
+	if err != nil {
+		common.SysError("failed to get user permission roles: " + err.Error())
+	}
+	return common.GetPermissions(role, common.ParsePermissionRoleNames(roles))
+}
+
+func HasUserPermission(id int, role int, permission string) bool {
+	for _, p := range GetUserPermissions(id, role) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManageUser 判断操作者能否管理目标用户。超级管理员可以管理所有用户；其他操作者需要拥有 user.manage 权限，
+// 不能管理超级管理员，且目标用户的权限必须是操作者权限的真子集，即不能管理同级或权限更多的用户。
+// targetId 为 0 时只按 targetRole 计算权限，用于创建用户或修改用户等级前的校验
+func CanManageUser(actorId int, actorRole int, targetId int, targetRole int) bool {
+	if actorRole >= common.RoleRootUser {
+		return true
+	}
+	if targetRole >= common.RoleRootUser {
+		return false
+	}
+	actorPermissions := GetUserPermissions(actorId, actorRole)
+	if !common.StringsContains(actorPermissions, common.PermissionUserManage) {
+		return false
+	}
+	targetPermissions := common.GetPermissions(targetRole, nil)
+	if targetId != 0 {
+		targetPermissions = GetUserPermissions(targetId, targetRole)
+	}
+	return common.HasMorePermissions(actorPermissions, targetPermissions)
+}
+
+// RevertExpiredUserGroups 将临时分组已到期的用户恢复为原分组
+func RevertExpiredUserGroups() {
+	var users []*User
+	now := common.GetTimestamp()
+	err := DB.Select("id", "previous_group", "group_expired_time").Where("group_expired_time > 0 and group_expired_time < ?", now).Find(&users).Error
+	if err != nil {
+		common.SysError("failed to get users with expired group: " + err.Error())
+		return
+	}
+	for _, user := range users {
+		group := common.GetStringIfEmpty(user.PreviousGroup, "default")
+		err = DB.Model(&User{}).Where("id = ? and group_expired_time = ?", user.Id, user.GroupExpiredTime).Updates(map[string]interface{}{
+			"group":              group,
+			"previous_group":     "",
+			"group_expired_time": 0,
+		}).Error
+		if err != nil {
+			common.SysError("failed to revert user group: " + err.Error())
+			continue
+		}
+		if common.RedisEnabled {
+			_ = common.RedisSet(fmt.Sprintf("user_group:%d", user.Id), group, time.Duration(UserId2GroupCacheSeconds)*time.Second)
+		}
+	}
+}
+
+func SyncUserGroupExpiration(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		RevertExpiredUserGroups()
+	}
+}
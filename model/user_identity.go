@@ -0,0 +1,67 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+)
+
+// UserIdentity 用户与外部登录提供方（OIDC 等）账户的绑定关系
+type UserIdentity struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	Provider      string `json:"provider" gorm:"type:varchar(64);uniqueIndex:idx_provider_subject"`
+	Subject       string `json:"subject" gorm:"type:varchar(255);uniqueIndex:idx_provider_subject"`
+	Email         string `json:"email"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	LastLoginTime int64  `json:"last_login_time" gorm:"bigint;default:0"`
+}
+
+func GetUserIdentity(provider string, subject string) (*UserIdentity, error) {
+	if provider == "" || subject == "" {
+		return nil, errors.New("provider 或 subject 为空！")
+	}
+	identity := UserIdentity{}
+	err := DB.First(&identity, "provider = ? and subject = ?", provider, subject).Error
+	return &identity, err
+}
+
+func IsUserIdentityAlreadyTaken(provider string, subject string) bool {
+	return DB.Where("provider = ? and subject = ?", provider, subject).Find(&UserIdentity{}).RowsAffected == 1
+}
+
+func IsUserIdentityBound(userId int, provider string) bool {
+	return DB.Where("user_id = ? and provider = ?", userId, provider).Find(&UserIdentity{}).RowsAffected >= 1
+}
+
+func GetUserIdentities(userId int) (identities []*UserIdentity, err error) {
+	identities = []*UserIdentity{}
+	err = DB.Where("user_id = ?", userId).Order("id asc").Find(&identities).Error
+	return identities, err
+}
+
+func (identity *UserIdentity) Insert() error {
+	identity.CreatedTime = common.GetTimestamp()
+	identity.LastLoginTime = identity.CreatedTime
+	return DB.Create(identity).Error
+}
+
+func (identity *UserIdentity) UpdateLastLoginTime() {
+	err := DB.Model(identity).Update("last_login_time", common.GetTimestamp()).Error
+	if err != nil {
+		common.SysError("failed to update identity last login time: " + err.Error())
+	}
+}
+
+func DeleteUserIdentityById(id int, userId int) error {
+	if id == 0 || userId == 0 {
+		return errors.New("id 或 userId 为空！")
+	}
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("绑定关系不存在")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+)
+
+func TestCanManageUser(t *testing.T) {
+	setupTestDB(t)
+	common.PermissionRoles = map[string][]string{
+		"support": {common.PermissionUserManage},
+		"auditor": {common.PermissionLogsRead},
+	}
+	t.Cleanup(func() {
+		common.PermissionRoles = map[string][]string{}
+	})
+	users := []struct {
+		id    int
+		role  int
+		roles []string
+	}{
+		{400, common.RoleCommonUser, nil},
+		{401, common.RoleCommonUser, []string{"support"}},
+		{402, common.RoleCommonUser, []string{"support"}},
+		{403, common.RoleCommonUser, []string{"auditor"}},
+		{404, common.RoleAdminUser, nil},
+		{405, common.RoleAdminUser, nil},
+	}
+	for _, u := range users {
+		createTestUser(t, u.id)
+		DB.Model(&User{}).Where("id = ?", u.id).Update("role", u.role)
+		if err := SetUserPermissionRoles(u.id, u.roles); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		actorId    int
+		actorRole  int
+		targetId   int
+		targetRole int
+		want       bool
+	}{
+		{"custom role manages common user", 401, common.RoleCommonUser, 400, common.RoleCommonUser, true},
+		{"custom role cannot manage peer", 401, common.RoleCommonUser, 402, common.RoleCommonUser, false},
+		{"custom role cannot manage user with other permissions", 401, common.RoleCommonUser, 403, common.RoleCommonUser, false},
+		{"custom role cannot manage admin", 401, common.RoleCommonUser, 404, common.RoleAdminUser, false},
+		{"custom role cannot grant admin", 401, common.RoleCommonUser, 400, common.RoleAdminUser, false},
+		{"custom role creates common user", 401, common.RoleCommonUser, 0, common.RoleCommonUser, true},
+		{"no user.manage", 403, common.RoleCommonUser, 400, common.RoleCommonUser, false},
+		{"admin manages custom role user", 404, common.RoleAdminUser, 401, common.RoleCommonUser, true},
+		{"admin cannot manage admin", 404, common.RoleAdminUser, 405, common.RoleAdminUser, false},
+		{"admin cannot manage root", 404, common.RoleAdminUser, 1, common.RoleRootUser, false},
+		{"root manages admin", 1, common.RoleRootUser, 404, common.RoleAdminUser, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanManageUser(tt.actorId, tt.actorRole, tt.targetId, tt.targetRole); got != tt.want {
+				t.Errorf("CanManageUser = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 身份已被其他用户绑定时整体回滚，不会留下没有登录方式的用户
+func TestInsertUserWithIdentity(t *testing.T) {
+	setupTestDB(t)
+	tests := []struct {
+		name      string
+		username  string
+		subject   string
+		wantErr   bool
+		wantUsers int64
+	}{
+		{"new identity", "oidc_user1", "subject-1", false, 1},
+		{"subject already bound", "oidc_user2", "subject-1", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{Username: tt.username, DisplayName: tt.username, Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+			identity := &UserIdentity{Provider: "test", Subject: tt.subject}
+			err := user.InsertWithIdentity(0, identity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InsertWithIdentity error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var count int64
+			if err := DB.Model(&User{}).Where("username = ?", tt.username).Count(&count).Error; err != nil {
+				t.Fatalf("count users: %v", err)
+			}
+			if count != tt.wantUsers {
+				t.Errorf("got %d users named %s, want %d", count, tt.username, tt.wantUsers)
+			}
+			if !tt.wantErr && !IsUserIdentityBound(user.Id, "test") {
+				t.Errorf("identity was not bound to user #%d", user.Id)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"io"
 	"net/http"
 	common2 "one-api/common"
@@ -75,13 +77,22 @@ func doRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 请求地址的查询参数中可能包含密钥，span 只记录主机名
+	_, span := common2.StartClientSpan(c.Request.Context(), "upstream.request", req.Header,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+	)
+	defer span.End()
 	resp, err := httpClient.Do(req)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
 	return resp, nil
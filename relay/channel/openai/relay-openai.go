@@ -90,6 +90,7 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	case <-ticker.C:
 		// 超时处理逻辑
 		common.LogError(c, "streaming timeout")
+		common.RecordStreamTimeout(info.OriginModelName, info.ChannelId)
 	case <-stopChan:
 		// 正常结束
 	}
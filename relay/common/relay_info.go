@@ -14,6 +14,7 @@ type RelayInfo struct {
 	ChannelId            int
 	TokenId              int
 	UserId               int
+	OrgId                int // 组织令牌所属的组织
 	Group                string
 	TokenUnlimited       bool
 	StartTime            time.Time
@@ -33,6 +34,7 @@ type RelayInfo struct {
 	SupportStreamOptions bool
 	ShouldIncludeUsage   bool
 	Proxy                string
+	PricingWindowRatio   float64 // 请求开始时生效的时段定价倍率
 }
 
 func GenRelayInfo(c *gin.Context) (*RelayInfo, error) {
@@ -49,24 +51,26 @@ func GenRelayInfo(c *gin.Context) (*RelayInfo, error) {
 	apiType, _ := constant.ChannelType2APIType(channelType)
 
 	info := &RelayInfo{
-		RelayMode:         constant.Path2RelayMode(c.Request.URL.Path),
-		BaseUrl:           c.GetString("base_url"),
-		RequestURLPath:    c.Request.URL.String(),
-		ChannelType:       channelType,
-		ChannelId:         channelId,
-		TokenId:           tokenId,
-		UserId:            userId,
-		Group:             group,
-		TokenUnlimited:    tokenUnlimited,
-		StartTime:         startTime,
-		FirstResponseTime: startTime.Add(-time.Second),
-		OriginModelName:   c.GetString("original_model"),
-		UpstreamModelName: c.GetString("original_model"),
-		ApiType:           apiType,
-		ApiVersion:        c.GetString("api_version"),
-		ApiKey:            strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
-		Organization:      c.GetString("channel_organization"),
-		Proxy:             c.GetString("proxy"),
+		RelayMode:          constant.Path2RelayMode(c.Request.URL.Path),
+		BaseUrl:            c.GetString("base_url"),
+		RequestURLPath:     c.Request.URL.String(),
+		ChannelType:        channelType,
+		ChannelId:          channelId,
+		TokenId:            tokenId,
+		UserId:             userId,
+		OrgId:              c.GetInt("token_org_id"),
+		Group:              group,
+		TokenUnlimited:     tokenUnlimited,
+		StartTime:          startTime,
+		FirstResponseTime:  startTime.Add(-time.Second),
+		OriginModelName:    c.GetString("original_model"),
+		UpstreamModelName:  c.GetString("original_model"),
+		ApiType:            apiType,
+		ApiVersion:         c.GetString("api_version"),
+		ApiKey:             strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
+		Organization:       c.GetString("channel_organization"),
+		Proxy:              c.GetString("proxy"),
+		PricingWindowRatio: 1,
 	}
 	if info.BaseUrl == "" {
 		ch, exists := common.ChannelMap[channelType]
@@ -99,6 +103,12 @@ func (info *RelayInfo) SetIsStream(isStream bool) {
 	info.IsStream = isStream
 }
 
+// SetPricingWindowRatio 按请求开始时间计算该模型生效的时段定价倍率
+func (info *RelayInfo) SetPricingWindowRatio(modelName string) float64 {
+	info.PricingWindowRatio = common.GetPricingWindowRatio(info.Group, modelName, info.StartTime)
+	return info.PricingWindowRatio
+}
+
 func (info *RelayInfo) SetFirstResponseTime() {
 	if !info.setFirstResponse {
 		info.FirstResponseTime = time.Now()
@@ -111,6 +121,7 @@ type TaskRelayInfo struct {
 	ChannelId         int
 	TokenId           int
 	UserId            int
+	OrgId             int
 	Group             string
 	StartTime         time.Time
 	ApiType           int
@@ -146,6 +157,7 @@ func GenTaskRelayInfo(c *gin.Context) (*TaskRelayInfo, error) {
 		ChannelId:      channelId,
 		TokenId:        tokenId,
 		UserId:         userId,
+		OrgId:          c.GetInt("token_org_id"),
 		Group:          group,
 		StartTime:      startTime,
 		ApiType:        apiType,
@@ -0,0 +1,102 @@
+package constant
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 令牌可以限制的接口范围，按 relay mode 归类
+const (
+	EndpointScopeChat        = "chat"
+	EndpointScopeEmbeddings  = "embeddings"
+	EndpointScopeModerations = "moderations"
+	EndpointScopeImages      = "images"
+	EndpointScopeAudio       = "audio"
+	EndpointScopeRerank      = "rerank"
+	EndpointScopeMidjourney  = "midjourney"
+	EndpointScopeSuno        = "suno"
+)
+
+var EndpointScopes = []string{
+	EndpointScopeChat,
+	EndpointScopeEmbeddings,
+	EndpointScopeModerations,
+	EndpointScopeImages,
+	EndpointScopeAudio,
+	EndpointScopeRerank,
+	EndpointScopeMidjourney,
+	EndpointScopeSuno,
+}
+
+func RelayMode2EndpointScope(relayMode int) string {
+	switch relayMode {
+	case RelayModeChatCompletions, RelayModeCompletions, RelayModeEdits:
+		return EndpointScopeChat
+	case RelayModeEmbeddings:
+		return EndpointScopeEmbeddings
+	case RelayModeModerations:
+		return EndpointScopeModerations
+	case RelayModeImagesGenerations:
+		return EndpointScopeImages
+	case RelayModeAudioSpeech, RelayModeAudioTranscription, RelayModeAudioTranslation:
+		return EndpointScopeAudio
+	case RelayModeRerank:
+		return EndpointScopeRerank
+	case RelayModeSunoFetch, RelayModeSunoFetchByID, RelayModeSunoSubmit:
+		return EndpointScopeSuno
+	case RelayModeUnknown:
+		return ""
+	}
+	if relayMode >= RelayModeMidjourneyImagine && relayMode <= RelayModeMidjourneyUpload {
+		return EndpointScopeMidjourney
+	}
+	return ""
+}
+
+// Path2EndpointScope 根据请求路径判断所属的接口范围，无法识别时返回空字符串
+func Path2EndpointScope(method string, path string) string {
+	if strings.Contains(path, "/mj/") {
+		return RelayMode2EndpointScope(Path2RelayModeMidjourney(path))
+	}
+	if strings.Contains(path, "/suno/") {
+		return RelayMode2EndpointScope(Path2RelaySuno(method, path))
+	}
+	return RelayMode2EndpointScope(Path2RelayMode(path))
+}
+
+// CheckEndpointScopes 校验以逗号分隔的接口范围列表，空字符串表示不限制
+func CheckEndpointScopes(scopes string) error {
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		valid := false
+		for _, s := range EndpointScopes {
+			if s == scope {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("未知的接口范围 %s", scope)
+		}
+	}
+	return nil
+}
+
+// IsEndpointScopeAllowed 判断令牌的接口范围是否允许访问 scope，令牌未设置范围时不限制
+func IsEndpointScopeAllowed(scopes string, scope string) bool {
+	if strings.TrimSpace(scopes) == "" {
+		return true
+	}
+	if scope == "" {
+		return false
+	}
+	for _, s := range strings.Split(scopes, ",") {
+		if strings.TrimSpace(s) == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package constant
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPath2EndpointScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		scope  string
+	}{
+		{http.MethodPost, "/v1/chat/completions", EndpointScopeChat},
+		{http.MethodPost, "/v1/completions", EndpointScopeChat},
+		{http.MethodPost, "/v1/embeddings", EndpointScopeEmbeddings},
+		{http.MethodPost, "/v1/engines/text-embedding-ada-002/embeddings", EndpointScopeEmbeddings},
+		{http.MethodPost, "/v1/moderations", EndpointScopeModerations},
+		{http.MethodPost, "/v1/images/generations", EndpointScopeImages},
+		{http.MethodPost, "/v1/audio/speech", EndpointScopeAudio},
+		{http.MethodPost, "/v1/audio/transcriptions", EndpointScopeAudio},
+		{http.MethodPost, "/v1/rerank", EndpointScopeRerank},
+		{http.MethodPost, "/mj/submit/imagine", EndpointScopeMidjourney},
+		{http.MethodGet, "/mj/task/123/fetch", EndpointScopeMidjourney},
+		{http.MethodPost, "/suno/submit/music", EndpointScopeSuno},
+		{http.MethodGet, "/suno/fetch/123", EndpointScopeSuno},
+		{http.MethodGet, "/v1/models", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := Path2EndpointScope(tt.method, tt.path); got != tt.scope {
+				t.Errorf("Path2EndpointScope(%q, %q) = %q, want %q", tt.method, tt.path, got, tt.scope)
+			}
+		})
+	}
+}
+
+func TestIsEndpointScopeAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  string
+		scope   string
+		allowed bool
+	}{
+		{"no limit", "", EndpointScopeChat, true},
+		{"no limit unknown endpoint", " ", "", true},
+		{"in scopes", "chat,embeddings", EndpointScopeEmbeddings, true},
+		{"spaces around scope", " chat , images ", EndpointScopeImages, true},
+		{"not in scopes", "chat", EndpointScopeImages, false},
+		{"unknown endpoint with scopes", "chat", "", false},
+		{"prefix is not a match", "chatx", EndpointScopeChat, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEndpointScopeAllowed(tt.scopes, tt.scope); got != tt.allowed {
+				t.Errorf("IsEndpointScopeAllowed(%q, %q) = %v, want %v", tt.scopes, tt.scope, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestCheckEndpointScopes(t *testing.T) {
+	tests := []struct {
+		scopes  string
+		wantErr bool
+	}{
+		{"", false},
+		{"chat, embeddings,,", false},
+		{"chat,unknown", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scopes, func(t *testing.T) {
+			if err := CheckEndpointScopes(tt.scopes); (err != nil) != tt.wantErr {
+				t.Errorf("CheckEndpointScopes(%q) error = %v, wantErr %v", tt.scopes, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -70,21 +70,23 @@ func AudioHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	}
 
 	modelRatio := common.GetModelRatio(audioRequest.Model)
-	groupRatio := common.GetGroupRatio(relayInfo.Group)
-	ratio := modelRatio * groupRatio
+	groupRatio := common.GetGroupModelRatio(relayInfo.Group, audioRequest.Model)
+	windowRatio := relayInfo.SetPricingWindowRatio(audioRequest.Model)
+	ratio := modelRatio * groupRatio * windowRatio
 	preConsumedQuota := int(float64(preConsumedTokens) * ratio)
-	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId, relayInfo.OrgId)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota-preConsumedQuota < 0 {
 		return service.OpenAIErrorWrapperLocal(errors.New(fmt.Sprintf("audio pre-consumed quota failed, user quota: %d, need quota: %d", userQuota, preConsumedQuota)), "insufficient_user_quota", http.StatusBadRequest)
 	}
-	err = model.CacheDecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+	err = model.CacheDecreaseBillingQuota(relayInfo.UserId, relayInfo.OrgId, preConsumedQuota)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
-	if userQuota > 100*preConsumedQuota {
+	// 组织令牌总是预扣费，成员消费上限只在预扣时原子地校验
+	if relayInfo.OrgId == 0 && userQuota > 100*preConsumedQuota {
 		// in this case, we do not pre-consume quota
 		// because the user has enough quota
 		preConsumedQuota = 0
@@ -102,8 +102,9 @@ func ImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 		modelPrice = 0.0025 * modelRatio
 	}
 
-	groupRatio := common.GetGroupRatio(relayInfo.Group)
-	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	groupRatio := common.GetGroupModelRatio(relayInfo.Group, imageRequest.Model)
+	windowRatio := relayInfo.SetPricingWindowRatio(imageRequest.Model)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId, relayInfo.OrgId)
 
 	sizeRatio := 1.0
 	// Size
@@ -126,7 +127,7 @@ func ImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	}
 
 	imageRatio := modelPrice * sizeRatio * qualityRatio * float64(imageRequest.N)
-	quota := int(imageRatio * groupRatio * common.QuotaPerUnit)
+	quota := int(imageRatio * groupRatio * windowRatio * common.QuotaPerUnit)
 
 	if userQuota-quota < 0 {
 		return service.OpenAIErrorWrapperLocal(errors.New(fmt.Sprintf("image pre-consumed quota failed, user quota: %d, need quota: %d", userQuota, quota)), "insufficient_user_quota", http.StatusBadRequest)
@@ -151,6 +151,7 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 	startTime := time.Now().UnixNano() / int64(time.Millisecond)
 	tokenId := c.GetInt("token_id")
 	userId := c.GetInt("id")
+	orgId := c.GetInt("token_org_id")
 	group := c.GetString("group")
 	channelId := c.GetInt("channel_id")
 	var swapFaceRequest dto.SwapFaceRequest
@@ -172,9 +173,10 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 			modelPrice = defaultPrice
 		}
 	}
-	groupRatio := common.GetGroupRatio(group)
-	ratio := modelPrice * groupRatio
-	userQuota, err := model.CacheGetUserQuota(userId)
+	groupRatio := common.GetGroupModelRatio(group, modelName)
+	windowRatio := common.GetPricingWindowRatio(group, modelName, time.UnixMilli(startTime))
+	ratio := modelPrice * groupRatio * windowRatio
+	userQuota, err := model.GetBillingQuota(userId, orgId)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -202,7 +204,7 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
 			}
-			err = model.CacheUpdateUserQuota(userId)
+			err = model.CacheUpdateBillingQuota(userId, orgId)
 			if err != nil {
 				common.SysError("error update user quota cache: " + err.Error())
 			}
@@ -212,16 +214,22 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 				other := make(map[string]interface{})
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				if windowRatio != 1 {
+					logContent += fmt.Sprintf("，时段倍率 %.2f", windowRatio)
+					other["pricing_window_ratio"] = windowRatio
+				}
 				model.RecordConsumeLog(ctx, userId, channelId, 0, 0, modelName, tokenName, quota, logContent, tokenId, userQuota, 0, false, other)
-				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
+				model.UpdateBillingUsedQuotaAndRequestCount(userId, orgId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
+				model.RecordAnalyticsUsage(channelId, modelName, 0, 0, quota, 0)
 			}
 		}
-	}(c.Request.Context())
+	}(c)
 	midjResponse := &mjResp.Response
 	midjourneyTask := &model.Midjourney{
 		UserId:      userId,
+		OrgId:       orgId,
 		Code:        midjResponse.Code,
 		Action:      constant.MjActionSwapFace,
 		MjId:        midjResponse.Result,
@@ -357,10 +365,11 @@ func RelayMidjourneyTask(c *gin.Context, relayMode int) *dto.MidjourneyResponse
 }
 
 func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyResponse {
-
+	startTime := time.Now().UnixNano() / int64(time.Millisecond)
 	tokenId := c.GetInt("token_id")
 	//channelType := c.GetInt("channel")
 	userId := c.GetInt("id")
+	orgId := c.GetInt("token_org_id")
 	group := c.GetString("group")
 	channelId := c.GetInt("channel_id")
 	consumeQuota := true
@@ -476,9 +485,10 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 			modelPrice = defaultPrice
 		}
 	}
-	groupRatio := common.GetGroupRatio(group)
-	ratio := modelPrice * groupRatio
-	userQuota, err := model.CacheGetUserQuota(userId)
+	groupRatio := common.GetGroupModelRatio(group, modelName)
+	windowRatio := common.GetPricingWindowRatio(group, modelName, time.UnixMilli(startTime))
+	ratio := modelPrice * groupRatio * windowRatio
+	userQuota, err := model.GetBillingQuota(userId, orgId)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -506,7 +516,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
 			}
-			err = model.CacheUpdateUserQuota(userId)
+			err = model.CacheUpdateBillingQuota(userId, orgId)
 			if err != nil {
 				common.SysError("error update user quota cache: " + err.Error())
 			}
@@ -516,13 +526,18 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 				other := make(map[string]interface{})
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				if windowRatio != 1 {
+					logContent += fmt.Sprintf("，时段倍率 %.2f", windowRatio)
+					other["pricing_window_ratio"] = windowRatio
+				}
 				model.RecordConsumeLog(ctx, userId, channelId, 0, 0, modelName, tokenName, quota, logContent, tokenId, userQuota, 0, false, other)
-				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
+				model.UpdateBillingUsedQuotaAndRequestCount(userId, orgId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
+				model.RecordAnalyticsUsage(channelId, modelName, 0, 0, quota, 0)
 			}
 		}
-	}(c.Request.Context())
+	}(c)
 
 	// 文档：https://github.com/novicezk/midjourney-proxy/blob/main/docs/api.md
 	//1-提交成功
@@ -533,6 +548,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 	// other: 提交错误，description为错误描述
 	midjourneyTask := &model.Midjourney{
 		UserId:      userId,
+		OrgId:       orgId,
 		Code:        midjResponse.Code,
 		Action:      midjRequest.Action,
 		MjId:        midjResponse.Result,
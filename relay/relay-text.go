@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
@@ -99,7 +100,8 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	}
 
 	modelPrice, getModelPriceSuccess := common.GetModelPrice(textRequest.Model, false)
-	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	groupRatio := common.GetGroupModelRatio(relayInfo.Group, textRequest.Model)
+	windowRatio := relayInfo.SetPricingWindowRatio(textRequest.Model)
 
 	var preConsumedQuota int
 	var ratio float64
@@ -113,7 +115,9 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		}
 	}
 
+	_, endSpan := common.StartSpan(c, "token.count")
 	promptTokens, err := getPromptTokens(textRequest, relayInfo)
+	endSpan()
 	// count messages token error 计算promptTokens错误
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
@@ -125,10 +129,10 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 			preConsumedTokens = promptTokens + int(textRequest.MaxTokens)
 		}
 		modelRatio = common.GetModelRatio(textRequest.Model)
-		ratio = modelRatio * groupRatio
+		ratio = modelRatio * groupRatio * windowRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
-		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio * windowRatio)
 	}
 
 	// pre-consume quota 预消耗配额
@@ -166,11 +170,14 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	adaptor.Init(relayInfo)
 	var requestBody io.Reader
 
+	_, endSpan = common.StartSpan(c, "adaptor.convert", attribute.Int("api.type", relayInfo.ApiType))
 	convertedRequest, err := adaptor.ConvertRequest(c, relayInfo, textRequest)
 	if err != nil {
+		endSpan()
 		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 	jsonData, err := json.Marshal(convertedRequest)
+	endSpan()
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
 	}
@@ -193,7 +200,10 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		}
 	}
 
+	// 流式响应时该 span 覆盖整个流的持续时间
+	_, endSpan = common.StartSpan(c, "relay.response", attribute.Bool("stream", relayInfo.IsStream))
 	usage, openaiErr := adaptor.DoResponse(c, resp, relayInfo)
+	endSpan()
 	if openaiErr != nil {
 		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
 		// reset status code 重置状态码
@@ -250,7 +260,7 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
-	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId, relayInfo.OrgId)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -260,11 +270,12 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 	if userQuota-preConsumedQuota < 0 {
 		return 0, 0, service.OpenAIErrorWrapperLocal(errors.New(fmt.Sprintf("chat pre-consumed quota failed, user quota: %d, need quota: %d", userQuota, preConsumedQuota)), "insufficient_user_quota", http.StatusBadRequest)
 	}
-	err = model.CacheDecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+	err = model.CacheDecreaseBillingQuota(relayInfo.UserId, relayInfo.OrgId, preConsumedQuota)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
-	if userQuota > 100*preConsumedQuota {
+	// 组织令牌总是预扣费，成员消费上限只在预扣时原子地校验
+	if relayInfo.OrgId == 0 && userQuota > 100*preConsumedQuota {
 		// 用户额度充足，判断令牌额度是否充足
 		if !relayInfo.TokenUnlimited {
 			// 非无限令牌，判断令牌额度是否充足
@@ -313,7 +324,14 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelN
 		}
 		extraContent += "  ，（可能是请求出错）"
 	}
+	_, endSpan := common.StartSpan(ctx, "billing")
+	defer endSpan()
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
+	var firstTokenTime time.Duration
+	if relayInfo.IsStream && relayInfo.FirstResponseTime.After(relayInfo.StartTime) {
+		firstTokenTime = relayInfo.FirstResponseTime.Sub(relayInfo.StartTime)
+		common.RecordRelayFirstToken(relayInfo.OriginModelName, relayInfo.ChannelId, firstTokenTime)
+	}
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
 
@@ -328,7 +346,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelN
 			quota = 1
 		}
 	} else {
-		quota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+		quota = int(modelPrice * common.QuotaPerUnit * groupRatio * relayInfo.PricingWindowRatio)
 	}
 	totalTokens := promptTokens + completionTokens
 	var logContent string
@@ -337,6 +355,9 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelN
 	} else {
 		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", modelPrice, groupRatio)
 	}
+	if relayInfo.PricingWindowRatio != 1 {
+		logContent += fmt.Sprintf("，时段倍率 %.2f", relayInfo.PricingWindowRatio)
+	}
 
 	// record all the consume log even if quota is 0
 	if totalTokens == 0 {
@@ -357,12 +378,13 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelN
 				common.LogError(ctx, "error consuming token remain quota: "+err.Error())
 			}
 		}
-		err := model.CacheUpdateUserQuota(relayInfo.UserId)
+		err := model.CacheUpdateBillingQuota(relayInfo.UserId, relayInfo.OrgId)
 		if err != nil {
 			common.LogError(ctx, "error update user quota cache: "+err.Error())
 		}
-		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+		model.UpdateBillingUsedQuotaAndRequestCount(relayInfo.UserId, relayInfo.OrgId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.RecordAnalyticsUsage(relayInfo.ChannelId, relayInfo.OriginModelName, promptTokens, completionTokens, quota, firstTokenTime)
 	}
 
 	logModel := modelName
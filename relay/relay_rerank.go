@@ -60,7 +60,8 @@ func RerankHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 
 	relayInfo.UpstreamModelName = rerankRequest.Model
 	modelPrice, success := common.GetModelPrice(rerankRequest.Model, false)
-	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	groupRatio := common.GetGroupModelRatio(relayInfo.Group, rerankRequest.Model)
+	windowRatio := relayInfo.SetPricingWindowRatio(rerankRequest.Model)
 
 	var preConsumedQuota int
 	var ratio float64
@@ -70,10 +71,10 @@ func RerankHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 	if !success {
 		preConsumedTokens := promptToken
 		modelRatio = common.GetModelRatio(rerankRequest.Model)
-		ratio = modelRatio * groupRatio
+		ratio = modelRatio * groupRatio * windowRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
-		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio * windowRatio)
 	}
 	relayInfo.PromptTokens = promptToken
 
@@ -52,9 +52,10 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	}
 
 	// 预扣
-	groupRatio := common.GetGroupRatio(relayInfo.Group)
-	ratio := modelPrice * groupRatio
-	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	groupRatio := common.GetGroupModelRatio(relayInfo.Group, modelName)
+	windowRatio := common.GetPricingWindowRatio(relayInfo.Group, modelName, relayInfo.StartTime)
+	ratio := modelPrice * groupRatio * windowRatio
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId, relayInfo.OrgId)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
@@ -119,7 +120,7 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
 			}
-			err = model.CacheUpdateUserQuota(relayInfo.UserId)
+			err = model.CacheUpdateBillingQuota(relayInfo.UserId, relayInfo.OrgId)
 			if err != nil {
 				common.SysError("error update user quota cache: " + err.Error())
 			}
@@ -129,12 +130,17 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 				other := make(map[string]interface{})
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				if windowRatio != 1 {
+					logContent += fmt.Sprintf("，时段倍率 %.2f", windowRatio)
+					other["pricing_window_ratio"] = windowRatio
+				}
 				model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, 0, 0, modelName, tokenName, quota, logContent, relayInfo.TokenId, userQuota, 0, false, other)
-				model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+				model.UpdateBillingUsedQuotaAndRequestCount(relayInfo.UserId, relayInfo.OrgId, quota)
 				model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+				model.RecordAnalyticsUsage(relayInfo.ChannelId, modelName, 0, 0, quota, 0)
 			}
 		}
-	}(c.Request.Context())
+	}(c)
 
 	taskID, taskData, taskErr := adaptor.DoResponse(c, resp, relayInfo)
 	if taskErr != nil {
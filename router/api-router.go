@@ -1,6 +1,7 @@
 package router
 
 import (
+	"one-api/common"
 	"one-api/controller"
 	"one-api/middleware"
 
@@ -12,10 +13,11 @@ func SetApiRouter(router *gin.Engine) {
 	apiRouter := router.Group("/api")
 	apiRouter.Use(gzip.Gzip(gzip.DefaultCompression))
 	apiRouter.Use(middleware.GlobalAPIRateLimit())
+	apiRouter.Use(middleware.AuditLog())
 	{
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(common.PermissionChannelRead), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/about", controller.GetAbout)
 		apiRouter.GET("/midjourney", controller.GetMidjourney)
@@ -32,6 +34,8 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
 		apiRouter.GET("/oauth/telegram/login", middleware.CriticalRateLimit(), controller.TelegramLogin)
 		apiRouter.GET("/oauth/telegram/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.TelegramBind)
+		apiRouter.GET("/oauth/oidc/:provider/authorize", middleware.CriticalRateLimit(), controller.OIDCAuthorize)
+		apiRouter.GET("/oauth/oidc/:provider", middleware.CriticalRateLimit(), controller.OIDCOAuth)
 
 		apiRouter.POST("/stripe/webhook", controller.StripeWebhook)
 
@@ -39,6 +43,7 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.LoginTwoFactor)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
 			userRoute.GET("/logout", controller.Logout)
 
@@ -46,19 +51,40 @@ func SetApiRouter(router *gin.Engine) {
 			selfRoute.Use(middleware.UserAuth())
 			{
 				selfRoute.GET("/self", controller.GetSelf)
+				selfRoute.GET("/permissions", controller.GetSelfPermissions)
 				selfRoute.GET("/models", controller.GetUserModels)
-				selfRoute.PUT("/self", controller.UpdateSelf)
-				selfRoute.DELETE("/self", controller.DeleteSelf)
-				selfRoute.GET("/token", controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", middleware.CriticalRateLimit(), controller.TopUp)
 				selfRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestPayLink)
 				selfRoute.POST("/amount", controller.RequestAmount)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
+				selfRoute.GET("/alert", controller.GetQuotaAlerts)
+				selfRoute.POST("/alert", controller.AddQuotaAlert)
+				selfRoute.PUT("/alert", controller.UpdateQuotaAlert)
+				selfRoute.DELETE("/alert/:id", controller.DeleteQuotaAlert)
+				selfRoute.GET("/identity", controller.GetUserIdentities)
+				selfRoute.GET("/2fa", controller.GetTwoFactorStatus)
+			}
+
+			// 修改账户与登录凭据的接口，个人访问令牌需要 account 作用域
+			accountRoute := userRoute.Group("/")
+			accountRoute.Use(middleware.AccountAuth())
+			{
+				accountRoute.PUT("/self", controller.UpdateSelf)
+				accountRoute.DELETE("/self", controller.DeleteSelf)
+				accountRoute.GET("/token", controller.GenerateAccessToken)
+				accountRoute.GET("/access_token", controller.GetPersonalAccessTokens)
+				accountRoute.POST("/access_token", controller.AddPersonalAccessToken)
+				accountRoute.DELETE("/access_token/:id", controller.RevokePersonalAccessToken)
+				accountRoute.DELETE("/identity/:id", controller.DeleteUserIdentity)
+				accountRoute.POST("/2fa/setup", controller.SetupTwoFactor)
+				accountRoute.POST("/2fa/enable", middleware.CriticalRateLimit(), controller.EnableTwoFactor)
+				accountRoute.POST("/2fa/disable", middleware.CriticalRateLimit(), controller.DisableTwoFactor)
+				accountRoute.POST("/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.RegenerateRecoveryCodes)
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminRoute.Use(middleware.PermissionAuth(common.PermissionUserManage))
 			{
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
@@ -68,34 +94,34 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.HardDeleteUser)
 			}
+			userRoute.POST("/permission_roles", middleware.PermissionAuth(common.PermissionRoleManage), controller.SetUserPermissionRoles)
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
+		optionRoute.Use(middleware.PermissionAuth(common.PermissionOptionsWrite))
 		{
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 		}
+		apiRouter.GET("/permission", middleware.PermissionAuth(common.PermissionRoleManage), controller.GetPermissions)
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
-		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-
-		}
+		channelRoute.GET("/", middleware.PermissionAuth(common.PermissionChannelRead), controller.GetAllChannels)
+		channelRoute.GET("/search", middleware.PermissionAuth(common.PermissionChannelRead), controller.SearchChannels)
+		channelRoute.GET("/models", middleware.PermissionAuth(common.PermissionChannelRead), controller.ChannelListModels)
+		channelRoute.GET("/:id", middleware.PermissionAuth(common.PermissionChannelRead), controller.GetChannel)
+		channelRoute.GET("/:id/key", middleware.PermissionAuth(common.PermissionChannelWrite), controller.GetChannelKey)
+		channelRoute.GET("/test", middleware.PermissionAuth(common.PermissionChannelTest), controller.TestAllChannels)
+		channelRoute.GET("/test/:id", middleware.PermissionAuth(common.PermissionChannelTest), controller.TestChannel)
+		channelRoute.GET("/update_balance", middleware.PermissionAuth(common.PermissionChannelWrite), controller.UpdateAllChannelsBalance)
+		channelRoute.GET("/update_balance/:id", middleware.PermissionAuth(common.PermissionChannelWrite), controller.UpdateChannelBalance)
+		channelRoute.POST("/", middleware.PermissionAuth(common.PermissionChannelWrite), controller.AddChannel)
+		channelRoute.PUT("/", middleware.PermissionAuth(common.PermissionChannelWrite), controller.UpdateChannel)
+		channelRoute.DELETE("/disabled", middleware.PermissionAuth(common.PermissionChannelWrite), controller.DeleteDisabledChannel)
+		channelRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionChannelWrite), controller.DeleteChannel)
+		channelRoute.POST("/batch", middleware.PermissionAuth(common.PermissionChannelWrite), controller.DeleteChannelBatch)
+		channelRoute.POST("/fix", middleware.PermissionAuth(common.PermissionChannelWrite), controller.FixChannelsAbilities)
+		channelRoute.POST("/reencrypt", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.ReencryptChannelKeys)
+		channelRoute.GET("/fetch_models/:id", middleware.PermissionAuth(common.PermissionChannelRead), controller.FetchUpstreamModels)
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
 		{
@@ -106,8 +132,26 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.GET("/", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetAllOrganizations)
+		organizationRoute.PUT("/", middleware.PermissionAuth(common.PermissionBillingManage), controller.UpdateOrganization)
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/self", controller.GetSelfOrganizations)
+			organizationRoute.POST("/", controller.AddOrganization)
+			organizationRoute.GET("/:id", controller.GetOrganization)
+			organizationRoute.PUT("/:id", controller.RenameOrganization)
+			organizationRoute.DELETE("/:id", controller.DeleteOrganization)
+			organizationRoute.GET("/:id/member", controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/member", controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/member", controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/member/:user_id", controller.DeleteOrganizationMember)
+			organizationRoute.POST("/:id/transfer", controller.TransferOrganizationQuota)
+			organizationRoute.GET("/:id/log", controller.GetOrganizationLogs)
+			organizationRoute.GET("/:id/data", controller.GetOrganizationQuotaDates)
+		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
+		redemptionRoute.Use(middleware.PermissionAuth(common.PermissionBillingManage))
 		{
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
@@ -115,19 +159,35 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.POST("/", controller.AddRedemption)
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/campaign/", controller.GetAllRedemptionCampaigns)
+			redemptionRoute.GET("/campaign/:id", controller.GetRedemptionCampaign)
+			redemptionRoute.GET("/campaign/:id/stat", controller.GetRedemptionCampaignStat)
+			redemptionRoute.GET("/campaign/:id/export", controller.ExportRedemptionCampaign)
+			redemptionRoute.POST("/campaign/", controller.AddRedemptionCampaign)
+			redemptionRoute.DELETE("/campaign/:id", controller.DeleteRedemptionCampaign)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(common.PermissionLogsWrite), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", middleware.PermissionAuth(common.PermissionLogsRead), controller.SearchAllLogs)
+		logRoute.GET("/request/:request_id", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetRequestTimeline)
+		logRoute.GET("/archive", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogArchives)
+		logRoute.POST("/archive/restore", middleware.PermissionAuth(common.PermissionLogsWrite), controller.RestoreLogArchives)
+		logRoute.GET("/export", middleware.PermissionAuth(common.PermissionLogsRead), controller.ExportAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
+		logRoute.GET("/self/export", middleware.UserAuth(), controller.ExportUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		apiRouter.GET("/audit_log", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAuditLogs)
+		apiRouter.GET("/capture/:request_id", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetCapture)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllQuotaDates)
+		dataRoute.GET("/export", middleware.PermissionAuth(common.PermissionLogsRead), controller.ExportAllQuotaData)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/self/export", middleware.UserAuth(), controller.ExportUserQuotaData)
+		apiRouter.GET("/analytics", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAnalytics)
 
 		logRoute.Use(middleware.CORS())
 		{
@@ -135,18 +195,18 @@ func SetApiRouter(router *gin.Engine) {
 
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(common.PermissionChannelRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllTask)
 		}
 	}
 }
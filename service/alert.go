@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// AlertEvent 推送给告警目标的事件，webhook 类型直接以 JSON 推送该结构
+type AlertEvent struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Message   string         `json:"message"`
+	Fields    map[string]any `json:"fields,omitempty"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+var (
+	alertDedupe     = make(map[string]int64) // 事件类型与对象 -> 上次推送时间
+	alertRateLimits = make(map[string]*alertRateWindow)
+	alertLock       sync.Mutex
+)
+
+type alertRateWindow struct {
+	start int64
+	count int
+}
+
+// SendAlert 将事件异步推送给订阅了该事件的目标，subject 标识事件对象（如渠道 id），用于去重
+func SendAlert(eventType string, subject string, title string, message string, fields map[string]any) {
+	config := common.GetAlertConfig()
+	if len(config.Sinks) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	alertLock.Lock()
+	dedupeKey := eventType + ":" + subject
+	if last, ok := alertDedupe[dedupeKey]; ok && now-last < int64(config.DedupeSeconds) {
+		alertLock.Unlock()
+		return
+	}
+	alertDedupe[dedupeKey] = now
+	// 清理过期的去重记录
+	if len(alertDedupe) > 1000 {
+		for key, last := range alertDedupe {
+			if now-last >= int64(config.DedupeSeconds) {
+				delete(alertDedupe, key)
+			}
+		}
+	}
+	sinks := make([]*common.AlertSink, 0, len(config.Sinks))
+	for _, sink := range config.Sinks {
+		if !sink.Subscribed(eventType) {
+			continue
+		}
+		window, ok := alertRateLimits[sink.Name]
+		if !ok || now-window.start >= 60 {
+			window = &alertRateWindow{start: now}
+			alertRateLimits[sink.Name] = window
+		}
+		if window.count >= config.RateLimitPerMinute {
+			common.SysError(fmt.Sprintf("alert sink %s rate limited, drop event %s", sink.Name, dedupeKey))
+			continue
+		}
+		window.count++
+		sinks = append(sinks, sink)
+	}
+	alertLock.Unlock()
+
+	event := &AlertEvent{
+		Type:      eventType,
+		Title:     title,
+		Message:   message,
+		Fields:    fields,
+		Timestamp: now,
+	}
+	for _, sink := range sinks {
+		sink := sink
+		gopool.Go(func() {
+			err := sendAlert(sink, event)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to send alert to %s: %s", sink.Name, err.Error()))
+			}
+		})
+	}
+}
+
+func sendAlert(sink *common.AlertSink, event *AlertEvent) error {
+	text := fmt.Sprintf("[%s] %s\n%s", common.SystemName, event.Title, event.Message)
+	header := http.Header{}
+	targetUrl := sink.Url
+	var body any
+	switch sink.Type {
+	case common.AlertSinkTypeWebhook:
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		header.Set("X-Timestamp", strconv.FormatInt(event.Timestamp, 10))
+		if sink.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(sink.Secret))
+			mac.Write(data)
+			header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		return postAlert(targetUrl, header, data)
+	case common.AlertSinkTypeSlack:
+		body = map[string]any{"text": text}
+	case common.AlertSinkTypeFeishu:
+		payload := map[string]any{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		}
+		// https://open.feishu.cn/document/client-docs/bot-v3/add-custom-bot
+		if sink.Secret != "" {
+			timestamp := strconv.FormatInt(event.Timestamp, 10)
+			mac := hmac.New(sha256.New, []byte(timestamp+"\n"+sink.Secret))
+			payload["timestamp"] = timestamp
+			payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		body = payload
+	case common.AlertSinkTypeDingTalk:
+		body = map[string]any{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		}
+		// https://open.dingtalk.com/document/robots/customize-robot-security-settings
+		if sink.Secret != "" {
+			timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			mac := hmac.New(sha256.New, []byte(sink.Secret))
+			mac.Write([]byte(timestamp + "\n" + sink.Secret))
+			u, err := url.Parse(targetUrl)
+			if err != nil {
+				return err
+			}
+			query := u.Query()
+			query.Set("timestamp", timestamp)
+			query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			u.RawQuery = query.Encode()
+			targetUrl = u.String()
+		}
+	default:
+		return errors.New("不支持的告警推送方式: " + sink.Type)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return postAlert(targetUrl, header, data)
+}
+
+func postAlert(targetUrl string, header http.Header, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, targetUrl, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态码 %d", resp.StatusCode)
+	}
+	// 飞书与钉钉在 HTTP 200 的响应中以 code / errcode 返回错误
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var result struct {
+		Code    int    `json:"code"`
+		Msg     string `json:"msg"`
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if json.Unmarshal(respBody, &result) == nil {
+		if result.Code != 0 {
+			return fmt.Errorf("返回错误 %d: %s", result.Code, result.Msg)
+		}
+		if result.ErrCode != 0 {
+			return fmt.Errorf("返回错误 %d: %s", result.ErrCode, result.ErrMsg)
+		}
+	}
+	return nil
+}
+
+var (
+	channelTestFailures     = make(map[int]int)
+	channelTestFailuresLock sync.Mutex
+)
+
+// RecordChannelTestResult 记录渠道测试结果，连续失败达到阈值时告警
+func RecordChannelTestResult(channelId int, channelName string, err error) {
+	channelTestFailuresLock.Lock()
+	if err == nil {
+		delete(channelTestFailures, channelId)
+		channelTestFailuresLock.Unlock()
+		return
+	}
+	channelTestFailures[channelId]++
+	failures := channelTestFailures[channelId]
+	channelTestFailuresLock.Unlock()
+	if failures < common.GetAlertConfig().TestFailureThreshold {
+		return
+	}
+	SendAlert(common.AlertEventChannelTestFailed, strconv.Itoa(channelId),
+		fmt.Sprintf("通道「%s」（#%d）连续测试失败", channelName, channelId),
+		fmt.Sprintf("通道「%s」（#%d）已连续 %d 次测试失败，最近一次错误：%s", channelName, channelId, failures, err.Error()),
+		map[string]any{"channel_id": channelId, "channel_name": channelName, "failures": failures, "error": err.Error()})
+}
+
+// CheckChannelBalance 渠道余额低于阈值时告警
+func CheckChannelBalance(channelId int, channelName string, balance float64) {
+	threshold := common.GetAlertConfig().BalanceThreshold
+	if threshold <= 0 || balance >= threshold {
+		return
+	}
+	SendAlert(common.AlertEventChannelLowBalance, strconv.Itoa(channelId),
+		fmt.Sprintf("通道「%s」（#%d）余额不足", channelName, channelId),
+		fmt.Sprintf("通道「%s」（#%d）余额为 $%.2f，已低于告警阈值 $%.2f", channelName, channelId, balance, threshold),
+		map[string]any{"channel_id": channelId, "channel_name": channelName, "balance": balance, "threshold": threshold})
+}
+
+type channelErrorRateWindow struct {
+	start  int64
+	total  int
+	failed int
+}
+
+var (
+	channelErrorRates     = make(map[int]*channelErrorRateWindow)
+	channelErrorRatesLock sync.Mutex
+)
+
+// RecordChannelRelayResult 按固定时间窗口统计渠道的错误率，超过阈值时告警
+func RecordChannelRelayResult(channelId int, channelName string, failed bool) {
+	config := common.GetAlertConfig()
+	if len(config.Sinks) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	channelErrorRatesLock.Lock()
+	window, ok := channelErrorRates[channelId]
+	if !ok || now-window.start >= int64(config.ErrorRateWindowSeconds) {
+		window = &channelErrorRateWindow{start: now}
+		channelErrorRates[channelId] = window
+	}
+	window.total++
+	if failed {
+		window.failed++
+	}
+	total, failedCount := window.total, window.failed
+	channelErrorRatesLock.Unlock()
+	if !failed || total < config.ErrorRateMinRequests {
+		return
+	}
+	rate := float64(failedCount) / float64(total)
+	if rate < config.ErrorRateThreshold {
+		return
+	}
+	SendAlert(common.AlertEventErrorRateSpike, strconv.Itoa(channelId),
+		fmt.Sprintf("通道「%s」（#%d）错误率过高", channelName, channelId),
+		fmt.Sprintf("通道「%s」（#%d）最近 %d 个请求中有 %d 个失败，错误率 %.1f%%", channelName, channelId, total, failedCount, rate*100),
+		map[string]any{"channel_id": channelId, "channel_name": channelName, "total": total, "failed": failedCount, "error_rate": rate})
+}
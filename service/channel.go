@@ -6,15 +6,19 @@ import (
 	"one-api/common"
 	relaymodel "one-api/dto"
 	"one-api/model"
+	"strconv"
 	"strings"
 )
 
 // disable & notify
 func DisableChannel(channelId int, channelName string, reason string) {
 	model.UpdateChannelStatusById(channelId, common.ChannelStatusAutoDisabled, reason)
+	common.RecordChannelAutoDisabled(channelId)
 	subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelName, channelId)
 	content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelName, channelId, reason)
 	notifyRootUser(subject, content)
+	SendAlert(common.AlertEventChannelDisabled, strconv.Itoa(channelId), subject, content,
+		map[string]any{"channel_id": channelId, "channel_name": channelName, "reason": reason})
 }
 
 func EnableChannel(channelId int, channelName string) {
@@ -22,6 +26,8 @@ func EnableChannel(channelId int, channelName string) {
 	subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 	content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 	notifyRootUser(subject, content)
+	SendAlert(common.AlertEventChannelEnabled, strconv.Itoa(channelId), subject, content,
+		map[string]any{"channel_id": channelId, "channel_name": channelName})
 }
 
 func ShouldDisableChannel(channelType int, err *relaymodel.OpenAIErrorWithStatusCode) bool {
@@ -0,0 +1,471 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type OIDCDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IdToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type oidcJWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OIDCAuthRequest 发起授权时生成，需要保存在会话中供回调校验
+type OIDCAuthRequest struct {
+	URL          string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// OIDCIdentity 回调校验通过后从 ID Token（以及 userinfo）中提取的用户信息
+type OIDCIdentity struct {
+	Subject     string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+type oidcProviderCache struct {
+	issuer    string
+	discovery *OIDCDiscovery
+	keys      map[string]interface{}
+	keysTime  time.Time
+}
+
+const oidcCacheTTL = time.Hour
+
+// JWKS 刷新的最小间隔，防止伪造 kid 的请求频繁打到提供方
+const oidcJWKSRefreshInterval = time.Minute
+
+var oidcCaches = make(map[string]*oidcProviderCache)
+var oidcCachesLock sync.Mutex
+
+var oidcHttpClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func getOIDCCache(provider *common.OIDCProvider) *oidcProviderCache {
+	oidcCachesLock.Lock()
+	defer oidcCachesLock.Unlock()
+	cache, ok := oidcCaches[provider.Slug]
+	if !ok || cache.issuer != provider.Issuer {
+		cache = &oidcProviderCache{issuer: provider.Issuer}
+		oidcCaches[provider.Slug] = cache
+	}
+	return cache
+}
+
+func oidcGetJSON(rawURL string, bearer string, v interface{}) error {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	res, err := oidcHttpClient.Do(req)
+	if err != nil {
+		common.SysLog(err.Error())
+		return errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("OIDC 服务器返回状态码 %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// GetOIDCDiscovery 获取并缓存提供方的发现文档
+func GetOIDCDiscovery(provider *common.OIDCProvider) (*OIDCDiscovery, error) {
+	cache := getOIDCCache(provider)
+	oidcCachesLock.Lock()
+	discovery := cache.discovery
+	oidcCachesLock.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+	discovery = &OIDCDiscovery{}
+	err := oidcGetJSON(strings.TrimRight(provider.Issuer, "/")+"/.well-known/openid-configuration", "", discovery)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != provider.Issuer {
+		return nil, fmt.Errorf("发现文档中的 issuer %s 与配置不一致", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, errors.New("OIDC 发现文档缺少必要的端点")
+	}
+	oidcCachesLock.Lock()
+	cache.discovery = discovery
+	oidcCachesLock.Unlock()
+	time.AfterFunc(oidcCacheTTL, func() {
+		oidcCachesLock.Lock()
+		if cache.discovery == discovery {
+			cache.discovery = nil
+		}
+		oidcCachesLock.Unlock()
+	})
+	return discovery, nil
+}
+
+func oidcRandomString() string {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return common.GetRandomString(43)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// BuildOIDCAuthRequest 生成带 state、nonce 与 PKCE (S256) 的授权地址
+func BuildOIDCAuthRequest(provider *common.OIDCProvider) (*OIDCAuthRequest, error) {
+	discovery, err := GetOIDCDiscovery(provider)
+	if err != nil {
+		return nil, err
+	}
+	authRequest := &OIDCAuthRequest{
+		State:        oidcRandomString(),
+		Nonce:        oidcRandomString(),
+		CodeVerifier: oidcRandomString(),
+	}
+	challenge := sha256.Sum256([]byte(authRequest.CodeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientId},
+		"redirect_uri":          {provider.GetRedirectURL()},
+		"scope":                 {strings.Join(provider.GetScopes(), " ")},
+		"state":                 {authRequest.State},
+		"nonce":                 {authRequest.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	authRequest.URL = discovery.AuthorizationEndpoint + separator + query.Encode()
+	return authRequest, nil
+}
+
+// ExchangeOIDCCode 用授权码换取令牌并校验 ID Token，返回映射后的用户信息
+func ExchangeOIDCCode(provider *common.OIDCProvider, code string, codeVerifier string, nonce string) (*OIDCIdentity, error) {
+	if code == "" {
+		return nil, errors.New("无效的参数")
+	}
+	discovery, err := GetOIDCDiscovery(provider)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.GetRedirectURL()},
+		"code_verifier": {codeVerifier},
+	}
+	useBasicAuth := provider.ClientSecret != "" && (len(discovery.TokenEndpointAuthMethodsSupported) == 0 ||
+		common.StringsContains(discovery.TokenEndpointAuthMethodsSupported, "client_secret_basic"))
+	if !useBasicAuth {
+		form.Set("client_id", provider.ClientId)
+		if provider.ClientSecret != "" {
+			form.Set("client_secret", provider.ClientSecret)
+		}
+	}
+	req, err := http.NewRequest("POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasicAuth {
+		req.SetBasicAuth(url.QueryEscape(provider.ClientId), url.QueryEscape(provider.ClientSecret))
+	}
+	res, err := oidcHttpClient.Do(req)
+	if err != nil {
+		common.SysLog(err.Error())
+		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+	}
+	defer res.Body.Close()
+	var tokenResponse oidcTokenResponse
+	err = json.NewDecoder(res.Body).Decode(&tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResponse.Error != "" {
+		return nil, fmt.Errorf("OIDC 授权失败: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IdToken == "" {
+		return nil, errors.New("OIDC 服务器未返回 id_token")
+	}
+	claims, err := verifyOIDCIdToken(provider, discovery, tokenResponse.IdToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	// ID Token 中缺少的声明从 userinfo 补全
+	if discovery.UserinfoEndpoint != "" && tokenResponse.AccessToken != "" {
+		userinfo := make(map[string]interface{})
+		err = oidcGetJSON(discovery.UserinfoEndpoint, tokenResponse.AccessToken, &userinfo)
+		if err != nil {
+			common.SysError("failed to fetch oidc userinfo: " + err.Error())
+		} else if userinfo["sub"] == claims["sub"] {
+			for k, v := range userinfo {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+	return buildOIDCIdentity(provider, claims)
+}
+
+func verifyOIDCIdToken(provider *common.OIDCProvider, discovery *OIDCDiscovery, idToken string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+			kid, _ := token.Header["kid"].(string)
+			return getOIDCSigningKey(provider, discovery, kid)
+		case *jwt.SigningMethodHMAC:
+			if provider.ClientSecret == "" {
+				return nil, errors.New("未配置 Client Secret，无法校验 HMAC 签名")
+			}
+			return []byte(provider.ClientSecret), nil
+		}
+		return nil, fmt.Errorf("不支持的签名算法 %v", token.Header["alg"])
+	})
+	if err != nil {
+		return nil, fmt.Errorf("id_token 校验失败: %s", err.Error())
+	}
+	if iss, _ := claims["iss"].(string); iss != discovery.Issuer {
+		return nil, errors.New("id_token 的 issuer 不匹配")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id_token 缺少过期时间")
+	}
+	audiences := make([]string, 0)
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = append(audiences, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	if !common.StringsContains(audiences, provider.ClientId) {
+		return nil, errors.New("id_token 的 audience 不匹配")
+	}
+	if len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != provider.ClientId {
+			return nil, errors.New("id_token 的 azp 不匹配")
+		}
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, errors.New("id_token 的 nonce 不匹配")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("id_token 缺少 sub")
+	}
+	return claims, nil
+}
+
+func getOIDCSigningKey(provider *common.OIDCProvider, discovery *OIDCDiscovery, kid string) (interface{}, error) {
+	cache := getOIDCCache(provider)
+	oidcCachesLock.Lock()
+	keys := cache.keys
+	stale := time.Since(cache.keysTime) > oidcCacheTTL
+	canRefresh := time.Since(cache.keysTime) > oidcJWKSRefreshInterval
+	oidcCachesLock.Unlock()
+	if key := findOIDCSigningKey(keys, kid); key != nil && !stale {
+		return key, nil
+	}
+	if keys != nil && !canRefresh {
+		return nil, errors.New("未找到匹配的签名密钥")
+	}
+	var jwks struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	err := oidcGetJSON(discovery.JwksURI, "", &jwks)
+	if err != nil {
+		return nil, err
+	}
+	keys = make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseOIDCJWK(jwk)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to parse jwk %s of oidc provider %s: %s", jwk.Kid, provider.Slug, err.Error()))
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	oidcCachesLock.Lock()
+	cache.keys = keys
+	cache.keysTime = time.Now()
+	oidcCachesLock.Unlock()
+	if key := findOIDCSigningKey(keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, errors.New("未找到匹配的签名密钥")
+}
+
+func findOIDCSigningKey(keys map[string]interface{}, kid string) interface{} {
+	if key, ok := keys[kid]; ok {
+		return key
+	}
+	// 未指定 kid 且提供方只有一把密钥时直接使用
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func parseOIDCJWK(jwk oidcJWK) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+// lookupOIDCClaim 支持以点号访问嵌套声明，例如 realm_access.roles
+func lookupOIDCClaim(claims map[string]interface{}, path string) interface{} {
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+func oidcClaimString(claims map[string]interface{}, path string) string {
+	switch v := lookupOIDCClaim(claims, path).(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+func oidcClaimStrings(claims map[string]interface{}, path string) []string {
+	values := make([]string, 0)
+	switch v := lookupOIDCClaim(claims, path).(type) {
+	case string:
+		for _, s := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			values = append(values, s)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func buildOIDCIdentity(provider *common.OIDCProvider, claims jwt.MapClaims) (*OIDCIdentity, error) {
+	identity := &OIDCIdentity{
+		Subject:     oidcClaimString(claims, "sub"),
+		Username:    oidcClaimString(claims, provider.GetUsernameClaim()),
+		Email:       oidcClaimString(claims, provider.GetEmailClaim()),
+		DisplayName: oidcClaimString(claims, provider.GetDisplayNameClaim()),
+	}
+	// 提供方明确声明邮箱未验证时不采用
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		identity.Email = ""
+	}
+	if provider.GroupClaim != "" {
+		identity.Groups = oidcClaimStrings(claims, provider.GroupClaim)
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("返回值非法，用户字段为空，请稍后重试！")
+	}
+	return identity, nil
+}
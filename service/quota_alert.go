@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+type quotaAlertPayload struct {
+	Type      string  `json:"type"`
+	UserId    int     `json:"user_id"`
+	TokenId   int     `json:"token_id,omitempty"`
+	Threshold float64 `json:"threshold"`
+	Value     float64 `json:"value"`
+	Message   string  `json:"message"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// CheckQuotaAlertsAsync 在扣费后异步检查用户配置的额度提醒，不阻塞请求，由 model.QuotaConsumedHook 调用
+func CheckQuotaAlertsAsync(userId int, tokenId int) {
+	gopool.Go(func() {
+		checkQuotaAlerts(userId, tokenId)
+	})
+}
+
+func checkQuotaAlerts(userId int, tokenId int) {
+	alerts, err := model.GetEnabledUserQuotaAlerts(userId)
+	if err != nil {
+		common.SysError("failed to get quota alerts: " + err.Error())
+		return
+	}
+	if len(alerts) == 0 {
+		return
+	}
+	var userQuota int
+	var userQuotaLoaded bool
+	var token *model.Token
+	for _, alert := range alerts {
+		var value float64
+		var message string
+		switch alert.Type {
+		case model.QuotaAlertTypeBalance:
+			if !userQuotaLoaded {
+				userQuota, err = model.GetUserQuota(userId)
+				if err != nil {
+					common.SysError("failed to get user quota: " + err.Error())
+					return
+				}
+				userQuotaLoaded = true
+			}
+			value = float64(userQuota)
+			if value >= alert.Threshold {
+				if alert.Triggered {
+					model.RearmQuotaAlert(alert.Id)
+				}
+				continue
+			}
+			message = fmt.Sprintf("您的剩余额度为 %s，已低于提醒阈值 %s", common.LogQuota(userQuota), common.LogQuota(int(alert.Threshold)))
+		case model.QuotaAlertTypeTokenBudget:
+			if alert.TokenId != tokenId {
+				continue
+			}
+			if token == nil {
+				token, err = model.GetTokenById(tokenId)
+				if err != nil {
+					common.SysError("failed to get token: " + err.Error())
+					return
+				}
+			}
+			budget := token.UsedQuota + token.RemainQuota
+			if token.UnlimitedQuota || budget <= 0 {
+				continue
+			}
+			value = float64(token.UsedQuota) * 100 / float64(budget)
+			if value < alert.Threshold {
+				if alert.Triggered {
+					model.RearmQuotaAlert(alert.Id)
+				}
+				continue
+			}
+			message = fmt.Sprintf("您的令牌 %s 已使用 %.1f%% 的额度，已达到提醒阈值 %.0f%%", token.Name, value, alert.Threshold)
+		default:
+			continue
+		}
+		if alert.Triggered || !model.ClaimQuotaAlert(alert.Id) {
+			continue
+		}
+		payload := quotaAlertPayload{
+			Type:      alert.Type,
+			UserId:    userId,
+			TokenId:   alert.TokenId,
+			Threshold: alert.Threshold,
+			Value:     value,
+			Message:   message,
+			Timestamp: common.GetTimestamp(),
+		}
+		err = sendQuotaAlert(alert, payload)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to send quota alert #%d: %s", alert.Id, err.Error()))
+		}
+	}
+}
+
+func sendQuotaAlert(alert *model.QuotaAlert, payload quotaAlertPayload) error {
+	switch alert.Channel {
+	case model.QuotaAlertChannelEmail:
+		email, err := model.GetUserEmail(payload.UserId)
+		if err != nil {
+			return err
+		}
+		if email == "" {
+			return errors.New("用户未绑定邮箱")
+		}
+		topUpLink := fmt.Sprintf("%s/topup", common.ServerAddress)
+		return common.SendEmail(fmt.Sprintf("%s 额度提醒", common.SystemName), email,
+			fmt.Sprintf("%s。<br/>充值链接：<a href='%s'>%s</a>", payload.Message, topUpLink, topUpLink))
+	case model.QuotaAlertChannelWebhook:
+		return sendQuotaAlertWebhook(alert.WebhookUrl, alert.WebhookSecret, payload)
+	case model.QuotaAlertChannelTelegram:
+		telegramId, err := model.GetUserTelegramId(payload.UserId)
+		if err != nil {
+			return err
+		}
+		return SendTelegramMessage(telegramId, payload.Message)
+	}
+	return errors.New("不支持的提醒方式: " + alert.Channel)
+}
+
+// sendQuotaAlertWebhook 以 JSON 推送提醒，设置了密钥时在 X-Signature 头中携带请求体的 HMAC-SHA256 签名
+// Webhook 地址由用户填写，只允许连接公网地址
+func sendQuotaAlertWebhook(webhookUrl string, secret string, payload quotaAlertPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Timestamp", strconv.FormatInt(payload.Timestamp, 10))
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := common.GetPublicHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SendTelegramMessage 通过管理员配置的 Telegram 机器人向用户发送消息
+func SendTelegramMessage(chatId string, text string) error {
+	if common.TelegramBotToken == "" {
+		return errors.New("未配置 Telegram 机器人")
+	}
+	if chatId == "" {
+		return errors.New("用户未绑定 Telegram 账户")
+	}
+	apiUrl := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", common.TelegramBotToken)
+	client, err := common.GetProxiedHttpClient(common.OutProxyUrl)
+	if err != nil {
+		return err
+	}
+	client.Timeout = 10 * time.Second
+	resp, err := client.PostForm(apiUrl, url.Values{"chat_id": {chatId}, "text": {text}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Telegram 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
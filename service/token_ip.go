@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/model"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	// 统计窗口内违规次数达到阈值后提醒令牌所有者，同一令牌在冷却时间内只提醒一次
+	tokenIpViolationWindow         = 10 * time.Minute
+	tokenIpViolationAlertThreshold = 5
+	tokenIpViolationAlertCooldown  = time.Hour
+)
+
+type tokenIpViolationCounter struct {
+	count       int
+	windowStart time.Time
+	lastAlert   time.Time
+}
+
+var (
+	tokenIpViolations     = make(map[int]*tokenIpViolationCounter)
+	tokenIpViolationsLock sync.Mutex
+)
+
+// RecordTokenIpViolation 记录令牌被白名单以外的 IP 使用，多次违规后通知令牌所有者
+func RecordTokenIpViolation(token *model.Token, ip string) {
+	common.SysLog(fmt.Sprintf("token #%d used from disallowed ip %s", token.Id, ip))
+	gopool.Go(func() {
+		err := model.IncreaseTokenIpViolationCount(token.Id)
+		if err != nil {
+			common.SysError("failed to increase token ip violation count: " + err.Error())
+		}
+		if shouldAlertTokenIpViolation(token.Id) {
+			notifyTokenIpViolation(token, ip)
+		}
+	})
+}
+
+func shouldAlertTokenIpViolation(tokenId int) bool {
+	tokenIpViolationsLock.Lock()
+	defer tokenIpViolationsLock.Unlock()
+	now := time.Now()
+	counter, ok := tokenIpViolations[tokenId]
+	if !ok {
+		counter = &tokenIpViolationCounter{windowStart: now}
+		tokenIpViolations[tokenId] = counter
+	}
+	if now.Sub(counter.windowStart) > tokenIpViolationWindow {
+		counter.count = 0
+		counter.windowStart = now
+	}
+	counter.count++
+	if counter.count < tokenIpViolationAlertThreshold || now.Sub(counter.lastAlert) < tokenIpViolationAlertCooldown {
+		return false
+	}
+	counter.lastAlert = now
+	return true
+}
+
+func notifyTokenIpViolation(token *model.Token, ip string) {
+	message := fmt.Sprintf("令牌 %s 在 %d 分钟内被白名单以外的 IP 多次调用，最近一次来自 %s，请确认令牌是否泄露", token.Name, int(tokenIpViolationWindow.Minutes()), ip)
+	model.RecordLog(token.UserId, model.LogTypeSystem, message)
+	email, err := model.GetUserEmail(token.UserId)
+	if err != nil || email == "" {
+		return
+	}
+	err = common.SendEmail(fmt.Sprintf("%s 令牌安全提醒", common.SystemName), email, message)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send token ip violation email: %s", err.Error()))
+	}
+}
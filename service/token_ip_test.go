@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// 统计窗口内违规次数达到阈值才提醒，冷却时间内不重复提醒，窗口过期后重新计数
+func TestShouldAlertTokenIpViolation(t *testing.T) {
+	tests := []struct {
+		name       string
+		counter    *tokenIpViolationCounter // 为 nil 时令牌没有违规记录
+		violations int
+		alerts     int
+	}{
+		{"below threshold", nil, tokenIpViolationAlertThreshold - 1, 0},
+		{"reach threshold", nil, tokenIpViolationAlertThreshold, 1},
+		{"cooldown after alert", nil, tokenIpViolationAlertThreshold * 3, 1},
+		{"window expired", &tokenIpViolationCounter{
+			count:       tokenIpViolationAlertThreshold - 1,
+			windowStart: time.Now().Add(-tokenIpViolationWindow - time.Minute),
+		}, 1, 0},
+		{"still in cooldown", &tokenIpViolationCounter{
+			count:       tokenIpViolationAlertThreshold,
+			windowStart: time.Now().Add(-time.Minute),
+			lastAlert:   time.Now().Add(-tokenIpViolationAlertCooldown + time.Minute),
+		}, 1, 0},
+		{"cooldown expired", &tokenIpViolationCounter{
+			count:       tokenIpViolationAlertThreshold,
+			windowStart: time.Now().Add(-time.Minute),
+			lastAlert:   time.Now().Add(-tokenIpViolationAlertCooldown - time.Minute),
+		}, 1, 1},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenId := 1000 + i
+			tokenIpViolationsLock.Lock()
+			if tt.counter != nil {
+				tokenIpViolations[tokenId] = tt.counter
+			} else {
+				delete(tokenIpViolations, tokenId)
+			}
+			tokenIpViolationsLock.Unlock()
+			t.Cleanup(func() {
+				tokenIpViolationsLock.Lock()
+				delete(tokenIpViolations, tokenId)
+				tokenIpViolationsLock.Unlock()
+			})
+
+			alerts := 0
+			for j := 0; j < tt.violations; j++ {
+				if shouldAlertTokenIpViolation(tokenId) {
+					alerts++
+				}
+			}
+			if alerts != tt.alerts {
+				t.Errorf("got %d alerts, want %d", alerts, tt.alerts)
+			}
+		})
+	}
+}
@@ -25,6 +25,9 @@ const LinuxDoOAuth = () => {
       if (message === 'bind') {
         showSuccess('绑定成功！');
         navigate('/setting');
+      } else if (data && data.require_2fa) {
+        // 启用了两步验证，回到登录页输入验证码
+        navigate('/login?require_2fa=1');
       } else {
         userDispatch({ type: 'login', payload: data });
         localStorage.setItem('user', JSON.stringify(data));
@@ -44,12 +44,17 @@ const LoginForm = () => {
   const [turnstileToken, setTurnstileToken] = useState('');
   let navigate = useNavigate();
   const [status, setStatus] = useState({});
+  const [showTwoFactorModal, setShowTwoFactorModal] = useState(false);
+  const [twoFactorCode, setTwoFactorCode] = useState('');
   const logo = getLogo();
 
   useEffect(() => {
     if (searchParams.get('expired')) {
       showError('未登录或登录已过期，请重新登录！');
     }
+    if (searchParams.get('require_2fa')) {
+      setShowTwoFactorModal(true);
+    }
     let status = localStorage.getItem('status');
     if (status) {
       status = JSON.parse(status);
@@ -77,11 +82,15 @@ const LoginForm = () => {
     );
     const { success, message, data } = res.data;
     if (success) {
+      setShowWeChatLoginModal(false);
+      if (data && data.require_2fa) {
+        setShowTwoFactorModal(true);
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       navigate('/');
       showSuccess('登录成功！');
-      setShowWeChatLoginModal(false);
     } else {
       showError(message);
     }
@@ -107,6 +116,10 @@ const LoginForm = () => {
       );
       const { success, message, data } = res.data;
       if (success) {
+        if (data && data.require_2fa) {
+          setShowTwoFactorModal(true);
+          return;
+        }
         userDispatch({ type: 'login', payload: data });
         setUserData(data);
         updateAPI();
@@ -148,6 +161,10 @@ const LoginForm = () => {
     const res = await API.get(`/api/oauth/telegram/login`, { params });
     const { success, message, data } = res.data;
     if (success) {
+      if (data && data.require_2fa) {
+        setShowTwoFactorModal(true);
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       showSuccess('登录成功！');
@@ -157,6 +174,29 @@ const LoginForm = () => {
     }
   };
 
+  // 登录的第二步，提交 TOTP 验证码或恢复码
+  const onSubmitTwoFactorCode = async () => {
+    if (twoFactorCode === '') {
+      showInfo('请输入验证码！');
+      return;
+    }
+    const res = await API.post('/api/user/login/2fa', {
+      code: twoFactorCode,
+    });
+    const { success, message, data } = res.data;
+    if (success) {
+      userDispatch({ type: 'login', payload: data });
+      setUserData(data);
+      updateAPI();
+      setShowTwoFactorModal(false);
+      setTwoFactorCode('');
+      showSuccess('登录成功！');
+      navigate('/token');
+    } else {
+      showError(message);
+    }
+  };
+
   return (
     <div>
       <Layout>
@@ -319,6 +359,32 @@ const LoginForm = () => {
                     />
                   </Form>
                 </Modal>
+                <Modal
+                  title='两步验证'
+                  visible={showTwoFactorModal}
+                  maskClosable={false}
+                  onOk={onSubmitTwoFactorCode}
+                  onCancel={() => {
+                    setShowTwoFactorModal(false);
+                    setTwoFactorCode('');
+                  }}
+                  okText={'验证'}
+                  size={'small'}
+                  centered={true}
+                >
+                  <div style={{ textAlign: 'center' }}>
+                    <p>请输入身份验证器中的 6 位验证码，或使用恢复码</p>
+                  </div>
+                  <Form size='large' onSubmit={onSubmitTwoFactorCode}>
+                    <Form.Input
+                      field={'two_factor_code'}
+                      placeholder='验证码或恢复码'
+                      label={'验证码'}
+                      value={twoFactorCode}
+                      onChange={(value) => setTwoFactorCode(value)}
+                    />
+                  </Form>
+                </Modal>
               </Card>
               {turnstileEnabled ? (
                 <div
@@ -91,6 +91,13 @@ function renderType(type) {
           系统{' '}
         </Tag>
       );
+    case 5:
+      return (
+        <Tag color='red' size='large'>
+          {' '}
+          错误{' '}
+        </Tag>
+      );
     default:
       return (
         <Tag color='black' size='large'>
@@ -376,6 +383,15 @@ const LogsTable = () => {
       dataIndex: 'content',
       render: (text, record, index) => {
         let other = getLogOther(record.other);
+        if (
+          record.type === 5 &&
+          other != null &&
+          other.admin_info !== undefined &&
+          other.admin_info.error_message
+        ) {
+          // 上游返回的原始错误信息只对管理员可见
+          text = text + '：' + other.admin_info.error_message;
+        }
         if (other == null || record.type !== 2) {
           return (
             <Paragraph
@@ -718,6 +734,7 @@ const LogsTable = () => {
           <Select.Option value='2'>消费</Select.Option>
           <Select.Option value='3'>管理</Select.Option>
           <Select.Option value='4'>系统</Select.Option>
+          <Select.Option value='5'>错误</Select.Option>
         </Select>
       </Layout>
     </>
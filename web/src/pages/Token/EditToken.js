@@ -2,6 +2,7 @@ import React, { useEffect, useState } from 'react';
 import { useNavigate } from 'react-router-dom';
 import {
   API,
+  copy,
   isMobile,
   showError,
   showSuccess,
@@ -15,6 +16,7 @@ import {
   Checkbox,
   DatePicker,
   Input,
+  Modal,
   Select,
   SideSheet,
   Space,
@@ -176,6 +178,7 @@ const EditToken = (props) => {
     } else {
       // 处理新增多个令牌的情况
       let successCount = 0; // 记录成功创建的令牌数量
+      let createdKeys = []; // 令牌明文只在创建时返回一次
       for (let i = 0; i < tokenCount; i++) {
         let localInputs = { ...inputs };
         if (i !== 0) {
@@ -195,10 +198,11 @@ const EditToken = (props) => {
         }
         localInputs.model_limits = localInputs.model_limits.join(',');
         let res = await API.post(`/api/token/`, localInputs);
-        const { success, message } = res.data;
+        const { success, message, data } = res.data;
 
         if (success) {
           successCount++;
+          createdKeys.push(data.name + '    sk-' + data.key);
         } else {
           showError(message);
           break; // 如果创建失败，终止循环
@@ -206,9 +210,8 @@ const EditToken = (props) => {
       }
 
       if (successCount > 0) {
-        showSuccess(
-          `${successCount}个令牌创建成功，请在列表页面点击复制获取令牌！`,
-        );
+        showSuccess(`${successCount}个令牌创建成功！`);
+        showCreatedKeys(createdKeys.join('\n'));
         props.refresh();
         props.handleClose();
       }
@@ -218,6 +221,32 @@ const EditToken = (props) => {
     setTokenCount(1); // 重置数量为默认值
   };
 
+  const showCreatedKeys = (keys) => {
+    Modal.info({
+      title: '请立即复制并妥善保存令牌',
+      content: (
+        <>
+          <Typography.Text type='warning'>
+            令牌只显示这一次，关闭后将无法再次查看。
+          </Typography.Text>
+          <pre style={{ whiteSpace: 'pre-wrap', wordBreak: 'break-all' }}>
+            {keys}
+          </pre>
+        </>
+      ),
+      okText: '复制并关闭',
+      size: 'large',
+      onOk: async () => {
+        if (await copy(keys)) {
+          showSuccess('已复制到剪贴板！');
+        } else {
+          showError('无法复制到剪贴板，请手动复制');
+          return Promise.reject();
+        }
+      },
+    });
+  };
+
   return (
     <>
       <SideSheet